@@ -0,0 +1,89 @@
+// Package app wires the configuration, database and the services built on
+// them into one container that the HTTP routes are set up from.
+package app
+
+import (
+	"newworld-project/config"
+	"newworld-project/emails"
+	"newworld-project/handlers"
+	"newworld-project/mailer"
+	"newworld-project/metrics"
+	"newworld-project/middleware"
+	"newworld-project/outbox"
+	"newworld-project/repository"
+	"newworld-project/scheduler"
+	"newworld-project/utils"
+
+	"gorm.io/gorm"
+)
+
+// App holds the dependencies shared by handlers and middleware
+type App struct {
+	Config      *config.Config
+	DB          *gorm.DB
+	Store       repository.Store
+	Tokens      *utils.TokenService
+	Mailer      mailer.Mailer
+	Emails      *emails.Templates
+	Outbox      *outbox.Worker
+	Scheduler   *scheduler.Scheduler
+	Permissions *middleware.PermissionChecker
+	RateLimits  middleware.RateLimitStore
+	// Passkeys is built up front because an invalid WebAuthn relying
+	// party configuration should stop startup
+	Passkeys *handlers.PasskeyHandler
+}
+
+// New builds the container for a configuration and an open, migrated
+// database
+func New(cfg *config.Config, db *gorm.DB) (*App, error) {
+	m, err := mailer.New(cfg.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := emails.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, err := scheduler.JobsFromConfig(cfg.Scheduler)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Metrics.Enabled {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		if err := metrics.RegisterDB(sqlDB); err != nil {
+			return nil, err
+		}
+	}
+
+	tokens, err := utils.NewTokenService(cfg.JWT)
+	if err != nil {
+		return nil, err
+	}
+
+	store := repository.NewGormStore(db)
+	passkeys, err := handlers.NewPasskeyHandler(cfg, store, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	return &App{
+		Config:      cfg,
+		DB:          db,
+		Store:       store,
+		Tokens:      tokens,
+		Mailer:      m,
+		Emails:      templates,
+		Outbox:      outbox.NewWorker(store, m, outbox.OptionsFromConfig(cfg.Email)),
+		Scheduler:   scheduler.New(store, jobs, scheduler.Options{}),
+		Permissions: middleware.NewPermissionChecker(store),
+		RateLimits:  middleware.NewRateLimitStore(cfg.Security, db),
+		Passkeys:    passkeys,
+	}, nil
+}
@@ -1,42 +1,112 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"log"
-	"net"
 	"os"
 	"strconv"
 
+	"newworld-project/logging"
+
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Email    EmailConfig
-	App      AppConfig
-	Security SecurityConfig
+	// Profile is dev, test or prod
+	Profile string
+
+	Server    ServerConfig
+	Database  DatabaseConfig
+	JWT       JWTConfig
+	Email     EmailConfig
+	App       AppConfig
+	Security  SecurityConfig
+	WebAuthn  WebAuthnConfig
+	Scheduler SchedulerConfig
+	Log       LogConfig
+	Metrics   MetricsConfig
+
+	// settings records where each value was read from, for Print
+	settings []Setting
 }
 
 type ServerConfig struct {
 	Port string
 	Host string
+
+	// Listen replaces Host and Port with "unix:<path>" for a Unix socket or
+	// "systemd" for the socket passed by systemd socket activation
+	Listen string
+
+	// AutoPort moves to the next free port when Port is taken, for
+	// development only. PortFile receives the port actually bound.
+	AutoPort bool
+	PortFile string
+
+	// Timeouts in seconds; 0 disables one. In-flight requests get
+	// ShutdownTimeout to finish when the server stops.
+	ReadTimeout       int
+	ReadHeaderTimeout int
+	WriteTimeout      int
+	IdleTimeout       int
+	ShutdownTimeout   int
+
+	TLS TLSConfig
+}
+
+// TLSConfig turns on HTTPS when CertFile and KeyFile are set. The files are
+// checked for changes every ReloadInterval seconds (0 checks on every
+// handshake), so rotated certificates are picked up without a restart.
+// MinVersion is 1.2 or 1.3 and CipherSuites, if set, limits the TLS 1.2
+// suites to the listed names.
+//
+// With a ClientCAFile, clients presenting a certificate signed by one of its
+// CAs are verified (ClientAuth optional) or required to do so (ClientAuth
+// require). ClientIdentities maps a verified certificate's subject, a URI or
+// DNS name or else its common name, to the role the service calling with it
+// acts as.
+type TLSConfig struct {
+	CertFile       string
+	KeyFile        string
+	ReloadInterval int
+
+	MinVersion   string
+	CipherSuites []string
+
+	ClientCAFile     string
+	ClientAuth       string
+	ClientIdentities map[string]string
 }
 
 type DatabaseConfig struct {
+	// Type is postgres or sqlite, in which case Name is the database file
+	Type     string
 	Host     string
 	Port     string
 	User     string
 	Password string
 	Name     string
 	SSLMode  string
+
+	// Migrations is "auto" to apply pending migrations at startup or
+	// "check" to refuse to start while any are pending
+	Migrations string
 }
 
 type JWTConfig struct {
 	Secret              string
+	Issuer              string
+	Audience            string
 	AccessTokenExpiry   int
 	RefreshTokenExpiry  int
+	MFAChallengeExpiry  int
+
+	// Algorithm is HS256 (shared Secret) or one of RS256, ES256 and EdDSA, in
+	// which case tokens are signed with the PEM key in SigningKeyFile and may
+	// also be verified with the public keys in VerificationKeyFiles.
+	Algorithm            string
+	SigningKeyFile       string
+	VerificationKeyFiles []string
 }
 
 type EmailConfig struct {
@@ -45,6 +115,28 @@ type EmailConfig struct {
 	Username string
 	Password string
 	From     string
+
+	// Transport is "smtp", "file" to write .eml files into Dir, "log" to
+	// print messages to the log or "memory" to keep them in process
+	Transport string
+	Dir       string
+
+	// Email templates are embedded in the binary; files in TemplateDir
+	// replace the embedded ones. Users without a supported locale get
+	// DefaultLocale. TemplatePreview enables the /dev/emails endpoints.
+	TemplateDir     string
+	DefaultLocale   string
+	TemplatePreview bool
+
+	// Queued emails are sent by OutboxWorkers goroutines that poll every
+	// OutboxPollInterval seconds. A failed email is retried after
+	// RetryDelay seconds, doubling up to MaxRetryDelay, and moved to the
+	// dead-letter state after MaxAttempts attempts.
+	OutboxWorkers      int
+	OutboxPollInterval int
+	MaxAttempts        int
+	RetryDelay         int
+	MaxRetryDelay      int
 }
 
 type AppConfig struct {
@@ -57,117 +149,282 @@ type SecurityConfig struct {
 	BcryptCost       int
 	RateLimitRequests int
 	RateLimitWindow   int
+
+	// Stricter limits for credential endpoints: per client IP and per
+	// account identifier (email or username) within RateLimitWindow
+	AuthRateLimitRequests    int
+	AccountRateLimitRequests int
+	// RateLimitStore is "memory" or "database"
+	RateLimitStore string
+
+	// An account is locked for LockoutDuration seconds after
+	// LockoutThreshold consecutive failed logins; every further failure
+	// doubles the lock, up to LockoutMaxDuration seconds
+	LockoutThreshold   int
+	LockoutDuration    int
+	LockoutMaxDuration int
+}
+
+// WebAuthnConfig identifies this service as a WebAuthn relying party. RPID is
+// the registrable domain passkeys are bound to and RPOrigins the exact
+// origins (scheme, host and port) the browser ceremonies run on.
+type WebAuthnConfig struct {
+	RPID          string
+	RPDisplayName string
+	RPOrigins     []string
+}
+
+// SchedulerConfig sets when the background jobs run. Schedules are cron
+// expressions (or @daily, @every 30m and the like); an empty schedule or
+// "off" disables the job. Accounts that never verified their email are
+// purged UnverifiedUserRetention days after sign-up and soft-deleted
+// accounts DeletedUserRetention days after deletion.
+type SchedulerConfig struct {
+	Enabled bool
+
+	PurgeTokensSchedule          string
+	PurgeUnverifiedUsersSchedule string
+	PurgeDeletedUsersSchedule    string
+
+	UnverifiedUserRetention int
+	DeletedUserRetention    int
+}
+
+// LogConfig sets how logs are written. Level applies to every subsystem
+// without an entry in Levels, which maps subsystems such as db or http to
+// their own level. Format is json or text.
+type LogConfig struct {
+	Level  string
+	Format string
+	Levels map[string]string
+}
+
+// MetricsConfig sets how the Prometheus metrics are served. With Listen
+// set to a host:port they are served there without authentication and not
+// on the API; otherwise GET /metrics on the API needs the metrics:read
+// permission.
+type MetricsConfig struct {
+	Enabled bool
+	Listen  string
 }
 
 var ConfigInstance *Config
 
-// Helper functions for port validation
-func isPortAvailable(port int) bool {
-	address := fmt.Sprintf(":%d", port)
-	listener, err := net.Listen("tcp", address)
+// Built-in secrets, which the prod profile refuses to run with
+const (
+	defaultJWTSecret  = "default_secret_key_change_in_production"
+	defaultDBPassword = "teest1234"
+)
+
+// LoadConfig loads and validates the configuration into ConfigInstance and
+// sets up logging with it, exiting if it is invalid
+func LoadConfig() {
+	logger := logging.Logger(logging.Config)
+	cfg, err := Load()
 	if err != nil {
-		return false
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
-	listener.Close()
-	return true
-}
-
-func findAvailablePort(startPort int) (int, error) {
-	for port := startPort; port < startPort+100; port++ {
-		if isPortAvailable(port) {
-			return port, nil
+	if err := logging.Setup(os.Stderr, logging.Options{Level: cfg.Log.Level, Format: cfg.Log.Format, Levels: cfg.Log.Levels}); err != nil {
+		logger.Error("Failed to set up logging", "error", err)
+		os.Exit(1)
+	}
+	if cfg.Profile != ProfileProd {
+		for _, warning := range cfg.Warnings() {
+			logger.Warn(warning)
 		}
 	}
-	return 0, fmt.Errorf("no available port found between %d and %d", startPort, startPort+100)
+	ConfigInstance = cfg
+
+	logger.Info("Configuration loaded successfully", "profile", cfg.Profile)
 }
 
-func getPortFromString(portStr string, defaultPort int) int {
-	if portStr == "" {
-		return defaultPort
+// Load reads the configuration with Read and validates it
+func Load() (*Config, error) {
+	cfg, err := Read()
+	if err != nil {
+		return nil, err
 	}
-	
-	port, err := strconv.Atoi(portStr)
-	if err != nil || port <= 0 || port > 65535 {
-		return defaultPort
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
-	
-	return port
+	return cfg, nil
 }
 
-func LoadConfig() {
+// Read reads the configuration without validating it. Each setting is taken
+// from the first of these that sets it:
+//
+//   - the environment, including a .env file in the working directory
+//   - the profile's config file, e.g. config.prod.yaml
+//   - the config file, CONFIG_FILE or config.yaml, config.yml or config.toml
+//   - the profile's built-in defaults
+//   - the built-in defaults
+//
+// The profile is APP_ENV: dev (the default), test or prod. Any setting can
+// instead be read from the file named by the setting with _FILE appended,
+// such as JWT_SECRET_FILE, which suits mounted secrets.
+func Read() (*Config, error) {
 	err := godotenv.Load()
 	if err != nil {
-		log.Println("Warning: .env file not found, using environment variables")
-	}
-
-	// Get port with validation
-	portStr := getEnv("SERVER_PORT", "8081")
-	port := getPortFromString(portStr, 8081)
-	
-	// Check if port is available, if not find an available one
-	if !isPortAvailable(port) {
-		log.Printf("Warning: Port %d is not available", port)
-		if availablePort, err := findAvailablePort(port); err == nil {
-			port = availablePort
-			log.Printf("Using available port: %d", port)
-		} else {
-			log.Printf("Error finding available port: %v", err)
+		logging.Logger(logging.Config).Warn(".env file not found, using environment variables")
+	}
+
+	profile := os.Getenv("APP_ENV")
+	if profile == "" {
+		profile = ProfileDev
+	}
+	if _, ok := profileDefaults[profile]; !ok {
+		return nil, fmt.Errorf("invalid APP_ENV %q: must be dev, test or prod", profile)
+	}
+
+	paths, err := findConfigFiles(profile)
+	if err != nil {
+		return nil, err
+	}
+	var files []layer
+	for _, path := range paths {
+		file, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
 		}
+		files = append(files, file)
+	}
+	l := newLoader(profile, files)
+
+	port := l.int("SERVER_PORT", 8081)
+	host := l.string("SERVER_HOST", "localhost")
+	dbType := l.string("DB_TYPE", "postgres")
+	defaultDBName := "newworld_db"
+	if dbType == "sqlite" {
+		defaultDBName = "newworld.db"
 	}
 
-	ConfigInstance = &Config{
+	cfg := &Config{
+		Profile: profile,
 		Server: ServerConfig{
 			Port: strconv.Itoa(port),
-			Host: getEnv("SERVER_HOST", "localhost"),
+			Host: host,
+
+			Listen: l.string("SERVER_LISTEN", ""),
+
+			AutoPort: l.bool("SERVER_AUTO_PORT", false),
+			PortFile: l.string("SERVER_PORT_FILE", ""),
+
+			ReadTimeout:       l.int("SERVER_READ_TIMEOUT", 30),
+			ReadHeaderTimeout: l.int("SERVER_READ_HEADER_TIMEOUT", 10),
+			WriteTimeout:      l.int("SERVER_WRITE_TIMEOUT", 30),
+			IdleTimeout:       l.int("SERVER_IDLE_TIMEOUT", 120),
+			ShutdownTimeout:   l.int("SERVER_SHUTDOWN_TIMEOUT", 5),
+
+			TLS: TLSConfig{
+				CertFile:       l.string("TLS_CERT_FILE", ""),
+				KeyFile:        l.string("TLS_KEY_FILE", ""),
+				ReloadInterval: l.int("TLS_RELOAD_INTERVAL", 60),
+
+				MinVersion:   l.string("TLS_MIN_VERSION", "1.2"),
+				CipherSuites: l.list("TLS_CIPHER_SUITES"),
+
+				ClientCAFile:     l.string("TLS_CLIENT_CA_FILE", ""),
+				ClientAuth:       l.string("TLS_CLIENT_AUTH", "optional"),
+				ClientIdentities: l.pairs("TLS_CLIENT_IDENTITIES"),
+			},
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "teest1234"),
-			Name:     getEnv("DB_NAME", "newworld_db"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			Type:     dbType,
+			Host:     l.string("DB_HOST", "localhost"),
+			Port:     l.string("DB_PORT", "5432"),
+			User:     l.string("DB_USER", "postgres"),
+			Password: l.secret("DB_PASSWORD", defaultDBPassword),
+			Name:     l.string("DB_NAME", defaultDBName),
+			SSLMode:  l.string("DB_SSLMODE", "disable"),
+
+			Migrations: l.string("DB_MIGRATIONS", "auto"),
 		},
 		JWT: JWTConfig{
-			Secret:             getEnv("JWT_SECRET", "default_secret_key_change_in_production"),
-			AccessTokenExpiry:  getEnvAsInt("JWT_ACCESS_TOKEN_EXPIRY", 3600),
-			RefreshTokenExpiry: getEnvAsInt("JWT_REFRESH_TOKEN_EXPIRY", 604800),
+			Secret:             l.secret("JWT_SECRET", defaultJWTSecret),
+			Issuer:             l.string("JWT_ISSUER", "newworld-project"),
+			Audience:           l.string("JWT_AUDIENCE", "newworld-api"),
+			AccessTokenExpiry:  l.int("JWT_ACCESS_TOKEN_EXPIRY", 3600),
+			RefreshTokenExpiry: l.int("JWT_REFRESH_TOKEN_EXPIRY", 604800),
+			MFAChallengeExpiry: l.int("JWT_MFA_CHALLENGE_EXPIRY", 300),
+
+			Algorithm:            l.string("JWT_ALGORITHM", "HS256"),
+			SigningKeyFile:       l.string("JWT_SIGNING_KEY_FILE", ""),
+			VerificationKeyFiles: l.list("JWT_VERIFICATION_KEY_FILES"),
 		},
 		Email: EmailConfig{
-			Host:     getEnv("SMTP_HOST", "smtp.gmail.com"),
-			Port:     getEnvAsInt("SMTP_PORT", 587),
-			Username: getEnv("SMTP_USERNAME", ""),
-			Password: getEnv("SMTP_PASSWORD", ""),
-			From:     getEnv("EMAIL_FROM", ""),
-		},
-		App: AppConfig{
-			Name:        getEnv("APP_NAME", "NewWorld Project"),
-			URL:         getEnv("APP_URL", fmt.Sprintf("http://localhost:%d", port)),
-			FrontendURL: getEnv("FRONTEND_URL", "http://localhost:3000"),
+			Host:     l.string("SMTP_HOST", "smtp.gmail.com"),
+			Port:     l.int("SMTP_PORT", 587),
+			Username: l.string("SMTP_USERNAME", ""),
+			Password: l.secret("SMTP_PASSWORD", ""),
+			From:     l.string("EMAIL_FROM", ""),
+
+			Transport: l.string("EMAIL_TRANSPORT", "smtp"),
+			Dir:       l.string("EMAIL_DIR", "mail"),
+
+			TemplateDir:     l.string("EMAIL_TEMPLATE_DIR", ""),
+			DefaultLocale:   l.string("EMAIL_DEFAULT_LOCALE", "en"),
+			TemplatePreview: l.bool("EMAIL_TEMPLATE_PREVIEW", false),
+
+			OutboxWorkers:      l.int("EMAIL_OUTBOX_WORKERS", 2),
+			OutboxPollInterval: l.int("EMAIL_OUTBOX_POLL_INTERVAL", 2),
+			MaxAttempts:        l.int("EMAIL_MAX_ATTEMPTS", 8),
+			RetryDelay:         l.int("EMAIL_RETRY_DELAY", 30),
+			MaxRetryDelay:      l.int("EMAIL_MAX_RETRY_DELAY", 3600),
 		},
 		Security: SecurityConfig{
-			BcryptCost:        getEnvAsInt("BCRYPT_COST", 12),
-			RateLimitRequests: getEnvAsInt("RATE_LIMIT_REQUESTS", 100),
-			RateLimitWindow:   getEnvAsInt("RATE_LIMIT_WINDOW", 900),
+			BcryptCost:        l.int("BCRYPT_COST", 12),
+			RateLimitRequests: l.int("RATE_LIMIT_REQUESTS", 100),
+			RateLimitWindow:   l.int("RATE_LIMIT_WINDOW", 900),
+
+			AuthRateLimitRequests:    l.int("AUTH_RATE_LIMIT_REQUESTS", 20),
+			AccountRateLimitRequests: l.int("ACCOUNT_RATE_LIMIT_REQUESTS", 5),
+			RateLimitStore:           l.string("RATE_LIMIT_STORE", "memory"),
+
+			LockoutThreshold:   l.int("LOCKOUT_THRESHOLD", 5),
+			LockoutDuration:    l.int("LOCKOUT_DURATION", 900),
+			LockoutMaxDuration: l.int("LOCKOUT_MAX_DURATION", 86400),
 		},
-	}
+		Scheduler: SchedulerConfig{
+			Enabled: l.bool("SCHEDULER_ENABLED", true),
 
-	log.Printf("Configuration loaded successfully")
-	log.Printf("Server will run on: %s:%s", ConfigInstance.Server.Host, ConfigInstance.Server.Port)
-}
+			PurgeTokensSchedule:          l.string("JOB_PURGE_TOKENS_SCHEDULE", "0 * * * *"),
+			PurgeUnverifiedUsersSchedule: l.string("JOB_PURGE_UNVERIFIED_USERS_SCHEDULE", "30 3 * * *"),
+			PurgeDeletedUsersSchedule:    l.string("JOB_PURGE_DELETED_USERS_SCHEDULE", "0 4 * * *"),
+
+			UnverifiedUserRetention: l.int("UNVERIFIED_USER_RETENTION_DAYS", 7),
+			DeletedUserRetention:    l.int("DELETED_USER_RETENTION_DAYS", 30),
+		},
+		Log: LogConfig{
+			Level:  l.string("LOG_LEVEL", "info"),
+			Format: l.string("LOG_FORMAT", "json"),
+			Levels: l.pairs("LOG_LEVELS"),
+		},
+		Metrics: MetricsConfig{
+			Enabled: l.bool("METRICS_ENABLED", true),
+			Listen:  l.string("METRICS_LISTEN", ""),
+		},
+	}
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	appName := l.string("APP_NAME", "NewWorld Project")
+	cfg.App = AppConfig{
+		Name:        appName,
+		URL:         l.string("APP_URL", fmt.Sprintf("http://localhost:%d", port)),
+		FrontendURL: l.string("FRONTEND_URL", "http://localhost:3000"),
+	}
+	cfg.WebAuthn = WebAuthnConfig{
+		RPID:          l.string("WEBAUTHN_RP_ID", "localhost"),
+		RPDisplayName: l.string("WEBAUTHN_RP_DISPLAY_NAME", appName),
+		RPOrigins:     l.list("WEBAUTHN_RP_ORIGINS"),
+	}
+	if len(cfg.WebAuthn.RPOrigins) == 0 {
+		cfg.WebAuthn.RPOrigins = []string{cfg.App.FrontendURL}
 	}
-	return defaultValue
-}
 
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
+	l.unknownKeys()
+	cfg.settings = l.settings
+	if len(l.errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %w", errors.Join(l.errs...))
 	}
-	return defaultValue
-} 
\ No newline at end of file
+	return cfg, nil
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadLayersSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.yaml"), `
+server:
+  host: 0.0.0.0
+jwt:
+  issuer: from-file
+  secret_file: `+filepath.Join(dir, "jwt_secret")+`
+BCRYPT_COST: 11
+webauthn:
+  rp_origins: [https://a.example, https://b.example]
+`)
+	writeFile(t, filepath.Join(dir, "config.test.toml"), `
+[jwt]
+issuer = "from-profile-file"
+audience = "from-profile-file"
+`)
+	writeFile(t, filepath.Join(dir, "jwt_secret"), "s3cret\n")
+	t.Setenv("CONFIG_FILE", filepath.Join(dir, "config.yaml"))
+	t.Setenv("APP_ENV", ProfileTest)
+	t.Setenv("JWT_AUDIENCE", "from-env")
+
+	cfg, err := Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, got, want string
+	}{
+		{"host from file", cfg.Server.Host, "0.0.0.0"},
+		{"profile file over file", cfg.JWT.Issuer, "from-profile-file"},
+		{"environment over files", cfg.JWT.Audience, "from-env"},
+		{"secret from file", cfg.JWT.Secret, "s3cret"},
+		{"profile default", cfg.Email.Transport, "memory"},
+		{"built-in default", cfg.Database.Migrations, "auto"},
+		{"list", strings.Join(cfg.WebAuthn.RPOrigins, " "), "https://a.example https://b.example"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+	// The file beats the profile default of 4
+	if cfg.Security.BcryptCost != 11 {
+		t.Errorf("BcryptCost = %d, want 11", cfg.Security.BcryptCost)
+	}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out, true); err != nil {
+		t.Fatal(err)
+	}
+	printed := out.String()
+	if strings.Contains(printed, "s3cret") || !strings.Contains(printed, "JWT_SECRET: '[REDACTED]' # "+filepath.Join(dir, "config.yaml")+" (JWT_SECRET_FILE)") {
+		t.Errorf("redacted output:\n%s", printed)
+	}
+	if !strings.Contains(printed, "JWT_AUDIENCE: from-env # environment") {
+		t.Errorf("output does not name sources:\n%s", printed)
+	}
+}
+
+func TestReadRejectsBadInput(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		env  map[string]string
+		file string
+		want string
+	}{
+		{"unknown profile", map[string]string{"APP_ENV": "staging"}, "", "APP_ENV"},
+		{"not a number", map[string]string{"SMTP_PORT": "twenty-five"}, "", "SMTP_PORT"},
+		{"not a bool", map[string]string{"SCHEDULER_ENABLED": "sometimes"}, "", "SCHEDULER_ENABLED"},
+		{"missing secret file", map[string]string{"DB_PASSWORD_FILE": filepath.Join(dir, "missing")}, "", "DB_PASSWORD_FILE"},
+		{"misspelt key", nil, "jwt:\n  secrte: x\n", "unknown setting JWT_SECRTE"},
+		{"malformed identity", map[string]string{"TLS_CLIENT_IDENTITIES": "billing.internal"}, "", "TLS_CLIENT_IDENTITIES"},
+		{"missing config file", map[string]string{"CONFIG_FILE": filepath.Join(dir, "missing.yaml")}, "", "CONFIG_FILE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.file != "" {
+				path := filepath.Join(dir, tt.name+".yaml")
+				writeFile(t, path, tt.file)
+				t.Setenv("CONFIG_FILE", path)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			if _, err := Read(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Read() error = %v, want one mentioning %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		return &Config{
+			Profile:  ProfileProd,
+			Server:   ServerConfig{Port: "8081", ShutdownTimeout: 5},
+			Database: DatabaseConfig{Type: "postgres", Password: "correct horse battery", Migrations: "check"},
+			JWT: JWTConfig{
+				Algorithm: "HS256", Secret: strings.Repeat("k", 32),
+				AccessTokenExpiry: 900, RefreshTokenExpiry: 86400, MFAChallengeExpiry: 300,
+			},
+			Email:     EmailConfig{Transport: "smtp", Port: 587, From: "noreply@example.com"},
+			Security:  SecurityConfig{BcryptCost: 12, RateLimitStore: "database", RateLimitWindow: 60},
+			Scheduler: SchedulerConfig{UnverifiedUserRetention: 7, DeletedUserRetention: 30},
+			Log:       LogConfig{Level: "info", Format: "json"},
+		}
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("valid configuration rejected: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*Config)
+		// unsafe problems only fail the prod profile
+		unsafe bool
+	}{
+		{"default JWT secret", func(c *Config) { c.JWT.Secret = defaultJWTSecret }, true},
+		{"short JWT secret", func(c *Config) { c.JWT.Secret = "short" }, true},
+		{"default database password", func(c *Config) { c.Database.Password = defaultDBPassword }, true},
+		{"weak bcrypt cost", func(c *Config) { c.Security.BcryptCost = 10 }, true},
+		{"no sender", func(c *Config) { c.Email.From = "" }, true},
+		{"template preview", func(c *Config) { c.Email.TemplatePreview = true }, true},
+		{"unknown algorithm", func(c *Config) { c.JWT.Algorithm = "none" }, false},
+		{"no signing key", func(c *Config) { c.JWT.Algorithm = "ES256" }, false},
+		{"unknown transport", func(c *Config) { c.Email.Transport = "pigeon" }, false},
+		{"bcrypt cost out of range", func(c *Config) { c.Security.BcryptCost = 40 }, false},
+		{"unknown migrations mode", func(c *Config) { c.Database.Migrations = "skip" }, false},
+		{"zero token expiry", func(c *Config) { c.JWT.AccessTokenExpiry = 0 }, false},
+		{"port out of range", func(c *Config) { c.Server.Port = "70000" }, false},
+		{"unknown listener", func(c *Config) { c.Server.Listen = "tcp:8081" }, false},
+		{"TLS key without certificate", func(c *Config) {
+			c.Server.TLS = TLSConfig{KeyFile: "tls.key", MinVersion: "1.2", ClientAuth: "optional"}
+		}, false},
+		{"old TLS version", func(c *Config) {
+			c.Server.TLS = TLSConfig{CertFile: "tls.crt", KeyFile: "tls.key", MinVersion: "1.0", ClientAuth: "optional"}
+		}, false},
+		{"client CA without TLS", func(c *Config) { c.Server.TLS.ClientCAFile = "ca.crt" }, false},
+		{"unknown log level", func(c *Config) { c.Log.Level = "verbose" }, false},
+		{"unknown log subsystem", func(c *Config) { c.Log.Levels = map[string]string{"sql": "debug"} }, false},
+		{"metrics listener without port", func(c *Config) { c.Metrics = MetricsConfig{Enabled: true, Listen: "localhost"} }, false},
+	}
+	for _, tt := range tests {
+		cfg := valid()
+		tt.change(cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: accepted in prod", tt.name)
+		}
+
+		cfg.Profile = ProfileDev
+		if err := cfg.Validate(); (err == nil) != tt.unsafe {
+			t.Errorf("%s: dev profile error = %v", tt.name, err)
+		}
+		if tt.unsafe && len(cfg.Warnings()) == 0 {
+			t.Errorf("%s: no warning in dev", tt.name)
+		}
+	}
+
+	// Transports that never deliver are only for development
+	for _, transport := range []string{"log", "memory"} {
+		cfg := valid()
+		cfg.Email.Transport = transport
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("EMAIL_TRANSPORT=%s accepted in prod", transport)
+		}
+		cfg.Profile = ProfileDev
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("EMAIL_TRANSPORT=%s rejected in dev: %v", transport, err)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Profiles pick a set of built-in defaults and how strictly the
+// configuration is validated
+const (
+	ProfileDev  = "dev"
+	ProfileTest = "test"
+	ProfileProd = "prod"
+)
+
+// profileDefaults replace the built-in defaults in a profile
+var profileDefaults = map[string]map[string]string{
+	ProfileDev: {
+		"LOG_FORMAT": "text",
+	},
+	ProfileTest: {
+		"EMAIL_TRANSPORT":   "memory",
+		"BCRYPT_COST":       "4",
+		"SCHEDULER_ENABLED": "false",
+	},
+	ProfileProd: {
+		"DB_SSLMODE":    "require",
+		"DB_MIGRATIONS": "check",
+	},
+}
+
+// configExtensions are the config file formats, in the order they are
+// looked for
+var configExtensions = []string{".yaml", ".yml", ".toml"}
+
+// Setting is one configuration value and where it came from
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+	Secret bool
+}
+
+// layer is one source of settings, keyed by environment variable name
+type layer struct {
+	name   string
+	values map[string]string
+}
+
+// loader reads settings from the environment, the config files, the
+// profile defaults and the built-in defaults, in that order, and records
+// every value it hands out along with any that could not be parsed
+type loader struct {
+	layers   []layer
+	settings []Setting
+	errs     []error
+}
+
+func newLoader(profile string, files []layer) *loader {
+	env := layer{name: "environment", values: map[string]string{}}
+	for _, entry := range os.Environ() {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			env.values[key] = value
+		}
+	}
+
+	l := &loader{layers: []layer{env}}
+	// Files listed later override earlier ones
+	for i := len(files) - 1; i >= 0; i-- {
+		l.layers = append(l.layers, files[i])
+	}
+	l.layers = append(l.layers, layer{name: "profile " + profile, values: profileDefaults[profile]})
+	return l
+}
+
+// lookup finds the first layer that sets key, either directly or as a path
+// in key_FILE to read the value from. Empty values count as unset.
+func (l *loader) lookup(key string) (value, source string, ok bool) {
+	for _, layer := range l.layers {
+		if value := layer.values[key]; value != "" {
+			return value, layer.name, true
+		}
+		if path := layer.values[key+"_FILE"]; path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				l.errs = append(l.errs, fmt.Errorf("%s_FILE: %w", key, err))
+				return "", "", false
+			}
+			return strings.TrimRight(string(data), "\r\n"), layer.name + " (" + key + "_FILE)", true
+		}
+	}
+	return "", "", false
+}
+
+func (l *loader) record(key, value, source string, secret bool) {
+	l.settings = append(l.settings, Setting{Key: key, Value: value, Source: source, Secret: secret})
+}
+
+func (l *loader) get(key, defaultValue string, secret bool) string {
+	value, source, ok := l.lookup(key)
+	if !ok {
+		value, source = defaultValue, "default"
+	}
+	l.record(key, value, source, secret)
+	return value
+}
+
+func (l *loader) string(key, defaultValue string) string {
+	return l.get(key, defaultValue, false)
+}
+
+// secret is string for values that config print redacts
+func (l *loader) secret(key, defaultValue string) string {
+	return l.get(key, defaultValue, true)
+}
+
+func (l *loader) int(key string, defaultValue int) int {
+	value := l.get(key, strconv.Itoa(defaultValue), false)
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %q is not a whole number", key, value))
+		return defaultValue
+	}
+	return n
+}
+
+func (l *loader) bool(key string, defaultValue bool) bool {
+	value := l.get(key, strconv.FormatBool(defaultValue), false)
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %q is not true or false", key, value))
+		return defaultValue
+	}
+	return b
+}
+
+// list reads a comma-separated value
+func (l *loader) list(key string) []string {
+	var values []string
+	for _, value := range strings.Split(l.get(key, "", false), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// pairs reads a comma-separated list of key=value entries
+func (l *loader) pairs(key string) map[string]string {
+	values := l.list(key)
+	if len(values) == 0 {
+		return nil
+	}
+	pairs := make(map[string]string, len(values))
+	for _, value := range values {
+		k, v, ok := strings.Cut(value, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			l.errs = append(l.errs, fmt.Errorf("%s: %q is not key=value", key, value))
+			continue
+		}
+		pairs[k] = v
+	}
+	return pairs
+}
+
+// unknownKeys reports settings in the config files that nothing read, which
+// are most likely misspelt
+func (l *loader) unknownKeys() {
+	known := map[string]bool{}
+	for _, setting := range l.settings {
+		known[setting.Key] = true
+		known[setting.Key+"_FILE"] = true
+	}
+	for _, layer := range l.layers[1 : len(l.layers)-1] {
+		var unknown []string
+		for key := range layer.values {
+			if !known[key] {
+				unknown = append(unknown, key)
+			}
+		}
+		sort.Strings(unknown)
+		for _, key := range unknown {
+			l.errs = append(l.errs, fmt.Errorf("%s: unknown setting %s", layer.name, key))
+		}
+	}
+}
+
+// findConfigFiles returns the config file named by CONFIG_FILE, or config
+// with any supported extension in the working directory, followed by the
+// file for the profile next to it (config.prod.yaml for config.yaml). Only
+// an explicitly named file has to exist.
+func findConfigFiles(profile string) ([]string, error) {
+	base := os.Getenv("CONFIG_FILE")
+	if base != "" {
+		if _, err := os.Stat(base); err != nil {
+			return nil, fmt.Errorf("CONFIG_FILE: %w", err)
+		}
+	} else {
+		base = firstExisting("config")
+	}
+
+	dir := "."
+	if base != "" {
+		dir = filepath.Dir(base)
+	}
+	var files []string
+	if base != "" {
+		files = append(files, base)
+	}
+	if overlay := firstExisting(filepath.Join(dir, "config."+profile)); overlay != "" {
+		files = append(files, overlay)
+	}
+	return files, nil
+}
+
+// firstExisting returns stem with the first config extension that names an
+// existing file, or ""
+func firstExisting(stem string) string {
+	for _, ext := range configExtensions {
+		if _, err := os.Stat(stem + ext); err == nil {
+			return stem + ext
+		}
+	}
+	return ""
+}
+
+// readConfigFile parses a YAML or TOML config file. Nested keys are joined
+// with underscores and upper-cased, so "jwt: {secret: x}" and
+// "JWT_SECRET: x" both set JWT_SECRET; lists become comma-separated values.
+func readConfigFile(path string) (layer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return layer{}, err
+	}
+
+	var tree map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		err = errors.New("unsupported format: use .yaml, .yml or .toml")
+	}
+	if err != nil {
+		return layer{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	if err := flatten(values, "", tree); err != nil {
+		return layer{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return layer{name: path, values: values}, nil
+}
+
+func flatten(values map[string]string, prefix string, tree map[string]interface{}) error {
+	for key, value := range tree {
+		key = strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		switch v := value.(type) {
+		case nil:
+		case map[string]interface{}:
+			if err := flatten(values, key, v); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case string, bool, int, int64, uint64, float64:
+			values[key] = fmt.Sprint(v)
+		default:
+			return fmt.Errorf("%s: unsupported value %v", key, value)
+		}
+	}
+	return nil
+}
+
+// Print writes the settings the configuration was read from as a YAML config
+// file, each commented with its source. redacted hides the secrets.
+func (c *Config) Print(w io.Writer, redacted bool) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, setting := range c.settings {
+		value := setting.Value
+		if redacted && setting.Secret && value != "" {
+			value = "[REDACTED]"
+		}
+		doc.Content = append(doc.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: setting.Key},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, LineComment: setting.Source},
+		)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Enabled reports whether the server serves HTTPS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// Version returns the crypto/tls constant for MinVersion
+func (t TLSConfig) Version() (uint16, error) {
+	version, ok := tlsVersions[t.MinVersion]
+	if !ok {
+		return 0, fmt.Errorf("TLS_MIN_VERSION %q must be 1.2 or 1.3", t.MinVersion)
+	}
+	return version, nil
+}
+
+// CipherSuiteIDs returns the IDs of CipherSuites, or nil for Go's default
+// suites. Only suites crypto/tls considers secure are accepted.
+func (t TLSConfig) CipherSuiteIDs() ([]uint16, error) {
+	if len(t.CipherSuites) == 0 {
+		return nil, nil
+	}
+	byName := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		byName[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(t.CipherSuites))
+	for _, name := range t.CipherSuites {
+		id, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("TLS_CIPHER_SUITES: %q is not a supported secure cipher suite", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"newworld-project/logging"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minProdBcryptCost is the lowest password hashing cost the prod profile
+// accepts
+const minProdBcryptCost = 12
+
+// placeholderSecrets are published in env.example and docker-compose.yml
+var placeholderSecrets = map[string]bool{
+	defaultJWTSecret:  true,
+	defaultDBPassword: true,
+	"your_jwt_secret_key_here_make_it_long_and_secure": true,
+	"your_password": true,
+}
+
+// Validate reports settings that cannot work in any profile. In the prod
+// profile the unsafe settings listed by Warnings are errors too.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port >= 0 && port <= 65535, "SERVER_PORT %q is out of range", c.Server.Port)
+	check(c.Server.Listen == "" || c.Server.Listen == "systemd" || (strings.HasPrefix(c.Server.Listen, "unix:") && len(c.Server.Listen) > len("unix:")),
+		"SERVER_LISTEN %q must be empty, unix:<path> or systemd", c.Server.Listen)
+	check(!c.Server.AutoPort || c.Profile != ProfileProd, "SERVER_AUTO_PORT is for development and not allowed in prod")
+	check(c.Server.ReadTimeout >= 0 && c.Server.ReadHeaderTimeout >= 0 && c.Server.WriteTimeout >= 0 && c.Server.IdleTimeout >= 0,
+		"server timeouts cannot be negative")
+	check(c.Server.ShutdownTimeout > 0, "SERVER_SHUTDOWN_TIMEOUT must be positive")
+
+	if tlsCfg := c.Server.TLS; tlsCfg.Enabled() {
+		check(tlsCfg.CertFile != "" && tlsCfg.KeyFile != "", "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		check(tlsCfg.ReloadInterval >= 0, "TLS_RELOAD_INTERVAL cannot be negative")
+		if _, err := tlsCfg.Version(); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if _, err := tlsCfg.CipherSuiteIDs(); err != nil {
+			problems = append(problems, err.Error())
+		}
+		check(oneOf(tlsCfg.ClientAuth, "optional", "require"), "TLS_CLIENT_AUTH %q must be optional or require", tlsCfg.ClientAuth)
+	} else {
+		check(tlsCfg.ClientCAFile == "", "TLS_CLIENT_CA_FILE needs TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	check(len(c.Server.TLS.ClientIdentities) == 0 || c.Server.TLS.ClientCAFile != "", "TLS_CLIENT_IDENTITIES needs TLS_CLIENT_CA_FILE")
+
+	check(oneOf(c.Database.Type, "postgres", "sqlite"), "DB_TYPE %q must be postgres or sqlite", c.Database.Type)
+	check(oneOf(c.Database.Migrations, "auto", "check"), "DB_MIGRATIONS %q must be auto or check", c.Database.Migrations)
+
+	switch c.JWT.Algorithm {
+	case "HS256":
+		check(c.JWT.Secret != "", "JWT_SECRET must be set for HS256")
+	case "RS256", "ES256", "EdDSA":
+		check(c.JWT.SigningKeyFile != "", "JWT_SIGNING_KEY_FILE must be set for %s", c.JWT.Algorithm)
+	default:
+		check(false, "JWT_ALGORITHM %q must be HS256, RS256, ES256 or EdDSA", c.JWT.Algorithm)
+	}
+	check(c.JWT.AccessTokenExpiry > 0, "JWT_ACCESS_TOKEN_EXPIRY must be positive")
+	check(c.JWT.RefreshTokenExpiry > 0, "JWT_REFRESH_TOKEN_EXPIRY must be positive")
+	check(c.JWT.MFAChallengeExpiry > 0, "JWT_MFA_CHALLENGE_EXPIRY must be positive")
+
+	check(oneOf(c.Email.Transport, "smtp", "file", "log", "memory"), "EMAIL_TRANSPORT %q must be smtp, file, log or memory", c.Email.Transport)
+	// log and memory never deliver, so users could not verify or reset
+	check(c.Profile != ProfileProd || !oneOf(c.Email.Transport, "log", "memory"),
+		"EMAIL_TRANSPORT %q is for development and not allowed in prod, use smtp or file", c.Email.Transport)
+	check(c.Email.Port > 0 && c.Email.Port <= 65535, "SMTP_PORT %d is out of range", c.Email.Port)
+
+	check(c.Security.BcryptCost >= bcrypt.MinCost && c.Security.BcryptCost <= bcrypt.MaxCost,
+		"BCRYPT_COST %d must be between %d and %d", c.Security.BcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+	check(oneOf(c.Security.RateLimitStore, "memory", "database"), "RATE_LIMIT_STORE %q must be memory or database", c.Security.RateLimitStore)
+	check(c.Security.RateLimitWindow > 0, "RATE_LIMIT_WINDOW must be positive")
+
+	check(c.Scheduler.UnverifiedUserRetention > 0, "UNVERIFIED_USER_RETENTION_DAYS must be positive")
+	check(c.Scheduler.DeletedUserRetention > 0, "DELETED_USER_RETENTION_DAYS must be positive")
+
+	_, err = logging.ParseLevel(c.Log.Level)
+	check(err == nil, "LOG_LEVEL %q must be debug, info, warn or error", c.Log.Level)
+	check(oneOf(c.Log.Format, "json", "text"), "LOG_FORMAT %q must be json or text", c.Log.Format)
+	for subsystem, level := range c.Log.Levels {
+		check(logging.IsSubsystem(subsystem), "LOG_LEVELS: unknown subsystem %q, must be one of %s", subsystem, strings.Join(logging.Subsystems, ", "))
+		_, err := logging.ParseLevel(level)
+		check(err == nil, "LOG_LEVELS: level %q for %s must be debug, info, warn or error", level, subsystem)
+	}
+
+	if c.Metrics.Enabled && c.Metrics.Listen != "" {
+		_, metricsPort, err := net.SplitHostPort(c.Metrics.Listen)
+		port, _ := strconv.Atoi(metricsPort)
+		check(err == nil && port > 0 && port <= 65535, "METRICS_LISTEN %q must be host:port", c.Metrics.Listen)
+	}
+
+	if c.Profile == ProfileProd {
+		problems = append(problems, c.Warnings()...)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration (profile %s):\n  %s", c.Profile, strings.Join(problems, "\n  "))
+}
+
+// Warnings lists settings that are fine for development but unsafe in
+// production: built-in or published secrets, a weak password hashing cost,
+// no sender address and the unauthenticated template preview
+func (c *Config) Warnings() []string {
+	var warnings []string
+	if c.JWT.Algorithm == "HS256" && (placeholderSecrets[c.JWT.Secret] || len(c.JWT.Secret) < 32) {
+		warnings = append(warnings, "JWT_SECRET is a default value or shorter than 32 characters")
+	}
+	if c.Database.Type == "postgres" && (c.Database.Password == "" || placeholderSecrets[c.Database.Password]) {
+		warnings = append(warnings, "DB_PASSWORD is empty or a default value")
+	}
+	if c.Security.BcryptCost < minProdBcryptCost {
+		warnings = append(warnings, fmt.Sprintf("BCRYPT_COST %d is below %d", c.Security.BcryptCost, minProdBcryptCost))
+	}
+	if c.Email.Transport == "smtp" && c.Email.From == "" {
+		warnings = append(warnings, "EMAIL_FROM is empty")
+	}
+	if c.Email.TemplatePreview {
+		warnings = append(warnings, "EMAIL_TEMPLATE_PREVIEW serves email previews without authentication")
+	}
+	return warnings
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
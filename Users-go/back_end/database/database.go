@@ -2,79 +2,96 @@ package database
 
 import (
 	"fmt"
-	"log"
-	"newworld-project/config"
-	"newworld-project/models"
 	"os"
 
+	"newworld-project/config"
+	"newworld-project/logging"
+
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-var DB *gorm.DB
+// ConnectDB opens the configured database, brings its schema up to date
+// according to DB_MIGRATIONS and seeds the built-in roles
+func ConnectDB(cfg *config.Config) *gorm.DB {
+	logger := logging.Logger(logging.DB)
+	fatal := func(msg string, args ...any) {
+		logger.Error(msg, args...)
+		os.Exit(1)
+	}
 
-func ConnectDB() {
-	dbType := os.Getenv("DB_TYPE")
-	
-	var err error
-	
-	if dbType == "sqlite" {
-		// Use SQLite for development/testing
-		dbName := os.Getenv("DB_NAME")
-		if dbName == "" {
-			dbName = "newworld.db"
+	db, err := Open(cfg.Database)
+	if err != nil {
+		fatal("Failed to connect to database", "error", err)
+	}
+
+	// Bring the schema up to date, or refuse to serve an outdated one
+	switch mode := cfg.Database.Migrations; mode {
+	case "auto":
+		applied, err := MigrateUp(db)
+		if err != nil {
+			fatal("Failed to migrate database", "error", err)
 		}
-		
-		DB, err = gorm.Open(sqlite.Open(dbName), &gorm.Config{
-			Logger: logger.Default.LogMode(logger.Info),
-		})
-		
+		for _, migration := range applied {
+			logger.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+		}
+	case "check":
+		pending, err := PendingMigrations(db)
 		if err != nil {
-			log.Fatal("Failed to connect to SQLite database:", err)
+			fatal("Failed to check database migrations", "error", err)
+		}
+		if len(pending) > 0 {
+			fatal("Database has pending migrations; run \"migrate up\" first",
+				"pending", len(pending), "version", pending[0].Version, "name", pending[0].Name)
 		}
-		
-		log.Println("SQLite database connected successfully")
-	} else {
-		// Use PostgreSQL
-		cfg := config.ConfigInstance.Database
-		
-		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=Asia/Shanghai",
-			cfg.Host,
-			cfg.User,
-			cfg.Password,
-			cfg.Name,
-			cfg.Port,
-			cfg.SSLMode,
-		)
-
-		DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-			Logger: logger.Default.LogMode(logger.Info),
+	default:
+		fatal("Invalid DB_MIGRATIONS: must be auto or check", "mode", mode)
+	}
+
+	if err := SeedRBAC(db); err != nil {
+		fatal("Failed to seed roles and permissions", "error", err)
+	}
+
+	logger.Info("Database schema is up to date")
+	return db
+}
+
+// Open connects to the configured database without touching its schema
+func Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	if cfg.Type == "sqlite" {
+		// Use SQLite for development/testing
+		db, err := gorm.Open(sqlite.Open(cfg.Name), &gorm.Config{
+			Logger: Logger(),
 		})
 
 		if err != nil {
-			log.Fatal("Failed to connect to PostgreSQL database:", err)
+			return nil, fmt.Errorf("failed to connect to SQLite database: %w", err)
 		}
-		
-		log.Println("PostgreSQL database connected successfully")
+
+		logging.Logger(logging.DB).Info("SQLite database connected successfully")
+		return db, nil
 	}
 
-	// Auto migrate the schema
-	err = DB.AutoMigrate(
-		&models.User{},
-		&models.TokenBlacklist{},
-		&models.EmailVerificationToken{},
-		&models.PasswordResetToken{},
+	// Use PostgreSQL
+
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=Asia/Shanghai",
+		cfg.Host,
+		cfg.User,
+		cfg.Password,
+		cfg.Name,
+		cfg.Port,
+		cfg.SSLMode,
 	)
 
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger: Logger(),
+	})
+
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		return nil, fmt.Errorf("failed to connect to PostgreSQL database: %w", err)
 	}
 
-	log.Println("Database migrated successfully")
+	logging.Logger(logging.DB).Info("PostgreSQL database connected successfully")
+	return db, nil
 }
-
-func GetDB() *gorm.DB {
-	return DB
-} 
\ No newline at end of file
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"newworld-project/logging"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// slowQueryThreshold is how long a query may take before it is logged as a
+// warning
+const slowQueryThreshold = 200 * time.Millisecond
+
+// gormLogger writes GORM's logs to the db subsystem logger: failed queries
+// as errors, slow ones as warnings and every other statement at debug level.
+// Statements are logged with placeholders instead of their parameters, so
+// password hashes and tokens never reach the log.
+type gormLogger struct {
+	logger *slog.Logger
+}
+
+// Logger returns the GORM logger that logs through the db subsystem
+func Logger() logger.Interface {
+	return gormLogger{logger: logging.Logger(logging.DB)}
+}
+
+// LogMode is a no-op; the db subsystem's level decides what is logged
+func (l gormLogger) LogMode(logger.LogLevel) logger.Interface {
+	return l
+}
+
+func (l gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (l gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (l gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (l gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	level, msg := slog.LevelDebug, "Query"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, msg = slog.LevelError, "Query failed"
+	case elapsed > slowQueryThreshold:
+		level, msg = slog.LevelWarn, "Slow query"
+	}
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []any{"sql", sql, "rows", rows, "duration", elapsed}
+	if level == slog.LevelError {
+		attrs = append(attrs, "error", err)
+	}
+	l.logger.Log(ctx, level, msg, attrs...)
+}
+
+// ParamsFilter drops the parameters GORM would otherwise inline into the
+// logged statement
+func (l gormLogger) ParamsFilter(_ context.Context, sql string, _ ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"newworld-project/logging"
+	"newworld-project/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestLoggerOmitsQueryParameters(t *testing.T) {
+	var logs bytes.Buffer
+	if err := logging.Setup(&logs, logging.Options{Level: "info", Format: "json", Levels: map[string]string{logging.DB: "debug"}}); err != nil {
+		t.Fatal(err)
+	}
+	defer logging.Setup(os.Stderr, logging.Options{Level: "info", Format: "text"})
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=private"), &gorm.Config{Logger: Logger()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "$2a$12$secrethash", Role: "user", Status: "active"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	db.Where("email = ?", "nobody@example.com").First(&models.User{})
+	db.Exec("SELECT * FROM missing_table WHERE token = ?", "tok-1")
+
+	out := logs.String()
+	if !strings.Contains(out, `INSERT INTO`) || !strings.Contains(out, `"level":"DEBUG"`) {
+		t.Errorf("statements not logged at debug level:\n%s", out)
+	}
+	for _, value := range []string{"secrethash", "alice@example.com", "nobody@example.com", "tok-1"} {
+		if strings.Contains(out, value) {
+			t.Errorf("parameter %q logged:\n%s", value, out)
+		}
+	}
+	if !strings.Contains(out, `"msg":"Query failed"`) || strings.Count(out, `"level":"ERROR"`) != 1 {
+		t.Errorf("want exactly the failed query as an error, not the missing record:\n%s", out)
+	}
+}
@@ -0,0 +1,292 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"newworld-project/utils"
+
+	"gorm.io/gorm"
+)
+
+// Migrations live in migrations/<dialect>/NNNN_name.up.sql and the matching
+// .down.sql. Both dialects must define the same versions.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationLockID serializes migrations between instances starting at the
+// same time against one PostgreSQL database
+const migrationLockID = 7305116
+
+// beforeUp holds the Go steps that run in a migration's transaction right
+// before its up script, for data changes a dialect cannot express in SQL
+var beforeUp = map[string]map[int]func(tx *gorm.DB) error{
+	"sqlite": {5: hashEmailTokens},
+}
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState reports whether a migration has been applied. Migrations
+// recorded in the database but unknown to this build have empty Up and Down.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a row of the schema_migrations table
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrations returns the embedded migrations for a dialect ordered by version
+func Migrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect %q", dialect)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || !strings.HasSuffix(name, ".sql") || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("unexpected migration file %s", name)
+		}
+		versionText, title, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionText)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration file %s must be named NNNN_name.%s.sql", name, direction)
+		}
+
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: title}
+			byVersion[version] = migration
+		} else if migration.Name != title {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, title)
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrationStatus lists every known or applied migration ordered by version
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, migration := range migrations {
+		state := MigrationState{Migration: migration}
+		if record, ok := applied[migration.Version]; ok {
+			state.AppliedAt = &record.AppliedAt
+			delete(applied, migration.Version)
+		}
+		states = append(states, state)
+	}
+	for _, record := range applied {
+		appliedAt := record.AppliedAt
+		states = append(states, MigrationState{
+			Migration: Migration{Version: record.Version, Name: record.Name},
+			AppliedAt: &appliedAt,
+		})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// PendingMigrations returns the migrations that have not been applied yet
+func PendingMigrations(db *gorm.DB) ([]Migration, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			pending = append(pending, state.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateUp applies every pending migration in order, each in its own
+// transaction, and returns the ones it applied
+func MigrateUp(db *gorm.DB) ([]Migration, error) {
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range pending {
+		ran, err := runMigration(db, migration, true)
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if ran {
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+// MigrateDown rolls back the latest steps applied migrations, newest first,
+// and returns the ones it rolled back
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var rolledBack []Migration
+	for i := len(states) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+		state := states[i]
+		if state.AppliedAt == nil {
+			continue
+		}
+		if state.Down == "" {
+			return rolledBack, fmt.Errorf("migration %04d_%s is not known to this build and cannot be rolled back", state.Version, state.Name)
+		}
+		ran, err := runMigration(db, state.Migration, false)
+		if err != nil {
+			return rolledBack, fmt.Errorf("rolling back %04d_%s: %w", state.Version, state.Name, err)
+		}
+		if ran {
+			rolledBack = append(rolledBack, state.Migration)
+		}
+	}
+	return rolledBack, nil
+}
+
+// runMigration applies or reverts one migration together with its
+// schema_migrations row. It reports false when another instance got there
+// first.
+func runMigration(db *gorm.DB, migration Migration, up bool) (bool, error) {
+	ran := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+				return err
+			}
+		}
+
+		var count int64
+		if err := tx.Model(&schemaMigration{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil {
+			return err
+		}
+		if up == (count > 0) {
+			return nil
+		}
+
+		if up {
+			if step := beforeUp[tx.Dialector.Name()][migration.Version]; step != nil {
+				if err := step(tx); err != nil {
+					return err
+				}
+			}
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			ran = true
+			return tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		}
+
+		if err := tx.Exec(migration.Down).Error; err != nil {
+			return err
+		}
+		ran = true
+		return tx.Where("version = ?", migration.Version).Delete(&schemaMigration{}).Error
+	})
+	return ran, err
+}
+
+// appliedMigrations reads schema_migrations, creating it on first use
+func appliedMigrations(db *gorm.DB) (map[int]schemaMigration, error) {
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`).Error; err != nil {
+		return nil, err
+	}
+
+	var records []schemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]schemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// hashEmailTokens replaces the plaintext email tokens with their digests in
+// place, so outstanding links keep working once 0005_hash_tokens renames the
+// column. SQLite has no SHA-256 function to do this in the script itself.
+func hashEmailTokens(tx *gorm.DB) error {
+	type row struct {
+		ID    uint
+		Token string
+	}
+
+	for _, table := range []string{"email_verification_tokens", "password_reset_tokens", "account_unlock_tokens"} {
+		var rows []row
+		if err := tx.Table(table).Select("id", "token").Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, r := range rows {
+			if err := tx.Table(table).Where("id = ?", r.ID).Update("token", utils.HashToken(r.Token)).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
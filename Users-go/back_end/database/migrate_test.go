@@ -0,0 +1,173 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"newworld-project/models"
+	"newworld-project/repository"
+	"newworld-project/utils"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=private"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestDialectsDefineSameMigrations(t *testing.T) {
+	names := func(dialect string) []string {
+		migrations, err := Migrations(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, migration := range migrations {
+			names = append(names, migration.Name)
+		}
+		return names
+	}
+
+	postgres, sqlite := names("postgres"), names("sqlite")
+	if len(sqlite) == 0 || !reflect.DeepEqual(postgres, sqlite) {
+		t.Errorf("postgres migrations %v, sqlite migrations %v", postgres, sqlite)
+	}
+}
+
+// The migrations must create every column GORM expects, so that models can
+// change only together with a new migration
+func TestMigrationsMatchModels(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, model := range []interface{}{
+		&models.User{},
+		&models.TokenBlacklist{},
+		&models.EmailVerificationToken{},
+		&models.PasswordResetToken{},
+		&models.RefreshTokenRecord{},
+		&models.Session{},
+		&models.RateLimitCounter{},
+		&models.AccountUnlockToken{},
+		&models.RecoveryCode{},
+		&models.PasskeyCredential{},
+		&models.WebAuthnSession{},
+		&models.AuditEvent{},
+		&models.Permission{},
+		&models.Role{},
+		&models.OutboxEmail{},
+		&models.ScheduledJob{},
+	} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		if !db.Migrator().HasTable(model) {
+			t.Errorf("table %s is missing", stmt.Schema.Table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !db.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("column %s.%s is missing", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+
+	if !db.Migrator().HasTable("role_permissions") {
+		t.Error("table role_permissions is missing")
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	db := openTestDB(t)
+
+	applied, err := MigrateUp(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := PendingMigrations(db); len(pending) != 0 {
+		t.Fatalf("pending after migrating up: %v", pending)
+	}
+	if again, _ := MigrateUp(db); len(again) != 0 {
+		t.Errorf("migrating up twice applied %d migrations", len(again))
+	}
+
+	// Roll back one step, then everything
+	if rolledBack, err := MigrateDown(db, 1); err != nil || len(rolledBack) != 1 || rolledBack[0].Version != applied[len(applied)-1].Version {
+		t.Fatalf("rolling back one step = %v, %v", rolledBack, err)
+	}
+	if _, err := MigrateDown(db, len(applied)); err != nil {
+		t.Fatal(err)
+	}
+	if db.Migrator().HasTable(&models.User{}) {
+		t.Error("users table survived rolling back every migration")
+	}
+	if pending, _ := PendingMigrations(db); len(pending) != len(applied) {
+		t.Errorf("pending after rolling back = %d, want %d", len(pending), len(applied))
+	}
+
+	if _, err := MigrateUp(db); err != nil {
+		t.Fatalf("migrating up after rolling back: %v", err)
+	}
+	if err := SeedRBAC(db); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Email tokens issued before 0005_hash_tokens are stored in plaintext and
+// must still be redeemable once the migration has replaced them by digests
+func TestHashTokensMigrationKeepsOutstandingTokens(t *testing.T) {
+	db := openTestDB(t)
+	applied, err := MigrateUp(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := 0
+	for _, migration := range applied {
+		if migration.Version >= 5 {
+			steps++
+		}
+	}
+	if _, err := MigrateDown(db, steps); err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	for _, table := range []string{"email_verification_tokens", "password_reset_tokens", "account_unlock_tokens"} {
+		if err := db.Exec("INSERT INTO "+table+" (user_id, token, expires_at, used) VALUES (1, ?, ?, false)", table+"-token", expiresAt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := repository.NewGormStore(db).Tokens()
+	verification, err := tokens.FindEmailVerification(utils.HashToken("email_verification_tokens-token"))
+	if err != nil {
+		t.Fatalf("verification token lost: %v", err)
+	}
+	if err := tokens.MarkEmailVerificationUsed(verification.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.FindEmailVerification(utils.HashToken("email_verification_tokens-token")); err == nil {
+		t.Error("verification token redeemed twice")
+	}
+	if _, err := tokens.FindPasswordReset(utils.HashToken("password_reset_tokens-token")); err != nil {
+		t.Errorf("password reset token lost: %v", err)
+	}
+	if _, err := tokens.FindAccountUnlock(utils.HashToken("account_unlock_tokens-token")); err != nil {
+		t.Errorf("account unlock token lost: %v", err)
+	}
+}
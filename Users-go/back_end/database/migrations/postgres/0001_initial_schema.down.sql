@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "password_reset_tokens";
+DROP TABLE IF EXISTS "email_verification_tokens";
+DROP TABLE IF EXISTS "token_blacklists";
+DROP TABLE IF EXISTS "users";
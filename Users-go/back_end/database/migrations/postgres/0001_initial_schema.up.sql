@@ -0,0 +1,54 @@
+-- Schema of the first release, created with IF NOT EXISTS so that databases
+-- built by GORM's AutoMigrate before versioned migrations are adopted as is.
+
+CREATE TABLE IF NOT EXISTS "users" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar(30) NOT NULL,
+  "email" text NOT NULL,
+  "password" text NOT NULL,
+  "first_name" varchar(50) NOT NULL,
+  "last_name" varchar(50) NOT NULL,
+  "phone" varchar(20),
+  "date_of_birth" timestamptz,
+  "bio" varchar(500),
+  "role" varchar(20) DEFAULT 'user',
+  "status" varchar(20) DEFAULT 'pending_verification',
+  "email_verified" boolean DEFAULT false,
+  "email_verified_at" timestamptz,
+  "last_login_at" timestamptz,
+  "password_changed_at" timestamptz,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz
+);
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_email" ON "users" ("email");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_username" ON "users" ("username");
+
+CREATE TABLE IF NOT EXISTS "token_blacklists" (
+  "id" bigserial PRIMARY KEY,
+  "token" text NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_token_blacklists_token" ON "token_blacklists" ("token");
+
+CREATE TABLE IF NOT EXISTS "email_verification_tokens" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "token" text NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "used" boolean DEFAULT false,
+  "created_at" timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_email_verification_tokens_token" ON "email_verification_tokens" ("token");
+
+CREATE TABLE IF NOT EXISTS "password_reset_tokens" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "token" text NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "used" boolean DEFAULT false,
+  "created_at" timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_password_reset_tokens_token" ON "password_reset_tokens" ("token");
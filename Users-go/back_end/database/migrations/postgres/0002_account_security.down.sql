@@ -0,0 +1,22 @@
+DROP TABLE IF EXISTS "role_permissions";
+DROP TABLE IF EXISTS "roles";
+DROP TABLE IF EXISTS "permissions";
+DROP TABLE IF EXISTS "audit_events";
+DROP TABLE IF EXISTS "web_authn_sessions";
+DROP TABLE IF EXISTS "passkey_credentials";
+DROP TABLE IF EXISTS "recovery_codes";
+DROP TABLE IF EXISTS "account_unlock_tokens";
+DROP TABLE IF EXISTS "rate_limit_counters";
+DROP TABLE IF EXISTS "sessions";
+DROP TABLE IF EXISTS "refresh_token_records";
+
+DROP INDEX IF EXISTS "idx_users_web_authn_handle";
+ALTER TABLE "users" DROP COLUMN "token_version";
+ALTER TABLE "users" DROP COLUMN "failed_logins";
+ALTER TABLE "users" DROP COLUMN "last_failed_login_at";
+ALTER TABLE "users" DROP COLUMN "locked_until";
+ALTER TABLE "users" DROP COLUMN "mfa_enabled";
+ALTER TABLE "users" DROP COLUMN "mfa_enabled_at";
+ALTER TABLE "users" DROP COLUMN "totp_secret";
+ALTER TABLE "users" DROP COLUMN "totp_last_counter";
+ALTER TABLE "users" DROP COLUMN "web_authn_handle";
@@ -0,0 +1,141 @@
+-- Lockout, two-factor authentication, passkeys, token versions, sessions,
+-- rate limiting, audit log and roles.
+
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "token_version" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "failed_logins" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "last_failed_login_at" timestamptz;
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "locked_until" timestamptz;
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "mfa_enabled" boolean DEFAULT false;
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "mfa_enabled_at" timestamptz;
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "totp_secret" varchar(64);
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "totp_last_counter" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "web_authn_handle" bytea;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_web_authn_handle" ON "users" ("web_authn_handle");
+
+CREATE TABLE IF NOT EXISTS "refresh_token_records" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "family_id" varchar(64) NOT NULL,
+  "token_id" varchar(64) NOT NULL,
+  "parent_id" bigint,
+  "expires_at" timestamptz NOT NULL,
+  "rotated_at" timestamptz,
+  "revoked_at" timestamptz,
+  "created_at" timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_refresh_token_records_token_id" ON "refresh_token_records" ("token_id");
+CREATE INDEX IF NOT EXISTS "idx_refresh_token_records_family_id" ON "refresh_token_records" ("family_id");
+CREATE INDEX IF NOT EXISTS "idx_refresh_token_records_user_id" ON "refresh_token_records" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "sessions" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "family_id" varchar(64) NOT NULL,
+  "user_agent" varchar(512),
+  "ip_address" varchar(45),
+  "last_used_at" timestamptz,
+  "expires_at" timestamptz NOT NULL,
+  "revoked_at" timestamptz,
+  "created_at" timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sessions_family_id" ON "sessions" ("family_id");
+CREATE INDEX IF NOT EXISTS "idx_sessions_user_id" ON "sessions" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "rate_limit_counters" (
+  "bucket" varchar(255) PRIMARY KEY,
+  "count" bigint NOT NULL,
+  "reset_at" timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS "idx_rate_limit_counters_reset_at" ON "rate_limit_counters" ("reset_at");
+
+CREATE TABLE IF NOT EXISTS "account_unlock_tokens" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "token" text NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "used" boolean DEFAULT false,
+  "created_at" timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_account_unlock_tokens_token" ON "account_unlock_tokens" ("token");
+
+CREATE TABLE IF NOT EXISTS "recovery_codes" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "code_hash" varchar(64) NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz
+);
+CREATE INDEX IF NOT EXISTS "idx_recovery_codes_user_id" ON "recovery_codes" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "passkey_credentials" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "name" varchar(100),
+  "credential_id" bytea NOT NULL,
+  "public_key" bytea NOT NULL,
+  "attestation_type" varchar(32),
+  "transports" varchar(100),
+  "aa_guid" bytea,
+  "sign_count" integer,
+  "backup_eligible" boolean,
+  "backup_state" boolean,
+  "clone_warning" boolean,
+  "last_used_at" timestamptz,
+  "created_at" timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_passkey_credentials_credential_id" ON "passkey_credentials" ("credential_id");
+CREATE INDEX IF NOT EXISTS "idx_passkey_credentials_user_id" ON "passkey_credentials" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "web_authn_sessions" (
+  "id" bigserial PRIMARY KEY,
+  "session_id" varchar(64) NOT NULL,
+  "user_id" bigint,
+  "ceremony" varchar(20) NOT NULL,
+  "data" text NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_web_authn_sessions_session_id" ON "web_authn_sessions" ("session_id");
+
+CREATE TABLE IF NOT EXISTS "audit_events" (
+  "id" bigserial PRIMARY KEY,
+  "actor_id" bigint,
+  "target_id" bigint,
+  "action" varchar(64) NOT NULL,
+  "outcome" varchar(16) NOT NULL,
+  "ip_address" varchar(45),
+  "user_agent" varchar(512),
+  "metadata" text,
+  "created_at" timestamptz
+);
+CREATE INDEX IF NOT EXISTS "idx_audit_events_created_at" ON "audit_events" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_audit_events_action" ON "audit_events" ("action");
+CREATE INDEX IF NOT EXISTS "idx_audit_events_target_id" ON "audit_events" ("target_id");
+CREATE INDEX IF NOT EXISTS "idx_audit_events_actor_id" ON "audit_events" ("actor_id");
+
+CREATE TABLE IF NOT EXISTS "permissions" (
+  "id" bigserial PRIMARY KEY,
+  "name" varchar(64) NOT NULL,
+  "description" varchar(255),
+  "created_at" timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_permissions_name" ON "permissions" ("name");
+
+CREATE TABLE IF NOT EXISTS "roles" (
+  "id" bigserial PRIMARY KEY,
+  "name" varchar(20) NOT NULL,
+  "description" varchar(255),
+  "parent_id" bigint,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  CONSTRAINT "fk_roles_parent" FOREIGN KEY ("parent_id") REFERENCES "roles" ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_roles_name" ON "roles" ("name");
+
+CREATE TABLE IF NOT EXISTS "role_permissions" (
+  "role_id" bigint,
+  "permission_id" bigint,
+  PRIMARY KEY ("role_id", "permission_id"),
+  CONSTRAINT "fk_role_permissions_role" FOREIGN KEY ("role_id") REFERENCES "roles" ("id"),
+  CONSTRAINT "fk_role_permissions_permission" FOREIGN KEY ("permission_id") REFERENCES "permissions" ("id")
+);
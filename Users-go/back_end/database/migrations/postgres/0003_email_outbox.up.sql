@@ -0,0 +1,16 @@
+-- Queue of outbound emails, sent by background workers with retries.
+
+CREATE TABLE IF NOT EXISTS "outbox_emails" (
+  "id" bigserial PRIMARY KEY,
+  "recipient" varchar(255) NOT NULL,
+  "subject" varchar(255) NOT NULL,
+  "html" text,
+  "status" varchar(16) NOT NULL,
+  "attempts" bigint NOT NULL DEFAULT 0,
+  "next_attempt_at" timestamptz NOT NULL,
+  "last_error" varchar(1024),
+  "sent_at" timestamptz,
+  "created_at" timestamptz,
+  "updated_at" timestamptz
+);
+CREATE INDEX IF NOT EXISTS "idx_outbox_emails_status_next_attempt_at" ON "outbox_emails" ("status", "next_attempt_at");
@@ -0,0 +1,5 @@
+-- Preferred email language of each user and the plain-text part of queued
+-- emails.
+
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "locale" varchar(16) NOT NULL DEFAULT '';
+ALTER TABLE "outbox_emails" ADD COLUMN IF NOT EXISTS "text" text;
@@ -0,0 +1,27 @@
+-- The plaintext tokens cannot be recovered from their digests, so every
+-- outstanding link stops working.
+
+DELETE FROM "token_blacklists";
+DROP INDEX IF EXISTS "idx_token_blacklists_expires_at";
+DROP INDEX IF EXISTS "idx_token_blacklists_token_id";
+ALTER TABLE "token_blacklists" DROP COLUMN "token_id";
+ALTER TABLE "token_blacklists" ADD COLUMN "token" text NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_token_blacklists_token" ON "token_blacklists" ("token");
+
+DELETE FROM "account_unlock_tokens";
+DROP INDEX IF EXISTS "idx_account_unlock_tokens_token_hash";
+ALTER TABLE "account_unlock_tokens" DROP COLUMN "token_hash";
+ALTER TABLE "account_unlock_tokens" ADD COLUMN "token" text NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_account_unlock_tokens_token" ON "account_unlock_tokens" ("token");
+
+DELETE FROM "password_reset_tokens";
+DROP INDEX IF EXISTS "idx_password_reset_tokens_token_hash";
+ALTER TABLE "password_reset_tokens" DROP COLUMN "token_hash";
+ALTER TABLE "password_reset_tokens" ADD COLUMN "token" text NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_password_reset_tokens_token" ON "password_reset_tokens" ("token");
+
+DELETE FROM "email_verification_tokens";
+DROP INDEX IF EXISTS "idx_email_verification_tokens_token_hash";
+ALTER TABLE "email_verification_tokens" DROP COLUMN "token_hash";
+ALTER TABLE "email_verification_tokens" ADD COLUMN "token" text NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_email_verification_tokens_token" ON "email_verification_tokens" ("token");
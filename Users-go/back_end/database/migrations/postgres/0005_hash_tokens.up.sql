@@ -0,0 +1,34 @@
+-- Store only the SHA-256 digest of the single-use tokens sent by email, and
+-- key the access token blacklist on the jti claim instead of the whole JWT.
+
+-- Outstanding tokens keep working: the links still carry the plaintext
+-- token, which now hashes to the stored digest.
+ALTER TABLE "email_verification_tokens" ADD COLUMN "token_hash" varchar(64);
+UPDATE "email_verification_tokens" SET "token_hash" = encode(sha256(convert_to("token", 'UTF8')), 'hex');
+ALTER TABLE "email_verification_tokens" ALTER COLUMN "token_hash" SET NOT NULL;
+DROP INDEX IF EXISTS "idx_email_verification_tokens_token";
+ALTER TABLE "email_verification_tokens" DROP COLUMN "token";
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_email_verification_tokens_token_hash" ON "email_verification_tokens" ("token_hash");
+
+ALTER TABLE "password_reset_tokens" ADD COLUMN "token_hash" varchar(64);
+UPDATE "password_reset_tokens" SET "token_hash" = encode(sha256(convert_to("token", 'UTF8')), 'hex');
+ALTER TABLE "password_reset_tokens" ALTER COLUMN "token_hash" SET NOT NULL;
+DROP INDEX IF EXISTS "idx_password_reset_tokens_token";
+ALTER TABLE "password_reset_tokens" DROP COLUMN "token";
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_password_reset_tokens_token_hash" ON "password_reset_tokens" ("token_hash");
+
+ALTER TABLE "account_unlock_tokens" ADD COLUMN "token_hash" varchar(64);
+UPDATE "account_unlock_tokens" SET "token_hash" = encode(sha256(convert_to("token", 'UTF8')), 'hex');
+ALTER TABLE "account_unlock_tokens" ALTER COLUMN "token_hash" SET NOT NULL;
+DROP INDEX IF EXISTS "idx_account_unlock_tokens_token";
+ALTER TABLE "account_unlock_tokens" DROP COLUMN "token";
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_account_unlock_tokens_token_hash" ON "account_unlock_tokens" ("token_hash");
+
+-- Every access token is bound to a session that logout revokes, so the
+-- blacklisted JWTs are redundant and are dropped rather than decoded.
+DELETE FROM "token_blacklists";
+DROP INDEX IF EXISTS "idx_token_blacklists_token";
+ALTER TABLE "token_blacklists" DROP COLUMN "token";
+ALTER TABLE "token_blacklists" ADD COLUMN "token_id" varchar(64) NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_token_blacklists_token_id" ON "token_blacklists" ("token_id");
+CREATE INDEX IF NOT EXISTS "idx_token_blacklists_expires_at" ON "token_blacklists" ("expires_at");
@@ -0,0 +1,14 @@
+-- Runs of the background jobs, shared by every instance so that each
+-- scheduled run happens once.
+
+CREATE TABLE IF NOT EXISTS "scheduled_jobs" (
+  "name" varchar(64) PRIMARY KEY,
+  "locked_by" varchar(255),
+  "locked_until" timestamptz,
+  "last_slot" timestamptz,
+  "last_started_at" timestamptz,
+  "last_finished_at" timestamptz,
+  "last_result" varchar(255),
+  "last_error" varchar(1024),
+  "updated_at" timestamptz
+);
@@ -0,0 +1,54 @@
+-- Schema of the first release, created with IF NOT EXISTS so that databases
+-- built by GORM's AutoMigrate before versioned migrations are adopted as is.
+
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `username` text NOT NULL,
+  `email` text NOT NULL,
+  `password` text NOT NULL,
+  `first_name` text NOT NULL,
+  `last_name` text NOT NULL,
+  `phone` text,
+  `date_of_birth` datetime,
+  `bio` text,
+  `role` text DEFAULT "user",
+  `status` text DEFAULT "pending_verification",
+  `email_verified` numeric DEFAULT false,
+  `email_verified_at` datetime,
+  `last_login_at` datetime,
+  `password_changed_at` datetime,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_users_deleted_at` ON `users`(`deleted_at`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_users_email` ON `users`(`email`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_users_username` ON `users`(`username`);
+
+CREATE TABLE IF NOT EXISTS `token_blacklists` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `token` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_token_blacklists_token` ON `token_blacklists`(`token`);
+
+CREATE TABLE IF NOT EXISTS `email_verification_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `token` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `used` numeric DEFAULT false,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_email_verification_tokens_token` ON `email_verification_tokens`(`token`);
+
+CREATE TABLE IF NOT EXISTS `password_reset_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `token` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `used` numeric DEFAULT false,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_password_reset_tokens_token` ON `password_reset_tokens`(`token`);
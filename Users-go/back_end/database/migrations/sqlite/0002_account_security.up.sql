@@ -0,0 +1,142 @@
+-- Lockout, two-factor authentication, passkeys, token versions, sessions,
+-- rate limiting, audit log and roles.
+
+ALTER TABLE `users` ADD COLUMN `token_version` integer NOT NULL DEFAULT 0;
+ALTER TABLE `users` ADD COLUMN `failed_logins` integer NOT NULL DEFAULT 0;
+ALTER TABLE `users` ADD COLUMN `last_failed_login_at` datetime;
+ALTER TABLE `users` ADD COLUMN `locked_until` datetime;
+ALTER TABLE `users` ADD COLUMN `mfa_enabled` numeric DEFAULT false;
+ALTER TABLE `users` ADD COLUMN `mfa_enabled_at` datetime;
+ALTER TABLE `users` ADD COLUMN `totp_secret` text;
+ALTER TABLE `users` ADD COLUMN `totp_last_counter` integer NOT NULL DEFAULT 0;
+ALTER TABLE `users` ADD COLUMN `web_authn_handle` blob;
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_users_web_authn_handle` ON `users`(`web_authn_handle`);
+
+CREATE TABLE IF NOT EXISTS `refresh_token_records` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `family_id` text NOT NULL,
+  `token_id` text NOT NULL,
+  `parent_id` integer,
+  `expires_at` datetime NOT NULL,
+  `rotated_at` datetime,
+  `revoked_at` datetime,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_refresh_token_records_token_id` ON `refresh_token_records`(`token_id`);
+CREATE INDEX IF NOT EXISTS `idx_refresh_token_records_family_id` ON `refresh_token_records`(`family_id`);
+CREATE INDEX IF NOT EXISTS `idx_refresh_token_records_user_id` ON `refresh_token_records`(`user_id`);
+
+CREATE TABLE IF NOT EXISTS `sessions` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `family_id` text NOT NULL,
+  `user_agent` text,
+  `ip_address` text,
+  `last_used_at` datetime,
+  `expires_at` datetime NOT NULL,
+  `revoked_at` datetime,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_sessions_family_id` ON `sessions`(`family_id`);
+CREATE INDEX IF NOT EXISTS `idx_sessions_user_id` ON `sessions`(`user_id`);
+
+CREATE TABLE IF NOT EXISTS `rate_limit_counters` (
+  `bucket` text,
+  `count` integer NOT NULL,
+  `reset_at` datetime NOT NULL,
+  PRIMARY KEY (`bucket`)
+);
+CREATE INDEX IF NOT EXISTS `idx_rate_limit_counters_reset_at` ON `rate_limit_counters`(`reset_at`);
+
+CREATE TABLE IF NOT EXISTS `account_unlock_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `token` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `used` numeric DEFAULT false,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_account_unlock_tokens_token` ON `account_unlock_tokens`(`token`);
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `code_hash` text NOT NULL,
+  `used_at` datetime,
+  `created_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_recovery_codes_user_id` ON `recovery_codes`(`user_id`);
+
+CREATE TABLE IF NOT EXISTS `passkey_credentials` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `name` text,
+  `credential_id` blob NOT NULL,
+  `public_key` blob NOT NULL,
+  `attestation_type` text,
+  `transports` text,
+  `aa_guid` blob,
+  `sign_count` integer,
+  `backup_eligible` numeric,
+  `backup_state` numeric,
+  `clone_warning` numeric,
+  `last_used_at` datetime,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_passkey_credentials_credential_id` ON `passkey_credentials`(`credential_id`);
+CREATE INDEX IF NOT EXISTS `idx_passkey_credentials_user_id` ON `passkey_credentials`(`user_id`);
+
+CREATE TABLE IF NOT EXISTS `web_authn_sessions` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `session_id` text NOT NULL,
+  `user_id` integer,
+  `ceremony` text NOT NULL,
+  `data` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_web_authn_sessions_session_id` ON `web_authn_sessions`(`session_id`);
+
+CREATE TABLE IF NOT EXISTS `audit_events` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `actor_id` integer,
+  `target_id` integer,
+  `action` text NOT NULL,
+  `outcome` text NOT NULL,
+  `ip_address` text,
+  `user_agent` text,
+  `metadata` text,
+  `created_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_audit_events_created_at` ON `audit_events`(`created_at`);
+CREATE INDEX IF NOT EXISTS `idx_audit_events_action` ON `audit_events`(`action`);
+CREATE INDEX IF NOT EXISTS `idx_audit_events_target_id` ON `audit_events`(`target_id`);
+CREATE INDEX IF NOT EXISTS `idx_audit_events_actor_id` ON `audit_events`(`actor_id`);
+
+CREATE TABLE IF NOT EXISTS `permissions` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `name` text NOT NULL,
+  `description` text,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_permissions_name` ON `permissions`(`name`);
+
+CREATE TABLE IF NOT EXISTS `roles` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `name` text NOT NULL,
+  `description` text,
+  `parent_id` integer,
+  `created_at` datetime,
+  `updated_at` datetime,
+  CONSTRAINT `fk_roles_parent` FOREIGN KEY (`parent_id`) REFERENCES `roles`(`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_roles_name` ON `roles`(`name`);
+
+CREATE TABLE IF NOT EXISTS `role_permissions` (
+  `role_id` integer,
+  `permission_id` integer,
+  PRIMARY KEY (`role_id`, `permission_id`),
+  CONSTRAINT `fk_role_permissions_role` FOREIGN KEY (`role_id`) REFERENCES `roles`(`id`),
+  CONSTRAINT `fk_role_permissions_permission` FOREIGN KEY (`permission_id`) REFERENCES `permissions`(`id`)
+);
@@ -0,0 +1,16 @@
+-- Queue of outbound emails, sent by background workers with retries.
+
+CREATE TABLE IF NOT EXISTS `outbox_emails` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `recipient` text NOT NULL,
+  `subject` text NOT NULL,
+  `html` text,
+  `status` text NOT NULL,
+  `attempts` integer NOT NULL DEFAULT 0,
+  `next_attempt_at` datetime NOT NULL,
+  `last_error` text,
+  `sent_at` datetime,
+  `created_at` datetime,
+  `updated_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_outbox_emails_status_next_attempt_at` ON `outbox_emails`(`status`, `next_attempt_at`);
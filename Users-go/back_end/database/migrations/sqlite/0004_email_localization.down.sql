@@ -0,0 +1,2 @@
+ALTER TABLE `outbox_emails` DROP COLUMN `text`;
+ALTER TABLE `users` DROP COLUMN `locale`;
@@ -0,0 +1,44 @@
+-- The plaintext tokens cannot be recovered from their digests, so every
+-- outstanding link stops working.
+
+DROP TABLE IF EXISTS `token_blacklists`;
+CREATE TABLE `token_blacklists` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `token` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_token_blacklists_token` ON `token_blacklists`(`token`);
+
+DROP TABLE IF EXISTS `account_unlock_tokens`;
+CREATE TABLE `account_unlock_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `token` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `used` numeric DEFAULT false,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_account_unlock_tokens_token` ON `account_unlock_tokens`(`token`);
+
+DROP TABLE IF EXISTS `password_reset_tokens`;
+CREATE TABLE `password_reset_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `token` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `used` numeric DEFAULT false,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_password_reset_tokens_token` ON `password_reset_tokens`(`token`);
+
+DROP TABLE IF EXISTS `email_verification_tokens`;
+CREATE TABLE `email_verification_tokens` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `token` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `used` numeric DEFAULT false,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_email_verification_tokens_token` ON `email_verification_tokens`(`token`);
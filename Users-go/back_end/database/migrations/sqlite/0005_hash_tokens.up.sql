@@ -0,0 +1,28 @@
+-- Store only the SHA-256 digest of the single-use tokens sent by email, and
+-- key the access token blacklist on the jti claim instead of the whole JWT.
+
+-- Outstanding tokens keep working: SQLite has no SHA-256 function, so the
+-- migration hashes them in Go before this script renames the column.
+ALTER TABLE `email_verification_tokens` RENAME COLUMN `token` TO `token_hash`;
+DROP INDEX IF EXISTS `idx_email_verification_tokens_token`;
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_email_verification_tokens_token_hash` ON `email_verification_tokens`(`token_hash`);
+
+ALTER TABLE `password_reset_tokens` RENAME COLUMN `token` TO `token_hash`;
+DROP INDEX IF EXISTS `idx_password_reset_tokens_token`;
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_password_reset_tokens_token_hash` ON `password_reset_tokens`(`token_hash`);
+
+ALTER TABLE `account_unlock_tokens` RENAME COLUMN `token` TO `token_hash`;
+DROP INDEX IF EXISTS `idx_account_unlock_tokens_token`;
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_account_unlock_tokens_token_hash` ON `account_unlock_tokens`(`token_hash`);
+
+-- Every access token is bound to a session that logout revokes, so the
+-- blacklisted JWTs are redundant and are dropped rather than decoded.
+DROP TABLE IF EXISTS `token_blacklists`;
+CREATE TABLE `token_blacklists` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `token_id` text NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_token_blacklists_token_id` ON `token_blacklists`(`token_id`);
+CREATE INDEX IF NOT EXISTS `idx_token_blacklists_expires_at` ON `token_blacklists`(`expires_at`);
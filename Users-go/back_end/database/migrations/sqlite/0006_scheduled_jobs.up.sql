@@ -0,0 +1,14 @@
+-- Runs of the background jobs, shared by every instance so that each
+-- scheduled run happens once.
+
+CREATE TABLE IF NOT EXISTS `scheduled_jobs` (
+  `name` text PRIMARY KEY,
+  `locked_by` text,
+  `locked_until` datetime,
+  `last_slot` datetime,
+  `last_started_at` datetime,
+  `last_finished_at` datetime,
+  `last_result` text,
+  `last_error` text,
+  `updated_at` datetime
+);
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"newworld-project/models"
+
+	"gorm.io/gorm"
+)
+
+// SeedRBAC creates the built-in roles and every permission the application
+// checks. Permissions that did not exist yet are granted to the admin role,
+// so admins keep full access as new permissions are introduced; changes made
+// to existing roles through the admin API are left alone.
+func SeedRBAC(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		userRole := models.Role{Name: models.RoleUser, Description: "Regular user"}
+		if err := tx.Where("name = ?", userRole.Name).FirstOrCreate(&userRole).Error; err != nil {
+			return err
+		}
+
+		adminRole := models.Role{Name: models.RoleAdmin, Description: "Administrator", ParentID: &userRole.ID}
+		if err := tx.Where("name = ?", adminRole.Name).FirstOrCreate(&adminRole).Error; err != nil {
+			return err
+		}
+
+		for name, description := range models.DefaultPermissions {
+			permission := models.Permission{Name: name, Description: description}
+			result := tx.Where("name = ?", name).FirstOrCreate(&permission)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			if err := tx.Model(&adminRole).Association("Permissions").Append(&permission); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
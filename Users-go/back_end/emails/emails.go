@@ -0,0 +1,316 @@
+// Package emails renders the transactional emails sent to users. Every email
+// has an html/template and a text/template version per locale, embedded in
+// the binary and replaceable file by file from a directory on disk.
+package emails
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/mailer"
+	"newworld-project/models"
+
+	"golang.org/x/text/language"
+)
+
+// Names of the email templates
+const (
+	VerifyEmail   = "verify_email"
+	PasswordReset = "password_reset"
+	AccountUnlock = "account_unlock"
+)
+
+// Names lists every email template
+var Names = []string{VerifyEmail, PasswordReset, AccountUnlock}
+
+//go:embed templates
+var embedded embed.FS
+
+// Data is what the templates are rendered with
+type Data struct {
+	AppName     string
+	Username    string
+	URL         string
+	LockedUntil time.Time
+}
+
+// view adds the values known only while rendering
+type view struct {
+	Data
+	Locale  string
+	Subject string
+}
+
+var funcs = map[string]interface{}{
+	"formatTime": func(t time.Time) string { return t.Format("2006-01-02 15:04 MST") },
+}
+
+type localized struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// Templates renders emails in the locales found in the template directories
+type Templates struct {
+	app           config.AppConfig
+	defaultLocale string
+
+	// locales lists the supported locales with the default first, in the
+	// order of the tags the matcher was built from
+	locales   []string
+	matcher   language.Matcher
+	templates map[string]map[string]localized
+}
+
+// New loads the embedded templates, with any file in cfg.Email.TemplateDir
+// taking the place of the embedded file of the same name. A locale directory
+// must contain every template.
+func New(cfg *config.Config) (*Templates, error) {
+	base, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+	files := base
+	if cfg.Email.TemplateDir != "" {
+		if _, err := os.Stat(cfg.Email.TemplateDir); err != nil {
+			return nil, fmt.Errorf("email template directory: %w", err)
+		}
+		files = overlayFS{upper: os.DirFS(cfg.Email.TemplateDir), lower: base}
+	}
+
+	defaultLocale := cfg.Email.DefaultLocale
+	if defaultLocale == "" {
+		defaultLocale = "en"
+	}
+
+	locales, err := findLocales(files, defaultLocale)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{
+		app:           cfg.App,
+		defaultLocale: defaultLocale,
+		locales:       locales,
+		templates:     map[string]map[string]localized{},
+	}
+
+	layout, err := fs.ReadFile(files, "layout.html")
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]language.Tag, len(locales))
+	for i, locale := range locales {
+		tags[i] = language.Make(locale)
+		t.templates[locale] = map[string]localized{}
+		for _, name := range Names {
+			tmpl, err := parse(files, string(layout), locale, name)
+			if err != nil {
+				return nil, err
+			}
+			t.templates[locale][name] = tmpl
+		}
+	}
+	t.matcher = language.NewMatcher(tags)
+
+	return t, nil
+}
+
+// findLocales lists the locale directories, with defaultLocale first
+func findLocales(files fs.FS, defaultLocale string) ([]string, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	locales := []string{defaultLocale}
+	found := false
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if entry.Name() == defaultLocale {
+			found = true
+			continue
+		}
+		if _, err := language.Parse(entry.Name()); err != nil {
+			return nil, fmt.Errorf("email template directory %q is not a language tag", entry.Name())
+		}
+		locales = append(locales, entry.Name())
+	}
+	if !found {
+		return nil, fmt.Errorf("no email templates for the default locale %q", defaultLocale)
+	}
+	sort.Strings(locales[1:])
+	return locales, nil
+}
+
+func parse(files fs.FS, layout, locale, name string) (localized, error) {
+	path := locale + "/" + name
+	htmlSource, err := fs.ReadFile(files, path+".html")
+	if err != nil {
+		return localized{}, fmt.Errorf("email template %s.html: %w", path, err)
+	}
+	textSource, err := fs.ReadFile(files, path+".txt")
+	if err != nil {
+		return localized{}, fmt.Errorf("email template %s.txt: %w", path, err)
+	}
+
+	html, err := htmltemplate.New("layout").Funcs(funcs).Parse(layout)
+	if err == nil {
+		_, err = html.Parse(string(htmlSource))
+	}
+	if err != nil {
+		return localized{}, fmt.Errorf("email template %s.html: %w", path, err)
+	}
+
+	text, err := texttemplate.New(name).Funcs(funcs).Parse(string(textSource))
+	if err != nil {
+		return localized{}, fmt.Errorf("email template %s.txt: %w", path, err)
+	}
+	if text.Lookup("subject") == nil {
+		return localized{}, fmt.Errorf("email template %s.txt does not define a subject", path)
+	}
+
+	return localized{html: html, text: text}, nil
+}
+
+// Locales returns the supported locales, the default first
+func (t *Templates) Locales() []string {
+	return append([]string(nil), t.locales...)
+}
+
+// MatchLocale returns the supported locale closest to preference, a language
+// tag or Accept-Language header value, or the default locale if none fits
+func (t *Templates) MatchLocale(preference string) string {
+	tags, _, err := language.ParseAcceptLanguage(preference)
+	if err != nil || len(tags) == 0 {
+		return t.defaultLocale
+	}
+	_, index, confidence := t.matcher.Match(tags...)
+	if confidence == language.No {
+		return t.defaultLocale
+	}
+	return t.locales[index]
+}
+
+// Render renders the subject and both bodies of an email in the supported
+// locale closest to locale. The recipient is left empty.
+func (t *Templates) Render(name, locale string, data Data) (mailer.Message, error) {
+	locale = t.MatchLocale(locale)
+	tmpl, ok := t.templates[locale][name]
+	if !ok {
+		return mailer.Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	v := view{Data: data, Locale: locale}
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", v); err != nil {
+		return mailer.Message{}, err
+	}
+	v.Subject = strings.TrimSpace(subject.String())
+	if err := tmpl.text.Execute(&text, v); err != nil {
+		return mailer.Message{}, err
+	}
+	if err := tmpl.html.Execute(&html, v); err != nil {
+		return mailer.Message{}, err
+	}
+
+	return mailer.Message{Subject: v.Subject, HTML: html.String(), Text: text.String()}, nil
+}
+
+// render fills in the application details and sends the email to user in
+// their locale
+func (t *Templates) render(name string, user *models.User, data Data) (mailer.Message, error) {
+	data.AppName = t.app.Name
+	data.Username = user.Username
+	msg, err := t.Render(name, user.Locale, data)
+	msg.To = user.Email
+	return msg, err
+}
+
+// Verification builds the email with the link that verifies a new account's
+// address
+func (t *Templates) Verification(user *models.User, token string) (mailer.Message, error) {
+	return t.render(VerifyEmail, user, Data{URL: t.app.FrontendURL + "/verify-email?token=" + token})
+}
+
+// PasswordReset builds the email with the password reset link
+func (t *Templates) PasswordReset(user *models.User, token string) (mailer.Message, error) {
+	return t.render(PasswordReset, user, Data{URL: t.app.FrontendURL + "/reset-password?token=" + token})
+}
+
+// AccountUnlock builds the email sent when an account is locked
+func (t *Templates) AccountUnlock(user *models.User, token string, lockedUntil time.Time) (mailer.Message, error) {
+	return t.render(AccountUnlock, user, Data{
+		URL:         t.app.FrontendURL + "/unlock-account?token=" + token,
+		LockedUntil: lockedUntil,
+	})
+}
+
+// Sample returns example data for previewing a template
+func (t *Templates) Sample() Data {
+	return Data{
+		AppName:     t.app.Name,
+		Username:    "alice",
+		URL:         t.app.FrontendURL + "/preview?token=preview-token",
+		LockedUntil: time.Now().Add(15 * time.Minute),
+	}
+}
+
+// PreferredLocale returns the language the client prefers most in an
+// Accept-Language header, or "" if it names none
+func PreferredLocale(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 || tags[0] == language.Und {
+		return ""
+	}
+	return tags[0].String()
+}
+
+// overlayFS serves files from upper, falling back to lower for files upper
+// does not have
+type overlayFS struct {
+	upper, lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	file, err := o.upper.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.lower.Open(name)
+	}
+	return file, err
+}
+
+// ReadDir merges the entries of both directories
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	lower, err := fs.ReadDir(o.lower, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	upper, err := fs.ReadDir(o.upper, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var entries []fs.DirEntry
+	for _, entry := range append(upper, lower...) {
+		if !seen[entry.Name()] {
+			seen[entry.Name()] = true
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
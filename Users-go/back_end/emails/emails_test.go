@@ -0,0 +1,152 @@
+package emails
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/models"
+)
+
+func testConfig(dir string) *config.Config {
+	return &config.Config{
+		Email: config.EmailConfig{TemplateDir: dir, DefaultLocale: "en"},
+		App:   config.AppConfig{Name: "NewWorld Project", FrontendURL: "http://localhost:3000"},
+	}
+}
+
+func TestRenderAllTemplates(t *testing.T) {
+	templates, err := New(testConfig(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locales := templates.Locales(); len(locales) != 2 || locales[0] != "en" || locales[1] != "zh" {
+		t.Fatalf("locales = %v, want [en zh]", locales)
+	}
+
+	for _, locale := range templates.Locales() {
+		for _, name := range Names {
+			msg, err := templates.Render(name, locale, templates.Sample())
+			if err != nil {
+				t.Errorf("%s/%s: %v", locale, name, err)
+				continue
+			}
+			if msg.Subject == "" || !strings.Contains(msg.HTML, `href="http://localhost:3000/preview?token=preview-token"`) || !strings.Contains(msg.Text, "http://localhost:3000/preview?token=preview-token") {
+				t.Errorf("%s/%s: incomplete message %+v", locale, name, msg)
+			}
+			if strings.Contains(msg.Text, "<p>") {
+				t.Errorf("%s/%s: HTML in the plain-text part", locale, name)
+			}
+		}
+	}
+}
+
+func TestEmailsAreLocalizedAndEscaped(t *testing.T) {
+	templates, err := New(testConfig(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &models.User{Username: "<b>mallory</b>", Email: "mallory@example.com", Locale: "zh-CN"}
+	msg, err := templates.Verification(user, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.To != "mallory@example.com" || msg.Subject != "验证您的邮箱 - NewWorld Project" {
+		t.Errorf("to %q, subject %q", msg.To, msg.Subject)
+	}
+	if strings.Contains(msg.HTML, "<b>mallory</b>") || !strings.Contains(msg.HTML, "&lt;b&gt;mallory&lt;/b&gt;") {
+		t.Error("username not escaped in the HTML part")
+	}
+	if !strings.Contains(msg.Text, "<b>mallory</b>") {
+		t.Error("plain-text part escaped")
+	}
+
+	user.Locale = ""
+	lockedUntil := time.Date(2030, 1, 2, 3, 4, 0, 0, time.UTC)
+	msg, err = templates.AccountUnlock(user, "abc", lockedUntil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Your Account Has Been Locked - NewWorld Project" || !strings.Contains(msg.Text, "2030-01-02 03:04 UTC") {
+		t.Errorf("subject %q, text %q", msg.Subject, msg.Text)
+	}
+}
+
+func TestMatchLocale(t *testing.T) {
+	templates, err := New(testConfig(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		preference string
+		want       string
+	}{
+		{"", "en"},
+		{"zh", "zh"},
+		{"zh-CN", "zh"},
+		{"zh-Hans-CN", "zh"},
+		{"en-GB", "en"},
+		{"fr-FR,zh;q=0.8,en;q=0.5", "zh"},
+		{"fr", "en"},
+		{"not a tag!", "en"},
+	}
+	for _, tt := range tests {
+		if got := templates.MatchLocale(tt.preference); got != tt.want {
+			t.Errorf("MatchLocale(%q) = %q, want %q", tt.preference, got, tt.want)
+		}
+	}
+
+	if got := PreferredLocale("fr-CH, fr;q=0.9, en;q=0.8"); got != "fr-CH" {
+		t.Errorf("PreferredLocale = %q, want fr-CH", got)
+	}
+}
+
+func TestTemplateDirOverridesEmbeddedFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Replacing a single file keeps the embedded versions of the others
+	write("en/verify_email.txt", `{{define "subject"}}Custom subject{{end}}Custom {{.URL}}`)
+	templates, err := New(testConfig(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := templates.Render(VerifyEmail, "en", templates.Sample())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Custom subject" || !strings.HasPrefix(msg.Text, "Custom http://") || !strings.Contains(msg.HTML, "Verify Email Address") {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	// A new locale must provide every template
+	write("de/verify_email.html", `{{define "body"}}Hallo{{end}}`)
+	write("de/verify_email.txt", `{{define "subject"}}Hallo{{end}}Hallo`)
+	if _, err := New(testConfig(dir)); err == nil {
+		t.Error("incomplete locale accepted")
+	}
+
+	// Templates that fail to parse are reported at startup
+	os.RemoveAll(filepath.Join(dir, "de"))
+	write("zh/password_reset.html", `{{define "body"}}{{.URL{{end}}`)
+	if _, err := New(testConfig(dir)); err == nil {
+		t.Error("invalid template accepted")
+	}
+
+	if _, err := New(testConfig(filepath.Join(dir, "missing"))); err == nil {
+		t.Error("missing template directory accepted")
+	}
+}
@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/emails"
+	"newworld-project/metrics"
+	"newworld-project/models"
+	"newworld-project/repository"
+	"newworld-project/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AdminHandler struct {
+	core
+}
+
+func NewAdminHandler(cfg *config.Config, store repository.Store, templates *emails.Templates) *AdminHandler {
+	return &AdminHandler{core{cfg: cfg, store: store, templates: templates}}
+}
+
+// ListUsers returns a filtered, sorted page of users
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	var req models.AdminUserQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = 20
+	}
+	if req.Sort == "" {
+		req.Sort = "created_at"
+	}
+	if req.Order == "" {
+		req.Order = "desc"
+	}
+
+	// Sort and Order are restricted to known values by validation
+	users, total, err := h.store.Users().List(repository.UserFilter{
+		Search:  req.Search,
+		Role:    req.Role,
+		Status:  req.Status,
+		Deleted: req.Deleted,
+		Sort:    req.Sort,
+		Order:   req.Order,
+		Offset:  (req.Page - 1) * req.PageSize,
+		Limit:   req.PageSize,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list users",
+		})
+		return
+	}
+
+	data := make([]gin.H, len(users))
+	for i, user := range users {
+		data[i] = adminUserResponse(user)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"users": data,
+			"pagination": gin.H{
+				"page":       req.Page,
+				"pageSize":   req.PageSize,
+				"total":      total,
+				"totalPages": int(math.Ceil(float64(total) / float64(req.PageSize))),
+			},
+		},
+	})
+}
+
+// GetUser returns a single user, including soft-deleted ones
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, ok := findAdminTarget(c, h.store.Users().FindByIDWithDeleted)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    adminUserResponse(*user),
+	})
+}
+
+// UpdateRole changes a user's role
+func (h *AdminHandler) UpdateRole(c *gin.Context) {
+	var req models.AdminUpdateRole
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return
+	}
+
+	user, ok := findAdminTarget(c, h.store.Users().FindByID)
+	if !ok || !notSelf(c, user, "change the role of") {
+		return
+	}
+
+	if _, err := h.store.Roles().FindByName(req.Role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Role does not exist",
+		})
+		return
+	}
+
+	previous := user.Role
+	if err := h.store.Users().Update(user.ID, map[string]interface{}{"role": req.Role}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update role",
+		})
+		return
+	}
+	user.Role = req.Role
+
+	h.recordAudit(c, "admin.user.role_change", &user.ID, models.AuditOutcomeSuccess, gin.H{
+		"from": previous,
+		"to":   req.Role,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Role updated successfully",
+		"data":    adminUserResponse(*user),
+	})
+}
+
+// UpdateStatus activates, suspends or bans a user. Suspending or banning
+// also signs the user out everywhere.
+func (h *AdminHandler) UpdateStatus(c *gin.Context) {
+	var req models.AdminUpdateStatus
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return
+	}
+
+	user, ok := findAdminTarget(c, h.store.Users().FindByID)
+	if !ok || !notSelf(c, user, "change the status of") {
+		return
+	}
+
+	previous := user.Status
+	err := h.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Users().Update(user.ID, map[string]interface{}{"status": req.Status}); err != nil {
+			return err
+		}
+		if req.Status != "active" {
+			return invalidateUserTokens(tx, user.ID, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update status",
+		})
+		return
+	}
+	user.Status = req.Status
+	if req.Status != "active" {
+		metrics.TokenRevocations.WithLabelValues("admin_status_change").Inc()
+	}
+
+	h.recordAudit(c, "admin.user.status_change", &user.ID, models.AuditOutcomeSuccess, gin.H{
+		"from":   previous,
+		"to":     req.Status,
+		"reason": req.Reason,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Status updated successfully",
+		"data":    adminUserResponse(*user),
+	})
+}
+
+// ForcePasswordReset discards the user's password, signs them out everywhere
+// and emails them a password reset link
+func (h *AdminHandler) ForcePasswordReset(c *gin.Context) {
+	user, ok := findAdminTarget(c, h.store.Users().FindByID)
+	if !ok {
+		return
+	}
+
+	// Replace the password with one nobody knows
+	hashedPassword, err := utils.HashPassword(utils.GenerateRandomString(32))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to process password reset",
+		})
+		return
+	}
+
+	token := utils.GeneratePasswordResetToken()
+	err = h.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Users().Update(user.ID, map[string]interface{}{"password": hashedPassword}); err != nil {
+			return err
+		}
+		if err := invalidateUserTokens(tx, user.ID, 0); err != nil {
+			return err
+		}
+		if err := tx.Tokens().CreatePasswordReset(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(24 * time.Hour),
+		}); err != nil {
+			return err
+		}
+		msg, err := h.templates.PasswordReset(user, token)
+		if err != nil {
+			return err
+		}
+		return queueEmail(tx, msg)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to process password reset",
+		})
+		return
+	}
+
+	metrics.TokenRevocations.WithLabelValues("admin_password_reset").Inc()
+
+	h.recordAudit(c, "admin.user.force_password_reset", &user.ID, models.AuditOutcomeSuccess, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Password reset enforced; a reset link has been sent to the user",
+	})
+}
+
+// ResendVerification sends a new email verification link
+func (h *AdminHandler) ResendVerification(c *gin.Context) {
+	user, ok := findAdminTarget(c, h.store.Users().FindByID)
+	if !ok {
+		return
+	}
+
+	if user.EmailVerified {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Email is already verified",
+		})
+		return
+	}
+
+	token := utils.GenerateEmailVerificationToken()
+	err := h.store.Transaction(func(tx repository.Store) error {
+		verificationToken := models.EmailVerificationToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(24 * time.Hour),
+		}
+		if err := tx.Tokens().CreateEmailVerification(&verificationToken); err != nil {
+			return err
+		}
+		msg, err := h.templates.Verification(user, token)
+		if err != nil {
+			return err
+		}
+		return queueEmail(tx, msg)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to create verification token",
+		})
+		return
+	}
+
+	h.recordAudit(c, "admin.user.resend_verification", &user.ID, models.AuditOutcomeSuccess, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Verification email sent",
+	})
+}
+
+// DeleteUser soft-deletes a user and signs them out everywhere
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	user, ok := findAdminTarget(c, h.store.Users().FindByID)
+	if !ok || !notSelf(c, user, "delete") {
+		return
+	}
+
+	err := h.store.Transaction(func(tx repository.Store) error {
+		if err := invalidateUserTokens(tx, user.ID, 0); err != nil {
+			return err
+		}
+		return tx.Users().Delete(user.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to delete user",
+		})
+		return
+	}
+
+	metrics.TokenRevocations.WithLabelValues("user_deleted").Inc()
+
+	h.recordAudit(c, "admin.user.delete", &user.ID, models.AuditOutcomeSuccess, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "User deleted successfully",
+	})
+}
+
+// RestoreUser undoes a soft delete
+func (h *AdminHandler) RestoreUser(c *gin.Context) {
+	user, ok := findAdminTarget(c, func(id uint) (*models.User, error) {
+		user, err := h.store.Users().FindByIDWithDeleted(id)
+		if err == nil && !user.DeletedAt.Valid {
+			return nil, repository.ErrNotFound
+		}
+		return user, err
+	})
+	if !ok {
+		return
+	}
+
+	if err := h.store.Users().Restore(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to restore user",
+		})
+		return
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+
+	h.recordAudit(c, "admin.user.restore", &user.ID, models.AuditOutcomeSuccess, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "User restored successfully",
+		"data":    adminUserResponse(*user),
+	})
+}
+
+// UnlockUser lifts a login lockout on behalf of a user
+func (h *AdminHandler) UnlockUser(c *gin.Context) {
+	user, ok := findAdminTarget(c, h.store.Users().FindByID)
+	if !ok {
+		return
+	}
+
+	if err := clearLockout(h.store.Users(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to unlock user",
+		})
+		return
+	}
+
+	h.recordAudit(c, "admin.user.unlock", &user.ID, models.AuditOutcomeSuccess, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "User unlocked successfully",
+	})
+}
+
+// findAdminTarget loads the user named by the :id parameter with find. It
+// writes the 404 response itself when the ID is not a number or there is no
+// such user.
+func findAdminTarget(c *gin.Context, find func(id uint) (*models.User, error)) (*models.User, bool) {
+	var user *models.User
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err == nil {
+		user, err = find(uint(id))
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return nil, false
+	}
+	return user, true
+}
+
+// notSelf refuses actions an admin must not perform on their own account so
+// they cannot lock themselves out
+func notSelf(c *gin.Context, user *models.User, action string) bool {
+	if userID, _ := c.Get("userID"); userID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "You cannot " + action + " your own account",
+		})
+		return false
+	}
+	return true
+}
+
+func adminUserResponse(user models.User) gin.H {
+	var deletedAt *time.Time
+	if user.DeletedAt.Valid {
+		deletedAt = &user.DeletedAt.Time
+	}
+
+	return gin.H{
+		"id":                user.ID,
+		"username":          user.Username,
+		"email":             user.Email,
+		"firstName":         user.FirstName,
+		"lastName":          user.LastName,
+		"role":              user.Role,
+		"status":            user.Status,
+		"emailVerified":     user.EmailVerified,
+		"mfaEnabled":        user.MFAEnabled,
+		"lockedUntil":       user.LockedUntil,
+		"lastLoginAt":       user.LastLoginAt,
+		"passwordChangedAt": user.PasswordChangedAt,
+		"createdAt":         user.CreatedAt,
+		"updatedAt":         user.UpdatedAt,
+		"deletedAt":         deletedAt,
+	}
+}
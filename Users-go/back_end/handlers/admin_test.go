@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"newworld-project/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupAdminTest(t *testing.T) (*gin.Engine, *testEnv) {
+	env := setupTestEnv(t)
+	admin := env.user
+	env.db.Model(admin).Update("role", "admin")
+
+	for _, name := range []string{"bob", "carol", "dave"} {
+		user := models.User{Username: name, Email: name + "@example.com", Password: "x", FirstName: name, LastName: "Test", Role: "user", Status: "active"}
+		if err := env.db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewAdminHandler(env.cfg, env.store, env.templates)
+	r := gin.New()
+	group := r.Group("/admin/users", func(c *gin.Context) {
+		c.Set("userID", admin.ID)
+		c.Next()
+	})
+	group.GET("", h.ListUsers)
+	group.GET("/:id", h.GetUser)
+	group.PUT("/:id/role", h.UpdateRole)
+	group.PUT("/:id/status", h.UpdateStatus)
+	group.DELETE("/:id", h.DeleteUser)
+	group.POST("/:id/restore", h.RestoreUser)
+
+	return r, env
+}
+
+func adminRequest(r *gin.Engine, method, path, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestAdminListUsers(t *testing.T) {
+	r, _ := setupAdminTest(t)
+
+	tests := []struct {
+		query     string
+		wantTotal float64
+		wantFirst string
+	}{
+		{"", 4, "dave"},
+		{"?sort=username&order=asc&pageSize=2", 4, "alice"},
+		{"?sort=username&order=asc&page=2&pageSize=2", 4, "carol"},
+		{"?search=CAR", 1, "carol"},
+		{"?search=%25", 0, ""},
+		{"?role=admin", 1, "alice"},
+	}
+
+	for _, tt := range tests {
+		code, response := adminRequest(r, http.MethodGet, "/admin/users"+tt.query, "")
+		if code != http.StatusOK {
+			t.Fatalf("GET %s = %d %v", tt.query, code, response)
+		}
+		data := response["data"].(map[string]interface{})
+		total := data["pagination"].(map[string]interface{})["total"]
+		users := data["users"].([]interface{})
+		if total != tt.wantTotal {
+			t.Errorf("GET %s total = %v, want %v", tt.query, total, tt.wantTotal)
+		}
+		if len(users) > 0 && users[0].(map[string]interface{})["username"] != tt.wantFirst {
+			t.Errorf("GET %s first user = %v, want %s", tt.query, users[0].(map[string]interface{})["username"], tt.wantFirst)
+		}
+	}
+
+	if code, _ := adminRequest(r, http.MethodGet, "/admin/users?sort=password", ""); code != http.StatusBadRequest {
+		t.Errorf("sorting by password = %d, want 400", code)
+	}
+}
+
+func TestAdminUserLifecycle(t *testing.T) {
+	r, env := setupAdminTest(t)
+	admin := env.user
+
+	if code, response := adminRequest(r, http.MethodPut, "/admin/users/2/status", `{"status":"banned","reason":"spam"}`); code != http.StatusOK {
+		t.Fatalf("ban = %d %v", code, response)
+	}
+	if code, _ := adminRequest(r, http.MethodDelete, "/admin/users/3", ""); code != http.StatusOK {
+		t.Fatalf("delete = %d", code)
+	}
+
+	code, response := adminRequest(r, http.MethodGet, "/admin/users?deleted=only", "")
+	users := response["data"].(map[string]interface{})["users"].([]interface{})
+	if code != http.StatusOK || len(users) != 1 || users[0].(map[string]interface{})["username"] != "carol" {
+		t.Errorf("deleted users = %d %v", code, users)
+	}
+
+	if code, _ := adminRequest(r, http.MethodPost, "/admin/users/3/restore", ""); code != http.StatusOK {
+		t.Fatalf("restore = %d", code)
+	}
+	if code, _ := adminRequest(r, http.MethodPost, "/admin/users/3/restore", ""); code != http.StatusNotFound {
+		t.Errorf("restoring an active user = %d, want 404", code)
+	}
+
+	// Admins cannot demote or delete themselves
+	if code, _ := adminRequest(r, http.MethodPut, "/admin/users/1/role", `{"role":"user"}`); code != http.StatusBadRequest {
+		t.Errorf("self demotion = %d, want 400", code)
+	}
+	if code, _ := adminRequest(r, http.MethodDelete, "/admin/users/1", ""); code != http.StatusBadRequest {
+		t.Errorf("self deletion = %d, want 400", code)
+	}
+
+	var events []models.AuditEvent
+	env.db.Order("id").Find(&events)
+	wantActions := []string{"admin.user.status_change", "admin.user.delete", "admin.user.restore"}
+	if len(events) != len(wantActions) {
+		t.Fatalf("audit events = %d, want %d", len(events), len(wantActions))
+	}
+	for i, event := range events {
+		if event.Action != wantActions[i] || event.ActorID == nil || *event.ActorID != admin.ID {
+			t.Errorf("audit event %d = %s by %v", i, event.Action, event.ActorID)
+		}
+	}
+	if events[0].Metadata != `{"from":"active","reason":"spam","to":"banned"}` {
+		t.Errorf("status change metadata = %s", events[0].Metadata)
+	}
+}
+
+func TestAdminRejectsNonNumericIDs(t *testing.T) {
+	r, _ := setupAdminTest(t)
+
+	// A non-numeric ID must not reach the query as a raw SQL condition
+	for _, path := range []string{"/admin/users/0%20OR%20username%20=%20'bob'", "/admin/users/bob", "/admin/users/-1"} {
+		if code, response := adminRequest(r, http.MethodGet, path, ""); code != http.StatusNotFound {
+			t.Errorf("GET %s = %d %v, want 404", path, code, response)
+		}
+	}
+	if code, _ := adminRequest(r, http.MethodPut, "/admin/users/0%20OR%201=1/status", `{"status":"banned"}`); code != http.StatusNotFound {
+		t.Errorf("status change with a crafted ID = %d, want 404", code)
+	}
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"newworld-project/config"
+	"newworld-project/middleware"
+	"newworld-project/models"
+	"newworld-project/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultAuditPageSize = 50
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type AuditHandler struct {
+	core
+}
+
+func NewAuditHandler(cfg *config.Config, store repository.Store) *AuditHandler {
+	return &AuditHandler{core{cfg: cfg, store: store}}
+}
+
+// ListEvents returns audit events matching the filters, newest first
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	var req models.AuditEventQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return
+	}
+
+	filter := repository.AuditFilter{
+		ActorID:   req.ActorID,
+		TargetID:  req.TargetID,
+		Outcome:   req.Outcome,
+		IPAddress: req.IPAddress,
+		From:      req.From,
+		To:        req.To,
+	}
+	if prefix, ok := strings.CutSuffix(req.Action, "*"); ok {
+		filter.ActionPrefix = prefix
+	} else {
+		filter.Action = req.Action
+	}
+
+	events, nextCursor, err := h.pageAuditEvents(filter, req.Cursor, req.Limit)
+	if errors.Is(err, errInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid cursor",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list audit events",
+		})
+		return
+	}
+
+	data := make([]gin.H, len(events))
+	for i, event := range events {
+		data[i] = auditEventResponse(event)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"events":     data,
+			"nextCursor": nextCursor,
+		},
+	})
+}
+
+// SecurityActivity returns the events concerning the current user's own
+// account, newest first
+func (h *AuditHandler) SecurityActivity(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req models.SecurityActivityQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return
+	}
+
+	filter := repository.AuditFilter{TargetID: userID.(uint)}
+	events, nextCursor, err := h.pageAuditEvents(filter, req.Cursor, req.Limit)
+	if errors.Is(err, errInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid cursor",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to load security activity",
+		})
+		return
+	}
+
+	data := make([]gin.H, len(events))
+	for i, event := range events {
+		// Only say whether someone else acted, not which administrator
+		data[i] = gin.H{
+			"id":        event.ID,
+			"action":    event.Action,
+			"outcome":   event.Outcome,
+			"ipAddress": event.IPAddress,
+			"userAgent": event.UserAgent,
+			"byAdmin":   event.ActorID != nil && *event.ActorID != userID.(uint),
+			"createdAt": event.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"events":     data,
+			"nextCursor": nextCursor,
+		},
+	})
+}
+
+// pageAuditEvents returns up to limit events matching filter older than the
+// cursor, and the cursor of the following page, which is empty on the last
+// page. Paging by ID keeps pages stable while new events are appended.
+func (h *AuditHandler) pageAuditEvents(filter repository.AuditFilter, cursor string, limit int) ([]models.AuditEvent, string, error) {
+	if limit == 0 {
+		limit = defaultAuditPageSize
+	}
+
+	beforeID, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	events, err := h.store.Audit().List(filter, beforeID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(events) > limit {
+		events = events[:limit]
+		nextCursor = encodeCursor(events[limit-1].ID)
+	}
+	return events, nextCursor, nil
+}
+
+// encodeCursor returns the opaque cursor of the page after the given ID
+func encodeCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10)))
+}
+
+// decodeCursor returns the ID a page starts below, or 0 without a cursor
+func decodeCursor(cursor string) (uint, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	id, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil || id == 0 {
+		return 0, errInvalidCursor
+	}
+	return uint(id), nil
+}
+
+func auditEventResponse(event models.AuditEvent) gin.H {
+	var metadata json.RawMessage
+	if event.Metadata != "" {
+		metadata = json.RawMessage(event.Metadata)
+	}
+
+	return gin.H{
+		"id":        event.ID,
+		"actorId":   event.ActorID,
+		"targetId":  event.TargetID,
+		"action":    event.Action,
+		"outcome":   event.Outcome,
+		"ipAddress": event.IPAddress,
+		"userAgent": event.UserAgent,
+		"metadata":  metadata,
+		"createdAt": event.CreatedAt,
+	}
+}
+
+// recordAudit appends an audit event for the current request. The actor is
+// the authenticated user, if any; a calling service is named in the
+// metadata. Failing to write the event is logged but
+// never fails the request.
+func (h *core) recordAudit(c *gin.Context, action string, targetID *uint, outcome string, metadata gin.H) {
+	var actorID *uint
+	if userID, exists := c.Get("userID"); exists {
+		id := userID.(uint)
+		actorID = &id
+	}
+	h.recordAuditAs(c, actorID, action, targetID, outcome, metadata)
+}
+
+// recordAuditAs is recordAudit with an explicit actor, for requests that
+// identify the user without authenticating them first, such as logins
+func (h *core) recordAuditAs(c *gin.Context, actorID *uint, action string, targetID *uint, outcome string, metadata gin.H) {
+	event := models.AuditEvent{
+		ActorID:   actorID,
+		TargetID:  targetID,
+		Action:    action,
+		Outcome:   outcome,
+		IPAddress: c.ClientIP(),
+		UserAgent: truncate(c.Request.UserAgent(), 512),
+	}
+
+	// Services authenticated by client certificate have no user ID
+	if service, exists := c.Get("service"); exists {
+		withService := gin.H{"service": service.(middleware.ServiceIdentity).Name}
+		for key, value := range metadata {
+			withService[key] = value
+		}
+		metadata = withService
+	}
+
+	if len(metadata) > 0 {
+		if data, err := json.Marshal(metadata); err == nil {
+			event.Metadata = string(data)
+		}
+	}
+
+	if err := h.store.Audit().Create(&event); err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to record audit event", "action", action, "error", err)
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"newworld-project/models"
+	"newworld-project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoginIsAudited(t *testing.T) {
+	env := setupTestEnv(t)
+	user := env.user
+	hashed, _ := utils.HashPassword("Password1!")
+	env.db.Model(user).Update("password", hashed)
+
+	r := gin.New()
+	r.POST("/auth/login", NewAuthHandler(env.cfg, env.store, env.tokens, env.templates).Login)
+	r.GET("/users/security-activity", func(c *gin.Context) {
+		c.Set("userID", user.ID)
+		c.Next()
+	}, NewAuditHandler(env.cfg, env.store).SecurityActivity)
+
+	doJSON(t, r, http.MethodPost, "/auth/login", gin.H{"username": "nobody", "password": "Password1!"})
+	doJSON(t, r, http.MethodPost, "/auth/login", gin.H{"username": "alice", "password": "wrong"})
+	if code, response := doJSON(t, r, http.MethodPost, "/auth/login", gin.H{"username": "alice", "password": "Password1!"}); code != http.StatusOK {
+		t.Fatalf("login = %d %v", code, response)
+	}
+
+	var events []models.AuditEvent
+	env.db.Order("id").Find(&events)
+	want := []struct {
+		outcome  string
+		targetID uint
+		metadata string
+	}{
+		{models.AuditOutcomeFailure, 0, `{"identifier":"nobody","method":"password","reason":"unknown_user"}`},
+		{models.AuditOutcomeFailure, user.ID, `{"method":"password","reason":"invalid_password"}`},
+		{models.AuditOutcomeSuccess, user.ID, `{"method":"password","sessionId":1}`},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("audit events = %d, want %d", len(events), len(want))
+	}
+	for i, event := range events {
+		var targetID uint
+		if event.TargetID != nil {
+			targetID = *event.TargetID
+		}
+		if event.Action != "auth.login" || event.Outcome != want[i].outcome || targetID != want[i].targetID || event.Metadata != want[i].metadata {
+			t.Errorf("event %d = %s %s target %d %s", i, event.Action, event.Outcome, targetID, event.Metadata)
+		}
+	}
+
+	// Only events about the user's own account are shown to them
+	code, response := doJSON(t, r, http.MethodGet, "/users/security-activity", nil)
+	activity := response["data"].(map[string]interface{})["events"].([]interface{})
+	if code != http.StatusOK || len(activity) != 2 || activity[0].(map[string]interface{})["outcome"] != models.AuditOutcomeSuccess {
+		t.Errorf("security activity = %d %v", code, activity)
+	}
+
+	if err := env.db.Model(&events[0]).Update("outcome", models.AuditOutcomeSuccess).Error; err == nil {
+		t.Error("audit event was updated")
+	}
+	if err := env.db.Delete(&events[0]).Error; err == nil {
+		t.Error("audit event was deleted")
+	}
+}
+
+func TestListAuditEvents(t *testing.T) {
+	env := setupTestEnv(t)
+	for _, action := range []string{"auth.login", "auth.logout", "admin.user.delete", "auth.login", "auth.login"} {
+		env.db.Create(&models.AuditEvent{Action: action, Outcome: models.AuditOutcomeSuccess})
+	}
+
+	r := gin.New()
+	r.GET("/admin/audit-events", NewAuditHandler(env.cfg, env.store).ListEvents)
+
+	// Walk the filtered events two at a time, newest first
+	var ids []interface{}
+	path := "/admin/audit-events?action=auth.*&limit=2"
+	for page := 0; page < 3; page++ {
+		code, response := doJSON(t, r, http.MethodGet, path, nil)
+		if code != http.StatusOK {
+			t.Fatalf("GET %s = %d %v", path, code, response)
+		}
+		data := response["data"].(map[string]interface{})
+		for _, event := range data["events"].([]interface{}) {
+			ids = append(ids, event.(map[string]interface{})["id"])
+		}
+		cursor := data["nextCursor"].(string)
+		if cursor == "" {
+			break
+		}
+		path = "/admin/audit-events?action=auth.*&limit=2&cursor=" + cursor
+	}
+	if len(ids) != 4 || ids[0] != float64(5) || ids[3] != float64(1) {
+		t.Errorf("paged event ids = %v", ids)
+	}
+
+	code, response := doJSON(t, r, http.MethodGet, "/admin/audit-events?action=auth.logout", nil)
+	if events := response["data"].(map[string]interface{})["events"].([]interface{}); code != http.StatusOK || len(events) != 1 {
+		t.Errorf("exact action filter = %d %v", code, events)
+	}
+	if code, _ := doJSON(t, r, http.MethodGet, "/admin/audit-events?cursor=!", nil); code != http.StatusBadRequest {
+		t.Errorf("invalid cursor = %d, want 400", code)
+	}
+}
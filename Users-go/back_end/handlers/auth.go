@@ -1,21 +1,27 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
-	"newworld-project/database"
+	"newworld-project/config"
+	"newworld-project/emails"
+	"newworld-project/metrics"
 	"newworld-project/models"
+	"newworld-project/repository"
 	"newworld-project/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-type AuthHandler struct{}
+type AuthHandler struct {
+	core
+}
 
-func NewAuthHandler() *AuthHandler {
-	return &AuthHandler{}
+func NewAuthHandler(cfg *config.Config, store repository.Store, tokens *utils.TokenService, templates *emails.Templates) *AuthHandler {
+	return &AuthHandler{core{cfg: cfg, store: store, tokens: tokens, templates: templates}}
 }
 
 // Register handles user registration
@@ -88,8 +94,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Check if email already exists
-	var existingEmail models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&existingEmail).Error; err == nil {
+	if _, err := h.store.Users().FindByEmail(req.Email); err == nil {
 		c.JSON(http.StatusConflict, gin.H{
 			"success": false,
 			"message": "Email already exists",
@@ -104,8 +109,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Check if username already exists
-	var existingUsername models.User
-	if err := database.DB.Where("username = ?", req.Username).First(&existingUsername).Error; err == nil {
+	if _, err := h.store.Users().FindByUsername(req.Username); err == nil {
 		c.JSON(http.StatusConflict, gin.H{
 			"success": false,
 			"message": "Username already exists",
@@ -181,6 +185,12 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		}
 	}
 
+	// Emails go out in the language asked for, or else the browser's
+	locale := req.Locale
+	if locale == "" {
+		locale = emails.PreferredLocale(c.GetHeader("Accept-Language"))
+	}
+
 	// Create user
 	user := models.User{
 		Username:    req.Username,
@@ -190,40 +200,43 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		LastName:    req.LastName,
 		Phone:       &req.Phone,
 		DateOfBirth: dateOfBirth,
+		Locale:      locale,
 		Role:        "user",
 		Status:      "active",
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "Failed to create user",
-		})
-		return
-	}
-
-	// Generate email verification token
+	// Create the user, its verification token and the verification email
+	// together, so no account is left without a way to verify it
 	token := utils.GenerateEmailVerificationToken()
-	expiresAt := time.Now().Add(24 * time.Hour)
+	err = h.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Users().Create(&user); err != nil {
+			return err
+		}
 
-	verificationToken := models.EmailVerificationToken{
-		UserID:    user.ID,
-		Token:     token,
-		ExpiresAt: expiresAt,
-	}
+		verificationToken := models.EmailVerificationToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(24 * time.Hour),
+		}
+		if err := tx.Tokens().CreateEmailVerification(&verificationToken); err != nil {
+			return err
+		}
 
-	if err := database.DB.Create(&verificationToken).Error; err != nil {
+		msg, err := h.templates.Verification(&user, token)
+		if err != nil {
+			return err
+		}
+		return queueEmail(tx, msg)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"message": "Failed to create verification token",
+			"message": "Failed to create user",
 		})
 		return
 	}
 
-	// Send verification email
-	go func() {
-		utils.SendVerificationEmail(user.Email, user.Username, token)
-	}()
+	h.recordAuditAs(c, &user.ID, "auth.register", &user.ID, models.AuditOutcomeSuccess, nil)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
@@ -249,13 +262,16 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	query := database.DB
-
+	var (
+		user *models.User
+		err  error
+	)
+	identifier := req.Username
 	if req.Username != "" {
-		query = query.Where("username = ?", req.Username)
+		user, err = h.store.Users().FindByUsername(req.Username)
 	} else if req.Email != "" {
-		query = query.Where("email = ?", req.Email)
+		user, err = h.store.Users().FindByEmail(req.Email)
+		identifier = req.Email
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -264,7 +280,25 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	if err := query.First(&user).Error; err != nil {
+	if err != nil {
+		metrics.Logins.WithLabelValues("password", models.AuditOutcomeFailure, "unknown_user").Inc()
+		h.recordAuditAs(c, nil, "auth.login", nil, models.AuditOutcomeFailure, gin.H{
+			"method":     "password",
+			"reason":     "unknown_user",
+			"identifier": identifier,
+		})
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "用户名或邮箱不存在或密码错误",
+		})
+		return
+	}
+
+	// A locked account answers like an unknown one, so that failing past
+	// the threshold does not reveal which usernames exist. The user learns
+	// of the lock from the unlock email.
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		h.recordLoginFailure(c, user, "password", "account_locked")
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"message": "用户名或邮箱不存在或密码错误",
@@ -273,6 +307,8 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	if !utils.CheckPassword(req.Password, user.Password) {
+		h.recordLoginFailure(c, user, "password", "invalid_password")
+		h.recordFailedLogin(user)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"message": "用户名或邮箱不存在或密码错误",
@@ -280,11 +316,50 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	now := time.Now()
-	database.DB.Model(&user).Update("last_login_at", now)
+	// Accounts with two-factor authentication get a challenge instead of tokens
+	if user.MFAEnabled {
+		h.respondMFAChallenge(c, user)
+		return
+	}
+
+	h.completeLogin(c, user, "password")
+}
+
+// recordLoginFailure audits a failed login attempt on a known account
+func (h *core) recordLoginFailure(c *gin.Context, user *models.User, method, reason string) {
+	metrics.Logins.WithLabelValues(method, models.AuditOutcomeFailure, reason).Inc()
+	h.recordAuditAs(c, nil, "auth.login", &user.ID, models.AuditOutcomeFailure, gin.H{
+		"method": method,
+		"reason": reason,
+	})
+}
+
+// completeLogin records a successful login by the given method and responds
+// with a new token pair
+func (h *core) completeLogin(c *gin.Context, user *models.User, method string) {
+	if user.Status == "suspended" || user.Status == "banned" {
+		h.recordLoginFailure(c, user, method, "account_"+user.Status)
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Account has been " + user.Status,
+		})
+		return
+	}
 
-	// Generate tokens
-	tokenPair, err := utils.GenerateTokenPair(user.ID, user.Username, user.Email, user.Role)
+	now := time.Now()
+	h.store.Users().Update(user.ID, map[string]interface{}{"last_login_at": now})
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		clearLockout(h.store.Users(), user.ID)
+	}
+
+	// Generate tokens within a new session
+	session := newSession(c, user)
+	var tokenPair *utils.TokenPair
+	err := h.store.Transaction(func(tx repository.Store) error {
+		var err error
+		tokenPair, err = issueTokenPair(h.tokens, tx, user, session, nil)
+		return err
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -292,6 +367,13 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		})
 		return
 	}
+	metrics.TokensIssued.WithLabelValues("login").Inc()
+	metrics.Logins.WithLabelValues(method, models.AuditOutcomeSuccess, "").Inc()
+
+	h.recordAuditAs(c, &user.ID, "auth.login", &user.ID, models.AuditOutcomeSuccess, gin.H{
+		"method":    method,
+		"sessionId": session.ID,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -324,8 +406,9 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	}
 
 	// Validate refresh token
-	claims, err := utils.ValidateToken(req.RefreshToken)
+	claims, err := h.tokens.ValidateRefreshToken(req.RefreshToken)
 	if err != nil {
+		metrics.TokenRefreshes.WithLabelValues("invalid").Inc()
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"message": "Invalid refresh token",
@@ -333,8 +416,28 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Generate new token pair
-	tokenPair, err := utils.GenerateTokenPair(claims.UserID, claims.Username, claims.Email, claims.Role)
+	// Rotate the refresh token, revoking its family on reuse
+	_, tokenPair, err := h.rotateRefreshToken(c, claims)
+	if errors.Is(err, errRefreshTokenReused) {
+		metrics.TokenRefreshes.WithLabelValues("reused").Inc()
+		metrics.TokenRevocations.WithLabelValues("refresh_token_reuse").Inc()
+		h.recordAuditAs(c, nil, "auth.refresh_token_reuse", &claims.UserID, models.AuditOutcomeFailure, gin.H{
+			"sessionId": claims.SessionID,
+		})
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Refresh token has already been used; please log in again",
+		})
+		return
+	}
+	if errors.Is(err, errRefreshTokenInvalid) {
+		metrics.TokenRefreshes.WithLabelValues("invalid").Inc()
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Invalid refresh token",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -342,6 +445,8 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		})
 		return
 	}
+	metrics.TokenRefreshes.WithLabelValues("success").Inc()
+	metrics.TokensIssued.WithLabelValues("refresh").Inc()
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -361,18 +466,27 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 
 		if len(tokenParts) == 2 {
 			// Blacklist the token
-			claims, err := utils.ValidateToken(tokenParts[1])
+			claims, err := h.tokens.ValidateAccessToken(tokenParts[1])
 			if err == nil {
 				expiresAt := time.Unix(claims.ExpiresAt.Unix(), 0)
-				blacklistedToken := models.TokenBlacklist{
-					Token:     tokenParts[1],
-					ExpiresAt: expiresAt,
-				}
-				database.DB.Create(&blacklistedToken)
+				h.store.Tokens().Blacklist(claims.ID, expiresAt)
 			}
 		}
 	}
 
+	// End the session, which also revokes its refresh tokens
+	session := currentSession(c)
+	if session.FamilyID != "" {
+		if err := h.store.Sessions().RevokeFamily(session.FamilyID, time.Now()); err == nil {
+			metrics.TokenRevocations.WithLabelValues("logout").Inc()
+		}
+	}
+
+	userID := c.GetUint("userID")
+	h.recordAudit(c, "auth.logout", &userID, models.AuditOutcomeSuccess, gin.H{
+		"sessionId": session.ID,
+	})
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Logout successful",
@@ -391,8 +505,11 @@ func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 	}
 
 	// Find verification token
-	var verificationToken models.EmailVerificationToken
-	if err := database.DB.Where("token = ? AND used = ? AND expires_at > ?", req.Token, false, time.Now()).First(&verificationToken).Error; err != nil {
+	verificationToken, err := h.store.Tokens().FindEmailVerification(utils.HashToken(req.Token))
+	if err != nil {
+		h.recordAuditAs(c, nil, "auth.email_verify", nil, models.AuditOutcomeFailure, gin.H{
+			"reason": "invalid_token",
+		})
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Invalid or expired verification token",
@@ -401,11 +518,11 @@ func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 	}
 
 	// Update user
-	if err := database.DB.Model(&models.User{}).Where("id = ?", verificationToken.UserID).Updates(map[string]interface{}{
-		"email_verified":     true,
-		"email_verified_at":  time.Now(),
+	if err := h.store.Users().Update(verificationToken.UserID, map[string]interface{}{
+		"email_verified":    true,
+		"email_verified_at": time.Now(),
 		"status":            "active",
-	}).Error; err != nil {
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": "Failed to verify email",
@@ -414,7 +531,9 @@ func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 	}
 
 	// Mark token as used
-	database.DB.Model(&verificationToken).Update("used", true)
+	h.store.Tokens().MarkEmailVerificationUsed(verificationToken.ID)
+
+	h.recordAuditAs(c, &verificationToken.UserID, "auth.email_verify", &verificationToken.UserID, models.AuditOutcomeSuccess, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -434,8 +553,8 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 	}
 
 	// Find user by email
-	var user models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+	user, err := h.store.Users().FindByEmail(req.Email)
+	if err != nil {
 		// Don't reveal if user exists or not
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -444,17 +563,25 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 		return
 	}
 
-	// Generate password reset token
+	// Generate password reset token and queue the email with it
 	token := utils.GeneratePasswordResetToken()
-	expiresAt := time.Now().Add(1 * time.Hour)
-
-	resetToken := models.PasswordResetToken{
-		UserID:    user.ID,
-		Token:     token,
-		ExpiresAt: expiresAt,
-	}
+	err = h.store.Transaction(func(tx repository.Store) error {
+		resetToken := models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(1 * time.Hour),
+		}
+		if err := tx.Tokens().CreatePasswordReset(&resetToken); err != nil {
+			return err
+		}
 
-	if err := database.DB.Create(&resetToken).Error; err != nil {
+		msg, err := h.templates.PasswordReset(user, token)
+		if err != nil {
+			return err
+		}
+		return queueEmail(tx, msg)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": "Failed to create reset token",
@@ -462,10 +589,7 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 		return
 	}
 
-	// Send password reset email
-	go func() {
-		utils.SendPasswordResetEmail(user.Email, user.Username, token)
-	}()
+	h.recordAuditAs(c, nil, "auth.password_reset_request", &user.ID, models.AuditOutcomeSuccess, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -494,8 +618,11 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 	}
 
 	// Find reset token
-	var resetToken models.PasswordResetToken
-	if err := database.DB.Where("token = ? AND used = ? AND expires_at > ?", req.Token, false, time.Now()).First(&resetToken).Error; err != nil {
+	resetToken, err := h.store.Tokens().FindPasswordReset(utils.HashToken(req.Token))
+	if err != nil {
+		h.recordAuditAs(c, nil, "auth.password_reset", nil, models.AuditOutcomeFailure, gin.H{
+			"reason": "invalid_token",
+		})
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Invalid or expired reset token",
@@ -513,23 +640,71 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// Update user password
-	if err := database.DB.Model(&models.User{}).Where("id = ?", resetToken.UserID).Updates(map[string]interface{}{
-		"password":           hashedPassword,
-		"password_changed_at": time.Now(),
-	}).Error; err != nil {
+	// Update user password and sign out everywhere
+	if err := h.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Users().Update(resetToken.UserID, map[string]interface{}{
+			"password":            hashedPassword,
+			"password_changed_at": time.Now(),
+		}); err != nil {
+			return err
+		}
+		return invalidateUserTokens(tx, resetToken.UserID, 0)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": "Failed to reset password",
 		})
 		return
 	}
+	metrics.TokenRevocations.WithLabelValues("password_reset").Inc()
 
 	// Mark token as used
-	database.DB.Model(&resetToken).Update("used", true)
+	h.store.Tokens().MarkPasswordResetUsed(resetToken.ID)
+
+	h.recordAuditAs(c, &resetToken.UserID, "auth.password_reset", &resetToken.UserID, models.AuditOutcomeSuccess, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Password reset successfully",
 	})
-} 
\ No newline at end of file
+}
+
+// UnlockAccount lifts a login lockout using the token from the unlock email
+func (h *AuthHandler) UnlockAccount(c *gin.Context) {
+	var req models.UnlockAccount
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+		})
+		return
+	}
+
+	// Find unlock token
+	unlockToken, err := h.store.Tokens().FindAccountUnlock(utils.HashToken(req.Token))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid or expired unlock token",
+		})
+		return
+	}
+
+	if err := clearLockout(h.store.Users(), unlockToken.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to unlock account",
+		})
+		return
+	}
+
+	// Mark token as used
+	h.store.Tokens().MarkAccountUnlockUsed(unlockToken.ID)
+
+	h.recordAuditAs(c, &unlockToken.UserID, "auth.account_unlock", &unlockToken.UserID, models.AuditOutcomeSuccess, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Account unlocked successfully",
+	})
+}
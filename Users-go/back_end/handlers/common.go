@@ -4,11 +4,32 @@ import (
 	"reflect"
 	"strings"
 
+	"newworld-project/config"
+	"newworld-project/emails"
+	"newworld-project/logging"
+	"newworld-project/repository"
+	"newworld-project/utils"
+
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
 )
 
+var logger = logging.Logger(logging.HTTP)
+
+// core holds the dependencies every handler shares and implements the login,
+// token and audit logic used across handlers
+type core struct {
+	cfg   *config.Config
+	store repository.Store
+
+	// tokens is only set on handlers that issue or validate tokens
+	tokens *utils.TokenService
+
+	// templates is only set on handlers that send email
+	templates *emails.Templates
+}
+
 // getValidationErrors converts validation errors to a structured format
 func getValidationErrors(err error) []gin.H {
 	var errors []gin.H
@@ -51,6 +72,8 @@ func getErrorMessage(tag, param string) string {
 		return "Please enter a valid phone number"
 	case "datetime":
 		return "Please enter a valid date"
+	case "bcp47_language_tag":
+		return "Please enter a valid language tag such as en or zh-CN"
 	default:
 		return "Invalid value"
 	}
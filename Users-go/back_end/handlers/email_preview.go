@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+
+	"newworld-project/config"
+	"newworld-project/emails"
+	"newworld-project/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EmailPreviewHandler renders the email templates with sample data so they
+// can be checked in a browser while they are edited. It is only routed when
+// EMAIL_TEMPLATE_PREVIEW is enabled.
+type EmailPreviewHandler struct {
+	core
+}
+
+func NewEmailPreviewHandler(cfg *config.Config, store repository.Store) *EmailPreviewHandler {
+	return &EmailPreviewHandler{core{cfg: cfg, store: store}}
+}
+
+// load reads the templates from disk on every request, so changes in
+// EMAIL_TEMPLATE_DIR show up without a restart
+func (h *EmailPreviewHandler) load(c *gin.Context) (*emails.Templates, bool) {
+	templates, err := emails.New(h.cfg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to load email templates",
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+	return templates, true
+}
+
+// ListTemplates lists the templates and the locales they can be previewed in
+func (h *EmailPreviewHandler) ListTemplates(c *gin.Context) {
+	templates, ok := h.load(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"templates": emails.Names,
+			"locales":   templates.Locales(),
+		},
+	})
+}
+
+// Preview renders one template. The locale query parameter picks the
+// language and format is html (the default), text or json for the subject
+// and both bodies.
+func (h *EmailPreviewHandler) Preview(c *gin.Context) {
+	name := c.Param("name")
+	known := false
+	for _, n := range emails.Names {
+		known = known || n == name
+	}
+	if !known {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Email template not found",
+		})
+		return
+	}
+
+	templates, ok := h.load(c)
+	if !ok {
+		return
+	}
+	msg, err := templates.Render(name, c.Query("locale"), templates.Sample())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to render email template",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	switch c.DefaultQuery("format", "html") {
+	case "html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(msg.HTML))
+	case "text":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(msg.Text))
+	case "json":
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": gin.H{
+				"locale":  templates.MatchLocale(c.Query("locale")),
+				"subject": msg.Subject,
+				"html":    msg.HTML,
+				"text":    msg.Text,
+			},
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "format must be html, text or json",
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEmailPreview(t *testing.T) {
+	env := setupTestEnv(t)
+	h := NewEmailPreviewHandler(env.cfg, env.store)
+	r := gin.New()
+	r.GET("/dev/emails", h.ListTemplates)
+	r.GET("/dev/emails/:name", h.Preview)
+
+	code, response := doJSON(t, r, http.MethodGet, "/dev/emails", nil)
+	if code != http.StatusOK || len(response["data"].(map[string]interface{})["templates"].([]interface{})) != 3 {
+		t.Fatalf("list = %d %v", code, response)
+	}
+
+	code, response = doJSON(t, r, http.MethodGet, "/dev/emails/password_reset?locale=zh-TW&format=json", nil)
+	data, _ := response["data"].(map[string]interface{})
+	if code != http.StatusOK || data["locale"] != "zh" || !strings.HasPrefix(data["subject"].(string), "重置您的密码") {
+		t.Fatalf("json preview = %d %v", code, response)
+	}
+
+	tests := []struct {
+		path        string
+		want        int
+		contentType string
+		contains    string
+	}{
+		{"/dev/emails/verify_email", http.StatusOK, "text/html; charset=utf-8", "<a href="},
+		{"/dev/emails/account_unlock?format=text", http.StatusOK, "text/plain; charset=utf-8", "preview-token"},
+		{"/dev/emails/welcome", http.StatusNotFound, "application/json; charset=utf-8", "Email template not found"},
+		{"/dev/emails/verify_email?format=pdf", http.StatusBadRequest, "application/json; charset=utf-8", "format must be"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.want || w.Header().Get("Content-Type") != tt.contentType || !strings.Contains(w.Body.String(), tt.contains) {
+			t.Errorf("GET %s = %d %s %q", tt.path, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
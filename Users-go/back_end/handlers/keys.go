@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"newworld-project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KeysHandler struct {
+	tokens *utils.TokenService
+}
+
+func NewKeysHandler(tokens *utils.TokenService) *KeysHandler {
+	return &KeysHandler{tokens: tokens}
+}
+
+// JWKS publishes the public keys that access and refresh tokens can be
+// verified with, so that other services never need the signing key.
+func (h *KeysHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.tokens.JWKS())
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/models"
+	"newworld-project/repository"
+	"newworld-project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lockoutDuration returns how long an account stays locked after the given
+// number of consecutive failed logins, or 0 below the threshold. Each failure
+// past the threshold doubles the lock up to the configured maximum.
+func lockoutDuration(cfg config.SecurityConfig, failures int) time.Duration {
+	if cfg.LockoutThreshold <= 0 || failures < cfg.LockoutThreshold {
+		return 0
+	}
+
+	duration := time.Duration(cfg.LockoutDuration) * time.Second
+	maxDuration := time.Duration(cfg.LockoutMaxDuration) * time.Second
+	for i := cfg.LockoutThreshold; i < failures && duration < maxDuration; i++ {
+		duration *= 2
+	}
+	if duration > maxDuration {
+		duration = maxDuration
+	}
+
+	return duration
+}
+
+// recordFailedLogin counts a failed login against the user and locks the
+// account once the threshold is reached. It returns the lock expiry, or nil
+// if the account is not locked.
+func (h *core) recordFailedLogin(user *models.User) (*time.Time, error) {
+	now := time.Now()
+	security := h.cfg.Security
+
+	// Failures older than the longest possible lock no longer count
+	maxDuration := time.Duration(security.LockoutMaxDuration) * time.Second
+	restart := user.LastFailedLoginAt != nil && now.Sub(*user.LastFailedLoginAt) > maxDuration
+
+	failures, err := h.store.Users().RecordFailedLogin(user.ID, now, restart)
+	if err != nil {
+		return nil, err
+	}
+	user.FailedLogins = failures
+
+	duration := lockoutDuration(security, failures)
+	if duration == 0 {
+		return nil, nil
+	}
+
+	lockedUntil := now.Add(duration)
+	if err := h.store.Users().Update(user.ID, map[string]interface{}{"locked_until": lockedUntil}); err != nil {
+		return nil, err
+	}
+
+	// Offer an unlock link the first time the account locks
+	if failures == security.LockoutThreshold {
+		h.sendAccountUnlockEmail(user, lockedUntil)
+	}
+
+	return &lockedUntil, nil
+}
+
+func (h *core) sendAccountUnlockEmail(user *models.User, lockedUntil time.Time) {
+	token := utils.GenerateAccountUnlockToken()
+	err := h.store.Transaction(func(tx repository.Store) error {
+		unlockToken := models.AccountUnlockToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(24 * time.Hour),
+		}
+		if err := tx.Tokens().CreateAccountUnlock(&unlockToken); err != nil {
+			return err
+		}
+
+		msg, err := h.templates.AccountUnlock(user, token, lockedUntil)
+		if err != nil {
+			return err
+		}
+		return queueEmail(tx, msg)
+	})
+	if err != nil {
+		logger.Error("Failed to queue account unlock email", "user_id", user.ID, "error", err)
+	}
+}
+
+// clearLockout resets the failed login counter and lifts any lock.
+func clearLockout(users repository.UserRepository, userID uint) error {
+	return users.Update(userID, map[string]interface{}{
+		"failed_logins":        0,
+		"last_failed_login_at": nil,
+		"locked_until":         nil,
+	})
+}
+
+func respondAccountLocked(c *gin.Context, lockedUntil time.Time) {
+	retryAfter := int(time.Until(lockedUntil).Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusLocked, gin.H{
+		"success": false,
+		"message": "账户因多次登录失败已被临时锁定，请稍后再试或通过邮件解锁",
+		"data": gin.H{
+			"lockedUntil": lockedUntil,
+		},
+	})
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/emails"
+	"newworld-project/models"
+	"newworld-project/repository"
+	"newworld-project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const recoveryCodeCount = 10
+
+type MFAHandler struct {
+	core
+}
+
+func NewMFAHandler(cfg *config.Config, store repository.Store, tokens *utils.TokenService, templates *emails.Templates) *MFAHandler {
+	return &MFAHandler{core{cfg: cfg, store: store, tokens: tokens, templates: templates}}
+}
+
+// respondMFAChallenge answers a correct password on an MFA-enabled account
+// with a short-lived challenge token instead of a token pair
+func (h *core) respondMFAChallenge(c *gin.Context, user *models.User) {
+	mfaToken, err := h.tokens.GenerateMFAChallengeToken(user.ID, user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to generate tokens",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Two-factor authentication required",
+		"data": gin.H{
+			"mfaRequired": true,
+			"mfaToken":    mfaToken,
+			"expiresIn":   h.cfg.JWT.MFAChallengeExpiry,
+			"methods":     []string{"totp", "recovery_code"},
+		},
+	})
+}
+
+// VerifyLogin completes a two-step login with a TOTP or recovery code
+func (h *MFAHandler) VerifyLogin(c *gin.Context) {
+	var req models.MFALogin
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return
+	}
+
+	claims, err := h.tokens.ValidateMFAChallengeToken(req.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Invalid or expired MFA token",
+		})
+		return
+	}
+
+	user, err := h.store.Users().FindByID(claims.UserID)
+	if err != nil || !user.MFAEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Invalid or expired MFA token",
+		})
+		return
+	}
+
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		h.recordLoginFailure(c, user, "mfa", "account_locked")
+		respondAccountLocked(c, *user.LockedUntil)
+		return
+	}
+
+	code := req.Code
+	if code == "" {
+		code = req.RecoveryCode
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	if !h.verifySecondFactor(user, code) {
+		h.recordLoginFailure(c, user, "mfa", "invalid_code")
+		if lockedUntil, err := h.recordFailedLogin(user); err == nil && lockedUntil != nil {
+			respondAccountLocked(c, *lockedUntil)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Invalid verification code",
+		})
+		return
+	}
+
+	h.completeLogin(c, user, "mfa")
+}
+
+// SetupTOTP generates a new TOTP secret for the current user. It only takes
+// effect once confirmed with a code from the authenticator.
+func (h *MFAHandler) SetupTOTP(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	user, err := h.store.Users().FindByID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	if user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to generate secret",
+		})
+		return
+	}
+
+	if err := h.store.Users().Update(user.ID, map[string]interface{}{
+		"totp_secret":       secret,
+		"totp_last_counter": 0,
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to save secret",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Scan the QR code with your authenticator app, then confirm with a code",
+		"data": gin.H{
+			"secret":          secret,
+			"provisioningUri": utils.TOTPProvisioningURI(h.cfg.App.Name, user.Email, secret),
+		},
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves their
+// authenticator produces valid codes, and returns the recovery codes
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req models.MFACode
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return
+	}
+
+	user, err := h.store.Users().FindByID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	if user.MFAEnabled || user.TOTPSecret == "" {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "No pending two-factor setup",
+		})
+		return
+	}
+
+	counter, ok := utils.ValidateTOTP(user.TOTPSecret, req.Code, time.Now(), user.TOTPLastCounter)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid verification code",
+		})
+		return
+	}
+
+	var codes []string
+	err = h.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Users().Update(user.ID, map[string]interface{}{
+			"mfa_enabled":       true,
+			"mfa_enabled_at":    time.Now(),
+			"totp_last_counter": counter,
+		}); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx.MFA(), user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to enable two-factor authentication",
+		})
+		return
+	}
+
+	h.recordAudit(c, "user.mfa_enable", &user.ID, models.AuditOutcomeSuccess, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Two-factor authentication enabled. Store your recovery codes somewhere safe.",
+		"data": gin.H{
+			"recoveryCodes": codes,
+		},
+	})
+}
+
+// Disable turns off two-factor authentication after re-authentication
+func (h *MFAHandler) Disable(c *gin.Context) {
+	user, ok := h.reauthenticateForMFA(c)
+	if !ok {
+		return
+	}
+
+	err := h.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Users().Update(user.ID, map[string]interface{}{
+			"mfa_enabled":       false,
+			"mfa_enabled_at":    nil,
+			"totp_secret":       "",
+			"totp_last_counter": 0,
+		}); err != nil {
+			return err
+		}
+		return tx.MFA().DeleteRecoveryCodes(user.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to disable two-factor authentication",
+		})
+		return
+	}
+
+	h.recordAudit(c, "user.mfa_disable", &user.ID, models.AuditOutcomeSuccess, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after re-authentication
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := h.reauthenticateForMFA(c)
+	if !ok {
+		return
+	}
+
+	var codes []string
+	err := h.store.Transaction(func(tx repository.Store) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx.MFA(), user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to generate recovery codes",
+		})
+		return
+	}
+
+	h.recordAudit(c, "user.recovery_codes_regenerate", &user.ID, models.AuditOutcomeSuccess, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Recovery codes regenerated. Previous codes no longer work.",
+		"data": gin.H{
+			"recoveryCodes": codes,
+		},
+	})
+}
+
+// reauthenticateForMFA checks the current password and a second-factor code
+// of the logged-in user. It writes the error response itself on failure.
+func (h *MFAHandler) reauthenticateForMFA(c *gin.Context) (*models.User, bool) {
+	userID, _ := c.Get("userID")
+
+	var req models.MFAReauth
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return nil, false
+	}
+
+	user, err := h.store.Users().FindByID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return nil, false
+	}
+
+	if !user.MFAEnabled {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Two-factor authentication is not enabled",
+		})
+		return nil, false
+	}
+
+	if !h.reauthenticate(c, user, req.Password, req.Code) {
+		return nil, false
+	}
+	return user, true
+}
+
+// reauthenticate checks the password of the logged-in user, and a
+// second-factor code if two-factor authentication is enabled, before a
+// sensitive change to the account. It writes the error response itself on
+// failure.
+func (h *core) reauthenticate(c *gin.Context, user *models.User, password, code string) bool {
+	// Guesses here count towards the same lockout as failed logins, so a
+	// stolen access token cannot be used to try passwords without limit
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		respondAccountLocked(c, *user.LockedUntil)
+		return false
+	}
+
+	if !utils.CheckPassword(password, user.Password) || (user.MFAEnabled && !h.verifySecondFactor(user, code)) {
+		if lockedUntil, err := h.recordFailedLogin(user); err == nil && lockedUntil != nil {
+			respondAccountLocked(c, *lockedUntil)
+			return false
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Password or verification code is incorrect",
+		})
+		return false
+	}
+
+	if user.FailedLogins > 0 {
+		clearLockout(h.store.Users(), user.ID)
+	}
+	return true
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery
+// code, consuming it so neither can be replayed
+func (h *core) verifySecondFactor(user *models.User, code string) bool {
+	if counter, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastCounter); ok {
+		// Advance the counter only if nobody else used this step meanwhile
+		advanced, err := h.store.MFA().AdvanceTOTPCounter(user.ID, counter)
+		if err == nil && advanced {
+			user.TOTPLastCounter = counter
+			return true
+		}
+		return false
+	}
+
+	used, err := h.store.MFA().UseRecoveryCode(user.ID, utils.HashRecoveryCode(code), time.Now())
+	return err == nil && used
+}
+
+// replaceRecoveryCodes replaces the user's recovery codes with a new set,
+// returning the plaintext codes to show once
+func replaceRecoveryCodes(mfa repository.MFARepository, userID uint) ([]string, error) {
+	codes := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashRecoveryCode(code)
+	}
+	if err := mfa.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
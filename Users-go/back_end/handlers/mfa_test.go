@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"newworld-project/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMFAReauthCountsTowardsLockout(t *testing.T) {
+	env := setupTestEnv(t)
+	env.cfg.Security.LockoutThreshold = 2
+	env.cfg.Security.LockoutDuration = 60
+	env.cfg.Security.LockoutMaxDuration = 600
+	env.db.Model(env.user).Updates(map[string]interface{}{"mfa_enabled": true, "totp_secret": "JBSWY3DPEHPK3PXP"})
+
+	h := NewMFAHandler(env.cfg, env.store, env.tokens, env.templates)
+	r := gin.New()
+	r.POST("/users/mfa/disable", func(c *gin.Context) {
+		c.Set("userID", env.user.ID)
+		c.Next()
+	}, h.Disable)
+
+	guess := gin.H{"password": "Wrong1234", "code": "000000"}
+	for i, want := range []int{http.StatusUnauthorized, http.StatusLocked, http.StatusLocked} {
+		if code, response := doJSON(t, r, http.MethodPost, "/users/mfa/disable", guess); code != want {
+			t.Fatalf("attempt %d = %d %v, want %d", i+1, code, response, want)
+		}
+	}
+
+	var user models.User
+	env.db.First(&user, env.user.ID)
+	if !user.MFAEnabled || user.LockedUntil == nil || user.FailedLogins != 2 {
+		t.Errorf("after guesses: mfaEnabled=%v lockedUntil=%v failedLogins=%d", user.MFAEnabled, user.LockedUntil, user.FailedLogins)
+	}
+}
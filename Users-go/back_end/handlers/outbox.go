@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/mailer"
+	"newworld-project/models"
+	"newworld-project/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queueEmail adds msg to the outbox. Called with a transaction, the email is
+// only sent if the transaction commits.
+func queueEmail(store repository.Store, msg mailer.Message) error {
+	return store.Outbox().Enqueue(&models.OutboxEmail{
+		Recipient: msg.To,
+		Subject:   msg.Subject,
+		HTML:      msg.HTML,
+		Text:      msg.Text,
+	})
+}
+
+// OutboxHandler lets administrators inspect the email queue and retry
+// emails that could not be delivered
+type OutboxHandler struct {
+	core
+}
+
+func NewOutboxHandler(cfg *config.Config, store repository.Store) *OutboxHandler {
+	return &OutboxHandler{core{cfg: cfg, store: store}}
+}
+
+// ListEmails returns queued, sent or dead emails, newest first. Bodies are
+// never returned since they may contain live tokens.
+func (h *OutboxHandler) ListEmails(c *gin.Context) {
+	var req models.OutboxEmailQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return
+	}
+
+	beforeID, err := decodeCursor(req.Cursor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid cursor",
+		})
+		return
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultAuditPageSize
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	emails, err := h.store.Outbox().List(req.Status, beforeID, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list emails",
+		})
+		return
+	}
+
+	var nextCursor string
+	if len(emails) > limit {
+		emails = emails[:limit]
+		nextCursor = encodeCursor(emails[limit-1].ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"emails":     emails,
+			"nextCursor": nextCursor,
+		},
+	})
+}
+
+// Stats reports the queue depth per delivery state and how long the oldest
+// unsent email has been waiting
+func (h *OutboxHandler) Stats(c *gin.Context) {
+	stats, err := h.store.Outbox().Stats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to load email queue statistics",
+		})
+		return
+	}
+
+	var oldestPendingAge float64
+	if stats.OldestPendingAt != nil {
+		oldestPendingAge = time.Since(*stats.OldestPendingAt).Seconds()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"pending":          stats.Count[models.EmailStatusPending],
+			"sent":             stats.Count[models.EmailStatusSent],
+			"dead":             stats.Count[models.EmailStatusDead],
+			"oldestPendingAt":  stats.OldestPendingAt,
+			"oldestPendingAge": oldestPendingAge,
+		},
+	})
+}
+
+// RetryEmail puts a dead email back in the queue
+func (h *OutboxHandler) RetryEmail(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Email not found",
+		})
+		return
+	}
+
+	email, err := h.store.Outbox().Find(uint(id))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Email not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to retry email",
+		})
+		return
+	}
+
+	// The body of a dead email is cleared once the tokens in it expire
+	if email.Status == models.EmailStatusDead && email.HTML == "" && email.Text == "" {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "The content of this email has expired, so it can no longer be retried",
+		})
+		return
+	}
+
+	retried, err := h.store.Outbox().Retry(email.ID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to retry email",
+		})
+		return
+	}
+	if !retried {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Only emails that could not be delivered can be retried",
+		})
+		return
+	}
+
+	h.recordAudit(c, "admin.email.retry", nil, models.AuditOutcomeSuccess, gin.H{
+		"emailId":   email.ID,
+		"recipient": email.Recipient,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Email queued for another delivery attempt",
+	})
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"newworld-project/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOutboxAdmin(t *testing.T) {
+	env := setupTestEnv(t)
+	for _, status := range []string{models.EmailStatusSent, models.EmailStatusPending, models.EmailStatusDead, models.EmailStatusDead} {
+		email := &models.OutboxEmail{Recipient: "alice@example.com", Subject: "Hello", HTML: "<p>secret</p>"}
+		env.store.Outbox().Enqueue(email)
+		env.db.Model(email).Update("status", status)
+	}
+
+	r := gin.New()
+	h := NewOutboxHandler(env.cfg, env.store)
+	r.GET("/admin/emails", h.ListEmails)
+	r.GET("/admin/emails/stats", h.Stats)
+	r.POST("/admin/emails/:id/retry", h.RetryEmail)
+
+	// A dead email whose tokens have expired has had its body cleared
+	env.db.Model(&models.OutboxEmail{}).Where("id = ?", 3).Update("html", "")
+
+	code, response := doJSON(t, r, http.MethodGet, "/admin/emails?status=dead&limit=1", nil)
+	data := response["data"].(map[string]interface{})
+	emails := data["emails"].([]interface{})
+	if code != http.StatusOK || len(emails) != 1 || data["nextCursor"] == "" {
+		t.Fatalf("list dead emails = %d %v", code, response)
+	}
+	dead := emails[0].(map[string]interface{})
+	if dead["id"] != float64(4) {
+		t.Errorf("first dead email = %v, want 4", dead["id"])
+	}
+	if _, ok := dead["html"]; ok {
+		t.Error("email body exposed")
+	}
+
+	if code, _ := doJSON(t, r, http.MethodGet, "/admin/emails?status=lost", nil); code != http.StatusBadRequest {
+		t.Errorf("unknown status = %d, want 400", code)
+	}
+
+	_, response = doJSON(t, r, http.MethodGet, "/admin/emails/stats", nil)
+	stats := response["data"].(map[string]interface{})
+	if stats["pending"] != float64(1) || stats["sent"] != float64(1) || stats["dead"] != float64(2) || stats["oldestPendingAt"] == nil {
+		t.Errorf("stats = %v", stats)
+	}
+
+	tests := []struct {
+		id   int
+		want int
+	}{
+		{3, http.StatusConflict},
+		{4, http.StatusOK},
+		{4, http.StatusConflict},
+		{1, http.StatusConflict},
+		{99, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code, response := doJSON(t, r, http.MethodPost, "/admin/emails/"+strconv.Itoa(tt.id)+"/retry", nil); code != tt.want {
+			t.Errorf("retry %d = %d %v, want %d", tt.id, code, response, tt.want)
+		}
+	}
+
+	var events int64
+	env.db.Model(&models.AuditEvent{}).Where("action = ?", "admin.email.retry").Count(&events)
+	if events != 1 {
+		t.Errorf("retry audit events = %d, want 1", events)
+	}
+}
+
+func TestRegisterQueuesVerificationEmail(t *testing.T) {
+	env := setupTestEnv(t)
+	r := gin.New()
+	r.POST("/auth/register", NewAuthHandler(env.cfg, env.store, env.tokens, env.templates).Register)
+
+	body := gin.H{
+		"username": "bob", "email": "bob@example.com", "password": "Password1", "confirmPassword": "Password1",
+		"firstName": "Bob", "lastName": "Test", "acceptTerms": true,
+	}
+	if code, response := doJSON(t, r, http.MethodPost, "/auth/register", body); code != http.StatusCreated {
+		t.Fatalf("register = %d %v", code, response)
+	}
+
+	emails, _ := env.store.Outbox().List(models.EmailStatusPending, 0, 10)
+	if len(emails) != 1 || emails[0].Recipient != "bob@example.com" {
+		t.Fatalf("queued emails = %v", emails)
+	}
+
+	// A failed registration queues nothing
+	doJSON(t, r, http.MethodPost, "/auth/register", body)
+	if emails, _ := env.store.Outbox().List("", 0, 10); len(emails) != 1 {
+		t.Errorf("queued emails after duplicate registration = %d, want 1", len(emails))
+	}
+}
@@ -0,0 +1,566 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/metrics"
+	"newworld-project/models"
+	"newworld-project/repository"
+	"newworld-project/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// WebAuthn ceremonies stored in WebAuthnSession.Ceremony
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+const passkeyCeremonyTimeout = 5 * time.Minute
+
+type PasskeyHandler struct {
+	core
+	webAuthn *webauthn.WebAuthn
+}
+
+// NewPasskeyHandler builds the handler for the relying party in
+// cfg.WebAuthn, failing if that configuration is invalid
+func NewPasskeyHandler(cfg *config.Config, store repository.Store, tokens *utils.TokenService) (*PasskeyHandler, error) {
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthn.RPID,
+		RPDisplayName: cfg.WebAuthn.RPDisplayName,
+		RPOrigins:     cfg.WebAuthn.RPOrigins,
+		// Passkeys must be discoverable and verify the user (PIN or
+		// biometrics), which makes them a complete second factor
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		},
+		AttestationPreference: protocol.PreferNoAttestation,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: passkeyCeremonyTimeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: passkeyCeremonyTimeout},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebAuthn configuration: %w", err)
+	}
+
+	return &PasskeyHandler{core: core{cfg: cfg, store: store, tokens: tokens}, webAuthn: w}, nil
+}
+
+// webAuthnUser adapts a user and their passkeys to webauthn.User
+type webAuthnUser struct {
+	user     *models.User
+	passkeys []models.PasskeyCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte          { return u.user.WebAuthnHandle }
+func (u *webAuthnUser) WebAuthnName() string        { return u.user.Email }
+func (u *webAuthnUser) WebAuthnDisplayName() string { return u.user.FirstName + " " + u.user.LastName }
+func (u *webAuthnUser) WebAuthnIcon() string        { return "" }
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.passkeys))
+	for i, passkey := range u.passkeys {
+		var transports []protocol.AuthenticatorTransport
+		for _, transport := range strings.Split(passkey.Transports, ",") {
+			if transport != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(transport))
+			}
+		}
+
+		credentials[i] = webauthn.Credential{
+			ID:              passkey.CredentialID,
+			PublicKey:       passkey.PublicKey,
+			AttestationType: passkey.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: passkey.BackupEligible,
+				BackupState:    passkey.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    passkey.AAGUID,
+				SignCount: passkey.SignCount,
+			},
+		}
+	}
+	return credentials
+}
+
+func (h *PasskeyHandler) loadWebAuthnUser(user *models.User) (*webAuthnUser, error) {
+	passkeys, err := h.store.Passkeys().ListByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user: user, passkeys: passkeys}, nil
+}
+
+// BeginRegistration starts adding a passkey to the current user's account.
+// A passkey signs in without a password or second factor, so the user must
+// re-authenticate first; the ceremony it returns is the only way to finish.
+func (h *PasskeyHandler) BeginRegistration(c *gin.Context) {
+	user, ok := h.reauthenticateForPasskey(c)
+	if !ok {
+		return
+	}
+
+	// The WebAuthn user handle is random so it reveals nothing about the user
+	if len(user.WebAuthnHandle) == 0 {
+		handle := make([]byte, 64)
+		if _, err := rand.Read(handle); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to start passkey registration",
+			})
+			return
+		}
+		if err := h.store.Users().Update(user.ID, map[string]interface{}{"web_authn_handle": handle}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to start passkey registration",
+			})
+			return
+		}
+		user.WebAuthnHandle = handle
+	}
+
+	wUser, err := h.loadWebAuthnUser(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to start passkey registration",
+		})
+		return
+	}
+
+	// Keep authenticators from registering the same passkey twice
+	var exclusions []protocol.CredentialDescriptor
+	for _, credential := range wUser.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := h.webAuthn.BeginRegistration(wUser, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to start passkey registration",
+		})
+		return
+	}
+
+	sessionID, err := h.saveWebAuthnSession(ceremonyRegistration, &user.ID, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to start passkey registration",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"sessionId": sessionID,
+			"options":   creation,
+		},
+	})
+}
+
+// FinishRegistration verifies the authenticator's attestation and stores the
+// new passkey
+func (h *PasskeyHandler) FinishRegistration(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req models.PasskeyCeremony
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return
+	}
+
+	user, err := h.store.Users().FindByID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	session, err := h.consumeWebAuthnSession(req.SessionID, ceremonyRegistration, &user.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid or expired passkey session",
+		})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid passkey credential",
+		})
+		return
+	}
+
+	wUser, err := h.loadWebAuthnUser(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to register passkey",
+		})
+		return
+	}
+
+	credential, err := h.webAuthn.CreateCredential(wUser, *session, parsed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Passkey verification failed",
+		})
+		return
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+
+	passkey := models.PasskeyCredential{
+		UserID:          user.ID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+
+	if err := h.store.Passkeys().Create(&passkey); err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Passkey is already registered",
+		})
+		return
+	}
+
+	h.recordAudit(c, "user.passkey_add", &user.ID, models.AuditOutcomeSuccess, gin.H{
+		"passkeyId": passkey.ID,
+		"name":      passkey.Name,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Passkey registered successfully",
+		"data":    passkeyResponse(passkey),
+	})
+}
+
+// ListPasskeys lists the current user's passkeys
+func (h *PasskeyHandler) ListPasskeys(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	passkeys, err := h.store.Passkeys().ListByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list passkeys",
+		})
+		return
+	}
+
+	data := make([]gin.H, len(passkeys))
+	for i, passkey := range passkeys {
+		data[i] = passkeyResponse(passkey)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// DeletePasskey removes one of the current user's passkeys after the user
+// re-authenticates
+func (h *PasskeyHandler) DeletePasskey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Passkey not found",
+		})
+		return
+	}
+
+	user, ok := h.reauthenticateForPasskey(c)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.store.Passkeys().Delete(uint(id), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to remove passkey",
+		})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Passkey not found",
+		})
+		return
+	}
+
+	h.recordAudit(c, "user.passkey_remove", &user.ID, models.AuditOutcomeSuccess, gin.H{
+		"passkeyId": id,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Passkey removed successfully",
+	})
+}
+
+// reauthenticateForPasskey loads the logged-in user and checks the password
+// and second factor in the request. It writes the error response itself on
+// failure.
+func (h *PasskeyHandler) reauthenticateForPasskey(c *gin.Context) (*models.User, bool) {
+	userID, _ := c.Get("userID")
+
+	var req models.Reauthentication
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return nil, false
+	}
+
+	user, err := h.store.Users().FindByID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return nil, false
+	}
+
+	if !h.reauthenticate(c, user, req.Password, req.Code) {
+		return nil, false
+	}
+	return user, true
+}
+
+// BeginLogin starts a usernameless passkey login
+func (h *PasskeyHandler) BeginLogin(c *gin.Context) {
+	assertion, session, err := h.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to start passkey login",
+		})
+		return
+	}
+
+	sessionID, err := h.saveWebAuthnSession(ceremonyLogin, nil, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to start passkey login",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"sessionId": sessionID,
+			"options":   assertion,
+		},
+	})
+}
+
+// FinishLogin verifies a passkey assertion and logs the owning user in
+func (h *PasskeyHandler) FinishLogin(c *gin.Context) {
+	var req models.PasskeyCeremony
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return
+	}
+
+	session, err := h.consumeWebAuthnSession(req.SessionID, ceremonyLogin, nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid or expired passkey session",
+		})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid passkey credential",
+		})
+		return
+	}
+
+	// The user is identified by the user handle the authenticator returns
+	var wUser *webAuthnUser
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		user, err := h.store.Users().FindByWebAuthnHandle(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		loaded, err := h.loadWebAuthnUser(user)
+		if err != nil {
+			return nil, err
+		}
+		wUser = loaded
+		return wUser, nil
+	}
+
+	credential, err := h.webAuthn.ValidateDiscoverableLogin(findUser, *session, parsed)
+	if err != nil {
+		var targetID *uint
+		if wUser != nil {
+			targetID = &wUser.user.ID
+		}
+		metrics.Logins.WithLabelValues("passkey", models.AuditOutcomeFailure, "invalid_assertion").Inc()
+		h.recordAuditAs(c, nil, "auth.login", targetID, models.AuditOutcomeFailure, gin.H{
+			"method": "passkey",
+			"reason": "invalid_assertion",
+		})
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Passkey authentication failed",
+		})
+		return
+	}
+
+	// A sign counter that did not increase suggests a cloned authenticator
+	if credential.Authenticator.CloneWarning {
+		h.store.Passkeys().UpdateByCredentialID(credential.ID, map[string]interface{}{"clone_warning": true})
+		h.recordLoginFailure(c, wUser.user, "passkey", "clone_warning")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Passkey authentication failed",
+		})
+		return
+	}
+
+	h.store.Passkeys().UpdateByCredentialID(credential.ID, map[string]interface{}{
+		"sign_count":   credential.Authenticator.SignCount,
+		"backup_state": credential.Flags.BackupState,
+		"last_used_at": time.Now(),
+	})
+
+	user := wUser.user
+	if user.Status != "active" {
+		h.recordLoginFailure(c, user, "passkey", "account_"+user.Status)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found or inactive",
+		})
+		return
+	}
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		h.recordLoginFailure(c, user, "passkey", "account_locked")
+		respondAccountLocked(c, *user.LockedUntil)
+		return
+	}
+
+	h.completeLogin(c, user, "passkey")
+}
+
+// saveWebAuthnSession stores ceremony state until the matching finish
+// request and returns the ID the client must send back
+func (h *PasskeyHandler) saveWebAuthnSession(ceremony string, userID *uint, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := session.Expires
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(passkeyCeremonyTimeout)
+	}
+
+	record := models.WebAuthnSession{
+		SessionID: utils.GenerateRandomString(64),
+		UserID:    userID,
+		Ceremony:  ceremony,
+		Data:      string(data),
+		ExpiresAt: expiresAt,
+	}
+	if err := h.store.Passkeys().SaveCeremony(&record); err != nil {
+		return "", err
+	}
+
+	return record.SessionID, nil
+}
+
+// consumeWebAuthnSession loads and deletes ceremony state so that each
+// challenge can be answered only once
+func (h *PasskeyHandler) consumeWebAuthnSession(sessionID, ceremony string, userID *uint) (*webauthn.SessionData, error) {
+	record, err := h.store.Passkeys().ConsumeCeremony(sessionID, ceremony, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(record.Data), &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func passkeyResponse(passkey models.PasskeyCredential) gin.H {
+	return gin.H{
+		"id":             passkey.ID,
+		"name":           passkey.Name,
+		"credentialId":   base64.RawURLEncoding.EncodeToString(passkey.CredentialID),
+		"transports":     passkey.Transports,
+		"backupEligible": passkey.BackupEligible,
+		"backupState":    passkey.BackupState,
+		"cloneWarning":   passkey.CloneWarning,
+		"lastUsedAt":     passkey.LastUsedAt,
+		"createdAt":      passkey.CreatedAt,
+	}
+}
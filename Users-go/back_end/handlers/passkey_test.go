@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"newworld-project/config"
+	"newworld-project/database"
+	"newworld-project/emails"
+	"newworld-project/models"
+	"newworld-project/repository"
+	"newworld-project/utils"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+)
+
+var b64 = base64.RawURLEncoding
+
+// softAuthenticator is a software WebAuthn authenticator holding a single
+// ES256 passkey, with user presence and user verification always asserted.
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 32)
+	rand.Read(credentialID)
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID}
+}
+
+func (a *softAuthenticator) clientData(ceremony, challenge string) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    testOrigin,
+	})
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+// create answers navigator.credentials.create() options with "none" attestation
+func (a *softAuthenticator) create(options map[string]interface{}) json.RawMessage {
+	publicKey := options["publicKey"].(map[string]interface{})
+	challenge := publicKey["challenge"].(string)
+	userHandle, err := b64.DecodeString(publicKey["user"].(map[string]interface{})["id"].(string))
+	if err != nil {
+		a.t.Fatalf("decode user handle: %v", err)
+	}
+	a.userHandle = userHandle
+
+	encMode, _ := cbor.CTAP2EncOptions().EncMode()
+	ecdhKey, _ := a.key.PublicKey.ECDH()
+	point := ecdhKey.Bytes()[1:]
+	coseKey, err := encMode.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: point[:32],
+		-3: point[32:],
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, coseKey...)
+
+	attestationObject, err := encMode.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(0x45, attested), // UP | UV | AT
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	credential, _ := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credentialID),
+		"rawId": b64.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", challenge)),
+			"attestationObject": b64.EncodeToString(attestationObject),
+			"transports":        []string{"internal"},
+		},
+	})
+	return credential
+}
+
+// get answers navigator.credentials.get() options
+func (a *softAuthenticator) get(options map[string]interface{}) json.RawMessage {
+	challenge := options["publicKey"].(map[string]interface{})["challenge"].(string)
+
+	clientData := a.clientData("webauthn.get", challenge)
+	authData := a.authData(0x05, nil) // UP | UV
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	credential, _ := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credentialID),
+		"rawId": b64.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString(a.userHandle),
+		},
+	})
+	return credential
+}
+
+// testEnv is a fresh in-memory database and test configuration with one
+// active user
+type testEnv struct {
+	cfg       *config.Config
+	db        *gorm.DB
+	store     repository.Store
+	tokens    *utils.TokenService
+	templates *emails.Templates
+	user      *models.User
+}
+
+// setupTestEnv creates a test environment. The configuration is also
+// installed globally for the password helpers in utils.
+func setupTestEnv(t *testing.T) *testEnv {
+	gin.SetMode(gin.TestMode)
+
+	previousConfig := config.ConfigInstance
+	t.Cleanup(func() { config.ConfigInstance = previousConfig })
+
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:             "test-secret",
+			Issuer:             "newworld-project",
+			Audience:           "newworld-api",
+			AccessTokenExpiry:  3600,
+			RefreshTokenExpiry: 604800,
+		},
+		WebAuthn: config.WebAuthnConfig{
+			RPID:          testRPID,
+			RPDisplayName: "NewWorld Project",
+			RPOrigins:     []string{testOrigin},
+		},
+	}
+	config.ConfigInstance = cfg
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=private"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", Password: "x", FirstName: "Alice", LastName: "Liddell", Role: "user", Status: "active"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := utils.NewTokenService(cfg.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates, err := emails.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testEnv{cfg: cfg, db: db, store: repository.NewGormStore(db), tokens: tokens, templates: templates, user: user}
+}
+
+// passkeyReauth re-authenticates the test user, who has no second factor
+var passkeyReauth = gin.H{"password": "Passw0rd!"}
+
+func setupPasskeyTest(t *testing.T) (*gin.Engine, *testEnv) {
+	env := setupTestEnv(t)
+	env.cfg.Security.BcryptCost = bcrypt.MinCost
+	hash, err := utils.HashPassword(passkeyReauth["password"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.db.Model(env.user).Update("password", hash)
+
+	h, err := NewPasskeyHandler(env.cfg, env.store, env.tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asUser := func(c *gin.Context) {
+		c.Set("userID", env.user.ID)
+		c.Next()
+	}
+
+	r := gin.New()
+	r.POST("/users/passkeys/register/begin", asUser, h.BeginRegistration)
+	r.POST("/users/passkeys/register/finish", asUser, h.FinishRegistration)
+	r.GET("/users/passkeys", asUser, h.ListPasskeys)
+	r.DELETE("/users/passkeys/:id", asUser, h.DeletePasskey)
+	r.POST("/auth/passkeys/login/begin", h.BeginLogin)
+	r.POST("/auth/passkeys/login/finish", h.FinishLogin)
+
+	return r, env
+}
+
+func TestNewPasskeyHandlerRejectsInvalidConfig(t *testing.T) {
+	env := setupTestEnv(t)
+	cfg := *env.cfg
+	cfg.WebAuthn.RPID = ""
+
+	if _, err := NewPasskeyHandler(&cfg, env.store, env.tokens); err == nil {
+		t.Fatal("expected an error for a missing relying party ID")
+	}
+}
+
+func doJSON(t *testing.T, r *gin.Engine, method, path string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("%s %s: invalid JSON %q", method, path, w.Body.String())
+	}
+	return w.Code, response
+}
+
+func beginCeremony(t *testing.T, r *gin.Engine, path string, body interface{}) (string, map[string]interface{}) {
+	t.Helper()
+	code, response := doJSON(t, r, http.MethodPost, path, body)
+	if code != http.StatusOK {
+		t.Fatalf("POST %s = %d %v", path, code, response)
+	}
+	data := response["data"].(map[string]interface{})
+	return data["sessionId"].(string), data["options"].(map[string]interface{})
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	r, env := setupPasskeyTest(t)
+	authenticator := newSoftAuthenticator(t)
+
+	// Registration ceremony
+	sessionID, options := beginCeremony(t, r, "/users/passkeys/register/begin", passkeyReauth)
+	credential := authenticator.create(options)
+	code, response := doJSON(t, r, http.MethodPost, "/users/passkeys/register/finish", gin.H{
+		"sessionId":  sessionID,
+		"name":       "Laptop",
+		"credential": credential,
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("finish registration = %d %v", code, response)
+	}
+
+	// The registration session cannot be replayed
+	code, _ = doJSON(t, r, http.MethodPost, "/users/passkeys/register/finish", gin.H{
+		"sessionId":  sessionID,
+		"credential": credential,
+	})
+	if code != http.StatusBadRequest {
+		t.Errorf("replayed registration = %d, want 400", code)
+	}
+
+	code, response = doJSON(t, r, http.MethodGet, "/users/passkeys", nil)
+	passkeys, _ := response["data"].([]interface{})
+	if code != http.StatusOK || len(passkeys) != 1 {
+		t.Fatalf("list passkeys = %d %v", code, response)
+	}
+	passkey := passkeys[0].(map[string]interface{})
+	if passkey["name"] != "Laptop" || passkey["credentialId"] != b64.EncodeToString(authenticator.credentialID) {
+		t.Errorf("unexpected passkey %v", passkey)
+	}
+
+	// Usernameless login ceremony ends in a normal token pair
+	authenticator.signCount = 1
+	sessionID, options = beginCeremony(t, r, "/auth/passkeys/login/begin", nil)
+	code, response = doJSON(t, r, http.MethodPost, "/auth/passkeys/login/finish", gin.H{
+		"sessionId":  sessionID,
+		"credential": authenticator.get(options),
+	})
+	if code != http.StatusOK {
+		t.Fatalf("finish login = %d %v", code, response)
+	}
+	token := response["data"].(map[string]interface{})["token"].(map[string]interface{})
+	claims, err := env.tokens.ValidateAccessToken(token["accessToken"].(string))
+	if err != nil || claims.UserID != env.user.ID {
+		t.Fatalf("login returned unusable access token: %v", err)
+	}
+
+	var stored models.PasskeyCredential
+	env.db.First(&stored)
+	if stored.SignCount != 1 || stored.LastUsedAt == nil {
+		t.Errorf("sign count %d, last used %v not updated", stored.SignCount, stored.LastUsedAt)
+	}
+
+	// A sign counter that does not increase is treated as a cloned authenticator
+	sessionID, options = beginCeremony(t, r, "/auth/passkeys/login/begin", nil)
+	code, _ = doJSON(t, r, http.MethodPost, "/auth/passkeys/login/finish", gin.H{
+		"sessionId":  sessionID,
+		"credential": authenticator.get(options),
+	})
+	if code != http.StatusUnauthorized {
+		t.Errorf("login with stale sign count = %d, want 401", code)
+	}
+
+	// Removed passkeys can no longer log in
+	code, _ = doJSON(t, r, http.MethodDelete, "/users/passkeys/1", passkeyReauth)
+	if code != http.StatusOK {
+		t.Fatalf("delete passkey = %d", code)
+	}
+	authenticator.signCount = 2
+	sessionID, options = beginCeremony(t, r, "/auth/passkeys/login/begin", nil)
+	code, _ = doJSON(t, r, http.MethodPost, "/auth/passkeys/login/finish", gin.H{
+		"sessionId":  sessionID,
+		"credential": authenticator.get(options),
+	})
+	if code != http.StatusUnauthorized {
+		t.Errorf("login with removed passkey = %d, want 401", code)
+	}
+}
+
+func TestPasskeyLoginRejectsForeignChallenge(t *testing.T) {
+	r, _ := setupPasskeyTest(t)
+	authenticator := newSoftAuthenticator(t)
+
+	sessionID, options := beginCeremony(t, r, "/users/passkeys/register/begin", passkeyReauth)
+	code, _ := doJSON(t, r, http.MethodPost, "/users/passkeys/register/finish", gin.H{
+		"sessionId":  sessionID,
+		"credential": authenticator.create(options),
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("finish registration = %d", code)
+	}
+
+	// Sign the challenge of one ceremony and submit it to another
+	authenticator.signCount = 1
+	_, firstOptions := beginCeremony(t, r, "/auth/passkeys/login/begin", nil)
+	secondSession, _ := beginCeremony(t, r, "/auth/passkeys/login/begin", nil)
+	code, _ = doJSON(t, r, http.MethodPost, "/auth/passkeys/login/finish", gin.H{
+		"sessionId":  secondSession,
+		"credential": authenticator.get(firstOptions),
+	})
+	if code != http.StatusUnauthorized {
+		t.Errorf("login with foreign challenge = %d, want 401", code)
+	}
+}
+
+func TestPasskeyChangesRequireReauthentication(t *testing.T) {
+	r, env := setupPasskeyTest(t)
+	authenticator := newSoftAuthenticator(t)
+
+	sessionID, options := beginCeremony(t, r, "/users/passkeys/register/begin", passkeyReauth)
+	if code, _ := doJSON(t, r, http.MethodPost, "/users/passkeys/register/finish", gin.H{
+		"sessionId":  sessionID,
+		"credential": authenticator.create(options),
+	}); code != http.StatusCreated {
+		t.Fatalf("finish registration = %d", code)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"register without password", http.MethodPost, "/users/passkeys/register/begin", nil, http.StatusBadRequest},
+		{"register with wrong password", http.MethodPost, "/users/passkeys/register/begin", gin.H{"password": "Wrong1234"}, http.StatusUnauthorized},
+		{"remove without password", http.MethodDelete, "/users/passkeys/1", nil, http.StatusBadRequest},
+		{"remove with wrong password", http.MethodDelete, "/users/passkeys/1", gin.H{"password": "Wrong1234"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if code, response := doJSON(t, r, tt.method, tt.path, tt.body); code != tt.want {
+			t.Errorf("%s = %d %v, want %d", tt.name, code, response, tt.want)
+		}
+	}
+
+	// With two-factor authentication on, the password alone is not enough
+	env.db.Model(env.user).Updates(map[string]interface{}{"mfa_enabled": true, "totp_secret": "JBSWY3DPEHPK3PXP"})
+	if code, _ := doJSON(t, r, http.MethodDelete, "/users/passkeys/1", passkeyReauth); code != http.StatusUnauthorized {
+		t.Errorf("remove without second factor = %d, want 401", code)
+	}
+
+	var passkeys, ceremonies int64
+	env.db.Model(&models.PasskeyCredential{}).Count(&passkeys)
+	env.db.Model(&models.WebAuthnSession{}).Count(&ceremonies)
+	if passkeys != 1 || ceremonies != 0 {
+		t.Errorf("%d passkeys and %d registration ceremonies left, want 1 and 0", passkeys, ceremonies)
+	}
+}
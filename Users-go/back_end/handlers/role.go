@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"newworld-project/config"
+	"newworld-project/middleware"
+	"newworld-project/models"
+	"newworld-project/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errUnknownParentRole = errors.New("parent role does not exist")
+	errUnknownPermission = errors.New("unknown permission")
+	errRoleCycle         = errors.New("role cannot inherit from itself")
+)
+
+// RoleHandler manages roles and invalidates the permission checker's cache
+// whenever they change
+type RoleHandler struct {
+	core
+	permissions *middleware.PermissionChecker
+}
+
+func NewRoleHandler(cfg *config.Config, store repository.Store, permissions *middleware.PermissionChecker) *RoleHandler {
+	return &RoleHandler{core: core{cfg: cfg, store: store}, permissions: permissions}
+}
+
+// ListPermissions lists every permission that can be granted
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	permissions, err := h.store.Roles().ListPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list permissions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    permissions,
+	})
+}
+
+// ListRoles lists roles with their own and effective permissions
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.store.Roles().List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list roles",
+		})
+		return
+	}
+
+	data := make([]gin.H, len(roles))
+	for i, role := range roles {
+		data[i] = h.roleResponse(role)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// CreateRole creates a role, optionally inheriting from a parent role
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req models.RoleCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return
+	}
+
+	if _, err := h.store.Roles().FindByName(req.Name); err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Role already exists",
+		})
+		return
+	}
+
+	role := &models.Role{Name: req.Name, Description: req.Description}
+	err := h.store.Transaction(func(tx repository.Store) error {
+		if err := setRoleParent(tx.Roles(), role, req.Parent); err != nil {
+			return err
+		}
+		if err := tx.Roles().Create(role); err != nil {
+			return err
+		}
+		return setRolePermissions(tx.Roles(), role, req.Permissions)
+	})
+	if !respondRoleError(c, err, "Failed to create role") {
+		return
+	}
+
+	h.permissions.Invalidate()
+	h.recordAudit(c, "admin.role.create", nil, models.AuditOutcomeSuccess, gin.H{
+		"role":        role.Name,
+		"parent":      req.Parent,
+		"permissions": req.Permissions,
+	})
+
+	if created, err := h.store.Roles().FindByID(role.ID); err == nil {
+		role = created
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Role created successfully",
+		"data":    h.roleResponse(*role),
+	})
+}
+
+// UpdateRole replaces a role's description, parent and permissions
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	var req models.RoleUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Validation failed",
+			"errors":  getValidationErrors(err),
+		})
+		return
+	}
+
+	role, ok := findRole(c, h.store.Roles())
+	if !ok {
+		return
+	}
+
+	err := h.store.Transaction(func(tx repository.Store) error {
+		role.Description = req.Description
+		if err := setRoleParent(tx.Roles(), role, req.Parent); err != nil {
+			return err
+		}
+		if err := tx.Roles().Update(role); err != nil {
+			return err
+		}
+		return setRolePermissions(tx.Roles(), role, req.Permissions)
+	})
+	if !respondRoleError(c, err, "Failed to update role") {
+		return
+	}
+
+	h.permissions.Invalidate()
+	h.recordAudit(c, "admin.role.update", nil, models.AuditOutcomeSuccess, gin.H{
+		"role":        role.Name,
+		"parent":      req.Parent,
+		"permissions": req.Permissions,
+	})
+
+	if updated, err := h.store.Roles().FindByID(role.ID); err == nil {
+		role = updated
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Role updated successfully",
+		"data":    h.roleResponse(*role),
+	})
+}
+
+// DeleteRole deletes a role that is neither built in nor in use
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	role, ok := findRole(c, h.store.Roles())
+	if !ok {
+		return
+	}
+
+	if role.Name == models.RoleUser || role.Name == models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Built-in roles cannot be deleted",
+		})
+		return
+	}
+
+	users, err := h.store.Users().CountByRole(role.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to delete role",
+		})
+		return
+	}
+	children, err := h.store.Roles().CountChildren(role.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to delete role",
+		})
+		return
+	}
+	if users > 0 || children > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Role is still assigned to users or inherited by other roles",
+		})
+		return
+	}
+
+	err = h.store.Transaction(func(tx repository.Store) error {
+		return tx.Roles().Delete(role)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to delete role",
+		})
+		return
+	}
+
+	h.permissions.Invalidate()
+	h.recordAudit(c, "admin.role.delete", nil, models.AuditOutcomeSuccess, gin.H{
+		"role": role.Name,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Role deleted successfully",
+	})
+}
+
+// findRole loads the role named by the :id parameter. It writes the 404
+// response itself when the ID is not a number or there is no such role.
+func findRole(c *gin.Context, roles repository.RoleRepository) (*models.Role, bool) {
+	var role *models.Role
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err == nil {
+		role, err = roles.FindByID(uint(id))
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Role not found",
+		})
+		return nil, false
+	}
+	return role, true
+}
+
+// setRoleParent points role at the named parent, refusing names that do not
+// exist and chains that would lead back to role itself
+func setRoleParent(roles repository.RoleRepository, role *models.Role, parentName string) error {
+	if parentName == "" {
+		role.ParentID = nil
+		return nil
+	}
+
+	parent, err := roles.FindByName(parentName)
+	if err != nil {
+		return errUnknownParentRole
+	}
+
+	visited := make(map[uint]bool)
+	for ancestor := parent; !visited[ancestor.ID]; {
+		if role.ID != 0 && ancestor.ID == role.ID {
+			return errRoleCycle
+		}
+		visited[ancestor.ID] = true
+		if ancestor.ParentID == nil {
+			break
+		}
+		next, err := roles.FindByID(*ancestor.ParentID)
+		if err != nil {
+			break
+		}
+		ancestor = next
+	}
+
+	role.ParentID = &parent.ID
+	return nil
+}
+
+// setRolePermissions replaces the permissions granted directly to role
+func setRolePermissions(roles repository.RoleRepository, role *models.Role, names []string) error {
+	permissions, err := roles.FindPermissions(names)
+	if err != nil {
+		return err
+	}
+	if len(permissions) != len(uniqueStrings(names)) {
+		return errUnknownPermission
+	}
+	return roles.SetPermissions(role, permissions)
+}
+
+// respondRoleError writes the response for an error from creating or
+// updating a role and reports whether the request may continue
+func respondRoleError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errUnknownParentRole):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Parent role does not exist",
+		})
+	case errors.Is(err, errUnknownPermission):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Unknown permission",
+		})
+	case errors.Is(err, errRoleCycle):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "A role cannot inherit from itself or its descendants",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": message,
+		})
+	}
+	return false
+}
+
+func uniqueStrings(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+func (h *RoleHandler) roleResponse(role models.Role) gin.H {
+	var parent string
+	if role.Parent != nil {
+		parent = role.Parent.Name
+	}
+
+	permissions := make([]string, len(role.Permissions))
+	for i, permission := range role.Permissions {
+		permissions[i] = permission.Name
+	}
+
+	effective, _ := h.permissions.RolePermissions(role.Name)
+
+	return gin.H{
+		"id":                   role.ID,
+		"name":                 role.Name,
+		"description":          role.Description,
+		"parent":               parent,
+		"permissions":          permissions,
+		"effectivePermissions": effective,
+		"createdAt":            role.CreatedAt,
+		"updatedAt":            role.UpdatedAt,
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"newworld-project/middleware"
+	"newworld-project/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoleRejectsNonNumericIDs(t *testing.T) {
+	env := setupTestEnv(t)
+	support := models.Role{Name: "support", Description: "Support staff"}
+	if err := env.db.Create(&support).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewRoleHandler(env.cfg, env.store, middleware.NewPermissionChecker(env.store))
+	r := gin.New()
+	r.PUT("/admin/roles/:id", h.UpdateRole)
+	r.DELETE("/admin/roles/:id", h.DeleteRole)
+
+	// A non-numeric ID must not reach the query as a raw SQL condition
+	crafted := "/admin/roles/0%20OR%20name%20=%20'support'"
+	if code, response := adminRequest(r, http.MethodPut, crafted, `{"description":"hijacked"}`); code != http.StatusNotFound {
+		t.Errorf("update with a crafted ID = %d %v, want 404", code, response)
+	}
+	if code, response := adminRequest(r, http.MethodDelete, crafted, ""); code != http.StatusNotFound {
+		t.Errorf("delete with a crafted ID = %d %v, want 404", code, response)
+	}
+	if code, _ := adminRequest(r, http.MethodDelete, "/admin/roles/support", ""); code != http.StatusNotFound {
+		t.Errorf("delete by name = %d, want 404", code)
+	}
+
+	var stored models.Role
+	if err := env.db.First(&stored, support.ID).Error; err != nil || stored.Description != "Support staff" {
+		t.Errorf("role after crafted requests = %+v, %v", stored, err)
+	}
+}
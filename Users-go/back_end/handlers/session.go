@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/metrics"
+	"newworld-project/models"
+	"newworld-project/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionHandler struct {
+	core
+}
+
+func NewSessionHandler(cfg *config.Config, store repository.Store) *SessionHandler {
+	return &SessionHandler{core{cfg: cfg, store: store}}
+}
+
+// ListSessions lists the devices the current user is signed in on
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	current := currentSession(c)
+
+	sessions, err := h.store.Sessions().ListActiveSessions(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list sessions",
+		})
+		return
+	}
+
+	data := make([]gin.H, len(sessions))
+	for i, session := range sessions {
+		data[i] = sessionResponse(session, session.ID == current.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// RevokeSession signs one of the current user's sessions out
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Session not found",
+		})
+		return
+	}
+
+	session, err := h.store.Sessions().FindActiveSessionByID(uint(id), c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Session not found",
+		})
+		return
+	}
+
+	if err := h.store.Sessions().RevokeFamily(session.FamilyID, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to revoke session",
+		})
+		return
+	}
+
+	metrics.TokenRevocations.WithLabelValues("session_revoke").Inc()
+
+	h.recordAudit(c, "user.session_revoke", &session.UserID, models.AuditOutcomeSuccess, gin.H{
+		"sessionId": session.ID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Session revoked",
+	})
+}
+
+// RevokeOtherSessions signs the current user out everywhere except the
+// session making the request
+func (h *SessionHandler) RevokeOtherSessions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	current := currentSession(c)
+
+	revoked, err := h.store.Sessions().RevokeUserSessions(userID, current.ID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to revoke sessions",
+		})
+		return
+	}
+
+	metrics.TokenRevocations.WithLabelValues("session_revoke_others").Inc()
+
+	h.recordAudit(c, "user.session_revoke_others", &userID, models.AuditOutcomeSuccess, gin.H{
+		"revoked": revoked,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Signed out of all other sessions",
+		"data": gin.H{
+			"revoked": revoked,
+		},
+	})
+}
+
+// currentSession returns the session set by AuthMiddleware
+func currentSession(c *gin.Context) models.Session {
+	session, _ := c.Get("session")
+	current, _ := session.(models.Session)
+	return current
+}
+
+func sessionResponse(session models.Session, current bool) gin.H {
+	return gin.H{
+		"id":         session.ID,
+		"userAgent":  session.UserAgent,
+		"ipAddress":  session.IPAddress,
+		"createdAt":  session.CreatedAt,
+		"lastUsedAt": session.LastUsedAt,
+		"expiresAt":  session.ExpiresAt,
+		"current":    current,
+	}
+}
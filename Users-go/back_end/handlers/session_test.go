@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"newworld-project/middleware"
+	"newworld-project/models"
+	"newworld-project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSessionRevocation(t *testing.T) {
+	env := setupTestEnv(t)
+	user := env.user
+
+	h := NewSessionHandler(env.cfg, env.store)
+	r := gin.New()
+	users := r.Group("/users", middleware.AuthMiddleware(env.tokens, env.store, nil))
+	users.GET("/sessions", h.ListSessions)
+	users.DELETE("/sessions/:id", h.RevokeSession)
+	users.POST("/sessions/revoke-others", h.RevokeOtherSessions)
+
+	request := func(method, path, token string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	// Sign in on three devices
+	tokens := make([]*utils.TokenPair, 3)
+	for i := range tokens {
+		session := &models.Session{UserID: user.ID, FamilyID: utils.GenerateRandomString(32)}
+		pair, err := issueTokenPair(env.tokens, env.store, user, session, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[i] = pair
+	}
+
+	code, response := request(http.MethodGet, "/users/sessions", tokens[0].AccessToken)
+	sessions, _ := response["data"].([]interface{})
+	if code != http.StatusOK || len(sessions) != 3 {
+		t.Fatalf("list sessions = %d %v", code, response)
+	}
+	for _, s := range sessions {
+		session := s.(map[string]interface{})
+		if current := session["id"] == float64(1); session["current"] != current {
+			t.Errorf("session %v current = %v", session["id"], session["current"])
+		}
+	}
+
+	if code, _ := request(http.MethodDelete, "/users/sessions/2", tokens[0].AccessToken); code != http.StatusOK {
+		t.Fatalf("revoke session = %d", code)
+	}
+	if code, _ := request(http.MethodGet, "/users/sessions", tokens[1].AccessToken); code != http.StatusUnauthorized {
+		t.Errorf("token of revoked session = %d, want 401", code)
+	}
+	claims, _ := env.tokens.ValidateRefreshToken(tokens[1].RefreshToken)
+	if _, _, err := h.rotateRefreshToken(testContext(), claims); err == nil {
+		t.Error("refresh token of revoked session still rotates")
+	}
+
+	if code, _ := request(http.MethodPost, "/users/sessions/revoke-others", tokens[0].AccessToken); code != http.StatusOK {
+		t.Fatalf("revoke other sessions = %d", code)
+	}
+	if code, _ := request(http.MethodGet, "/users/sessions", tokens[2].AccessToken); code != http.StatusUnauthorized {
+		t.Errorf("token of other session = %d, want 401", code)
+	}
+	code, response = request(http.MethodGet, "/users/sessions", tokens[0].AccessToken)
+	sessions, _ = response["data"].([]interface{})
+	if code != http.StatusOK || len(sessions) != 1 {
+		t.Errorf("current session after revoking others = %d %v", code, response)
+	}
+}
+
+func testContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	return c
+}
+
+func TestChangePasswordInvalidatesTokens(t *testing.T) {
+	env := setupTestEnv(t)
+	user := env.user
+	env.cfg.Security.BcryptCost = 4
+	hash, _ := utils.HashPassword("old-password")
+	env.db.Model(user).Update("password", hash)
+
+	h := NewUserHandler(env.cfg, env.store, env.tokens, middleware.NewPermissionChecker(env.store))
+	r := gin.New()
+	users := r.Group("/users", middleware.AuthMiddleware(env.tokens, env.store, nil))
+	users.GET("/profile", h.GetProfile)
+	users.POST("/change-password", h.ChangePassword)
+
+	request := func(method, path, token string, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	tokens := make([]*utils.TokenPair, 2)
+	for i := range tokens {
+		session := &models.Session{UserID: user.ID, FamilyID: utils.GenerateRandomString(32)}
+		pair, err := issueTokenPair(env.tokens, env.store, user, session, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[i] = pair
+	}
+
+	code, response := request(http.MethodPost, "/users/change-password", tokens[0].AccessToken,
+		`{"currentPassword":"old-password","newPassword":"new-password","confirmPassword":"new-password","keepCurrentSession":true}`)
+	if code != http.StatusOK {
+		t.Fatalf("change password = %d %v", code, response)
+	}
+	fresh := response["data"].(map[string]interface{})["token"].(map[string]interface{})
+
+	for i, pair := range tokens {
+		if code, _ := request(http.MethodGet, "/users/profile", pair.AccessToken, ""); code != http.StatusUnauthorized {
+			t.Errorf("access token %d issued before the change = %d, want 401", i, code)
+		}
+		claims, _ := env.tokens.ValidateRefreshToken(pair.RefreshToken)
+		if _, _, err := h.rotateRefreshToken(testContext(), claims); err == nil {
+			t.Errorf("refresh token %d issued before the change still rotates", i)
+		}
+	}
+
+	// The current session continues with the tokens returned by the change
+	if code, _ := request(http.MethodGet, "/users/profile", fresh["accessToken"].(string), ""); code != http.StatusOK {
+		t.Errorf("new access token = %d, want 200", code)
+	}
+	claims, _ := env.tokens.ValidateRefreshToken(fresh["refreshToken"].(string))
+	if _, _, err := h.rotateRefreshToken(testContext(), claims); err != nil {
+		t.Errorf("new refresh token: %v", err)
+	}
+}
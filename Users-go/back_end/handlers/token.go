@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"newworld-project/models"
+	"newworld-project/repository"
+	"newworld-project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errRefreshTokenInvalid = errors.New("invalid refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// newSession describes a login from the client making the request. It is
+// saved by issueTokenPair together with the first token pair.
+func newSession(c *gin.Context, user *models.User) *models.Session {
+	return &models.Session{
+		UserID:    user.ID,
+		FamilyID:  utils.GenerateRandomString(32),
+		UserAgent: truncate(c.Request.UserAgent(), 512),
+		IPAddress: c.ClientIP(),
+	}
+}
+
+// issueTokenPair generates a token pair for the user within the session,
+// records its refresh token and saves the session with the new expiry.
+func issueTokenPair(tokens *utils.TokenService, store repository.Store, user *models.User, session *models.Session, parentID *uint) (*utils.TokenPair, error) {
+	tokenPair, err := tokens.GenerateTokenPair(user.ID, user.Username, user.Email, user.Role, session.FamilyID, user.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := models.RefreshTokenRecord{
+		UserID:    user.ID,
+		FamilyID:  session.FamilyID,
+		TokenID:   tokenPair.RefreshTokenID,
+		ParentID:  parentID,
+		ExpiresAt: tokenPair.RefreshExpiresAt,
+	}
+	if err := store.Sessions().CreateRefreshToken(&refreshToken); err != nil {
+		return nil, err
+	}
+
+	session.LastUsedAt = time.Now()
+	session.ExpiresAt = tokenPair.RefreshExpiresAt
+	if err := store.Sessions().SaveSession(session); err != nil {
+		return nil, err
+	}
+
+	return tokenPair, nil
+}
+
+// rotateRefreshToken exchanges a stored refresh token for a new token pair in
+// the same session. Presenting a token that was already rotated or revoked
+// revokes the whole family and returns errRefreshTokenReused.
+func (h *core) rotateRefreshToken(c *gin.Context, claims *utils.JWTClaims) (*models.User, *utils.TokenPair, error) {
+	stored, err := h.store.Sessions().FindRefreshToken(claims.ID)
+	if err != nil {
+		return nil, nil, errRefreshTokenInvalid
+	}
+
+	user, err := h.store.Users().FindByID(stored.UserID)
+	if err != nil || user.Status != "active" {
+		return nil, nil, errRefreshTokenInvalid
+	}
+
+	// Tokens issued before a password change are stale rather than replayed,
+	// so they are refused without touching the family
+	if claims.TokenVersion != user.TokenVersion {
+		return nil, nil, errRefreshTokenInvalid
+	}
+
+	if stored.RotatedAt != nil || stored.RevokedAt != nil {
+		h.store.Sessions().RevokeFamily(stored.FamilyID, time.Now())
+		return nil, nil, errRefreshTokenReused
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, nil, errRefreshTokenInvalid
+	}
+
+	// Families issued before sessions existed get one on their next refresh
+	session, err := h.store.Sessions().FindSessionByFamily(stored.FamilyID)
+	if errors.Is(err, repository.ErrNotFound) {
+		session = &models.Session{FamilyID: stored.FamilyID, UserID: user.ID, CreatedAt: stored.CreatedAt}
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if session.RevokedAt != nil || session.UserID != user.ID {
+		return nil, nil, errRefreshTokenInvalid
+	}
+	session.UserAgent = truncate(c.Request.UserAgent(), 512)
+	session.IPAddress = c.ClientIP()
+
+	var tokenPair *utils.TokenPair
+	err = h.store.Transaction(func(tx repository.Store) error {
+		// Only one concurrent request may rotate a given token; the loser is
+		// treated as a replay.
+		rotated, err := tx.Sessions().MarkRefreshTokenRotated(stored.ID, time.Now())
+		if err != nil {
+			return err
+		}
+		if !rotated {
+			return errRefreshTokenReused
+		}
+
+		tokenPair, err = issueTokenPair(h.tokens, tx, user, session, &stored.ID)
+		return err
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		h.store.Sessions().RevokeFamily(stored.FamilyID, time.Now())
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, tokenPair, nil
+}
+
+// invalidateUserTokens bumps the user's token version, which makes every
+// access and refresh token issued so far unusable, and signs out all
+// sessions except keepSessionID (0 keeps none).
+func invalidateUserTokens(store repository.Store, userID, keepSessionID uint) error {
+	if err := store.Users().IncrementTokenVersion(userID); err != nil {
+		return err
+	}
+
+	// The kept session's refresh tokens carry the old version as well
+	now := time.Now()
+	if err := store.Sessions().RevokeUserRefreshTokens(userID, now); err != nil {
+		return err
+	}
+
+	_, err := store.Sessions().RevokeUserSessions(userID, keepSessionID, now)
+	return err
+}
+
+// truncate shortens s to at most n bytes.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
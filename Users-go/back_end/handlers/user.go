@@ -4,25 +4,31 @@ import (
 	"net/http"
 	"time"
 
-	"newworld-project/database"
+	"newworld-project/config"
+	"newworld-project/metrics"
+	"newworld-project/middleware"
 	"newworld-project/models"
+	"newworld-project/repository"
 	"newworld-project/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-type UserHandler struct{}
+type UserHandler struct {
+	core
+	permissions *middleware.PermissionChecker
+}
 
-func NewUserHandler() *UserHandler {
-	return &UserHandler{}
+func NewUserHandler(cfg *config.Config, store repository.Store, tokens *utils.TokenService, permissions *middleware.PermissionChecker) *UserHandler {
+	return &UserHandler{core: core{cfg: cfg, store: store, tokens: tokens}, permissions: permissions}
 }
 
 // GetProfile gets the current user's profile
 func (h *UserHandler) GetProfile(c *gin.Context) {
-	userID, _ := c.Get("userID")
+	userID := c.GetUint("userID")
 
-	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
+	user, err := h.store.Users().FindByID(userID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"message": "User not found",
@@ -30,6 +36,8 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
+	permissions, _ := h.permissions.RolePermissions(user.Role)
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": gin.H{
@@ -41,9 +49,12 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 			"phone":         user.Phone,
 			"dateOfBirth":   user.DateOfBirth,
 			"bio":           user.Bio,
+			"locale":        user.Locale,
 			"role":          user.Role,
 			"status":        user.Status,
 			"emailVerified": user.EmailVerified,
+			"mfaEnabled":    user.MFAEnabled,
+			"permissions":   permissions,
 			"lastLoginAt":   user.LastLoginAt,
 			"createdAt":     user.CreatedAt,
 			"updatedAt":     user.UpdatedAt,
@@ -53,7 +64,7 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 
 // UpdateProfile updates the current user's profile
 func (h *UserHandler) UpdateProfile(c *gin.Context) {
-	userID, _ := c.Get("userID")
+	userID := c.GetUint("userID")
 
 	var req models.UserProfile
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -75,14 +86,18 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 
 	// Update user profile
 	updates := map[string]interface{}{
-		"first_name":   req.FirstName,
-		"last_name":    req.LastName,
-		"phone":        &req.Phone,
+		"first_name":    req.FirstName,
+		"last_name":     req.LastName,
+		"phone":         &req.Phone,
 		"date_of_birth": dateOfBirth,
-		"bio":          &req.Bio,
+		"bio":           &req.Bio,
+	}
+	// Keep the email language unless a new one is given
+	if req.Locale != "" {
+		updates["locale"] = req.Locale
 	}
 
-	if err := database.DB.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+	if err := h.store.Users().Update(userID, updates); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": "Failed to update profile",
@@ -91,8 +106,8 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 	}
 
 	// Get updated user
-	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
+	user, err := h.store.Users().FindByID(userID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"message": "User not found",
@@ -100,6 +115,8 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 		return
 	}
 
+	h.recordAudit(c, "user.profile_update", &user.ID, models.AuditOutcomeSuccess, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Profile updated successfully",
@@ -112,9 +129,11 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 			"phone":         user.Phone,
 			"dateOfBirth":   user.DateOfBirth,
 			"bio":           user.Bio,
+			"locale":        user.Locale,
 			"role":          user.Role,
 			"status":        user.Status,
 			"emailVerified": user.EmailVerified,
+			"mfaEnabled":    user.MFAEnabled,
 			"lastLoginAt":   user.LastLoginAt,
 			"createdAt":     user.CreatedAt,
 			"updatedAt":     user.UpdatedAt,
@@ -124,7 +143,7 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 
 // ChangePassword changes the current user's password
 func (h *UserHandler) ChangePassword(c *gin.Context) {
-	userID, _ := c.Get("userID")
+	userID := c.GetUint("userID")
 
 	var req models.ChangePassword
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -146,8 +165,8 @@ func (h *UserHandler) ChangePassword(c *gin.Context) {
 	}
 
 	// Get current user
-	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
+	user, err := h.store.Users().FindByID(userID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"message": "User not found",
@@ -157,6 +176,9 @@ func (h *UserHandler) ChangePassword(c *gin.Context) {
 
 	// Verify current password
 	if !utils.CheckPassword(req.CurrentPassword, user.Password) {
+		h.recordAudit(c, "user.password_change", &user.ID, models.AuditOutcomeFailure, gin.H{
+			"reason": "invalid_current_password",
+		})
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Current password is incorrect",
@@ -174,11 +196,42 @@ func (h *UserHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	// Update password
-	if err := database.DB.Model(&user).Updates(map[string]interface{}{
-		"password":            hashedPassword,
-		"password_changed_at": time.Now(),
-	}).Error; err != nil {
+	// Keep the session making the request alive if asked to
+	var keepSession *models.Session
+	if current := currentSession(c); req.KeepCurrentSession && current.ID != 0 {
+		keepSession = &current
+	}
+
+	// Update password and invalidate every token issued before
+	var tokenPair *utils.TokenPair
+	err = h.store.Transaction(func(tx repository.Store) error {
+		if err := tx.Users().Update(user.ID, map[string]interface{}{
+			"password":            hashedPassword,
+			"password_changed_at": time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		var keepSessionID uint
+		if keepSession != nil {
+			keepSessionID = keepSession.ID
+		}
+		if err := invalidateUserTokens(tx, user.ID, keepSessionID); err != nil {
+			return err
+		}
+
+		if keepSession == nil {
+			return nil
+		}
+		// Reload to pick up the new token version
+		user, err := tx.Users().FindByID(user.ID)
+		if err != nil {
+			return err
+		}
+		tokenPair, err = issueTokenPair(h.tokens, tx, user, keepSession, nil)
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": "Failed to update password",
@@ -186,6 +239,26 @@ func (h *UserHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
+	metrics.TokenRevocations.WithLabelValues("password_change").Inc()
+	if tokenPair != nil {
+		metrics.TokensIssued.WithLabelValues("password_change").Inc()
+	}
+
+	h.recordAudit(c, "user.password_change", &user.ID, models.AuditOutcomeSuccess, gin.H{
+		"keepCurrentSession": keepSession != nil,
+	})
+
+	if tokenPair != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Password changed successfully. Other sessions have been signed out.",
+			"data": gin.H{
+				"token": tokenPair,
+			},
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Password changed successfully",
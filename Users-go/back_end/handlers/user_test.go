@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/models"
+	"newworld-project/repository"
+	"newworld-project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeStore is an in-memory Store holding a single user. Repository methods
+// a test does not expect to be called are left to the embedded nil
+// interfaces and panic.
+type fakeStore struct {
+	user         models.User
+	events       []models.AuditEvent
+	revokedUsers []uint
+}
+
+type fakeUsers struct {
+	repository.UserRepository
+	s *fakeStore
+}
+
+type fakeSessions struct {
+	repository.SessionRepository
+	s *fakeStore
+}
+
+type fakeAudit struct {
+	s *fakeStore
+}
+
+func (s *fakeStore) Users() repository.UserRepository       { return fakeUsers{s: s} }
+func (s *fakeStore) Tokens() repository.TokenRepository     { return nil }
+func (s *fakeStore) Sessions() repository.SessionRepository { return fakeSessions{s: s} }
+func (s *fakeStore) MFA() repository.MFARepository          { return nil }
+func (s *fakeStore) Passkeys() repository.PasskeyRepository { return nil }
+func (s *fakeStore) Roles() repository.RoleRepository       { return nil }
+func (s *fakeStore) Audit() repository.AuditRepository      { return fakeAudit{s: s} }
+func (s *fakeStore) Outbox() repository.OutboxRepository    { return nil }
+func (s *fakeStore) Jobs() repository.JobRepository         { return nil }
+
+func (s *fakeStore) Transaction(fn func(tx repository.Store) error) error {
+	return fn(s)
+}
+
+func (r fakeUsers) FindByID(id uint) (*models.User, error) {
+	if id != r.s.user.ID {
+		return nil, repository.ErrNotFound
+	}
+	user := r.s.user
+	return &user, nil
+}
+
+func (r fakeUsers) Update(id uint, fields map[string]interface{}) error {
+	if password, ok := fields["password"].(string); ok {
+		r.s.user.Password = password
+	}
+	return nil
+}
+
+func (r fakeUsers) IncrementTokenVersion(id uint) error {
+	r.s.user.TokenVersion++
+	return nil
+}
+
+func (r fakeSessions) RevokeUserRefreshTokens(userID uint, at time.Time) error {
+	return nil
+}
+
+func (r fakeSessions) RevokeUserSessions(userID, keepSessionID uint, at time.Time) (int64, error) {
+	r.s.revokedUsers = append(r.s.revokedUsers, userID)
+	return 0, nil
+}
+
+func (r fakeAudit) Create(event *models.AuditEvent) error {
+	r.s.events = append(r.s.events, *event)
+	return nil
+}
+
+func (r fakeAudit) List(filter repository.AuditFilter, beforeID uint, limit int) ([]models.AuditEvent, error) {
+	return r.s.events, nil
+}
+
+func TestChangePasswordWithFakeStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	previousConfig := config.ConfigInstance
+	t.Cleanup(func() { config.ConfigInstance = previousConfig })
+	cfg := &config.Config{Security: config.SecurityConfig{BcryptCost: 4}}
+	config.ConfigInstance = cfg
+
+	hash, _ := utils.HashPassword("old-password")
+	store := &fakeStore{user: models.User{ID: 7, Username: "alice", Password: hash, Role: "user", Status: "active"}}
+
+	h := NewUserHandler(cfg, store, nil, nil)
+	r := gin.New()
+	r.POST("/users/change-password", func(c *gin.Context) {
+		c.Set("userID", uint(7))
+		c.Next()
+	}, h.ChangePassword)
+
+	changePassword := func(current string) int {
+		body, _ := json.Marshal(gin.H{
+			"currentPassword": current,
+			"newPassword":     "new-password",
+			"confirmPassword": "new-password",
+		})
+		req := httptest.NewRequest(http.MethodPost, "/users/change-password", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := changePassword("wrong-password"); code != http.StatusBadRequest {
+		t.Fatalf("wrong current password: status %d", code)
+	}
+	if len(store.events) != 1 || store.events[0].Outcome != models.AuditOutcomeFailure {
+		t.Fatalf("failed change not audited: %+v", store.events)
+	}
+	if store.user.TokenVersion != 0 {
+		t.Error("tokens invalidated after failed change")
+	}
+
+	if code := changePassword("old-password"); code != http.StatusOK {
+		t.Fatalf("change password: status %d", code)
+	}
+	if !utils.CheckPassword("new-password", store.user.Password) {
+		t.Error("new password not stored")
+	}
+	if store.user.TokenVersion != 1 || len(store.revokedUsers) != 1 {
+		t.Errorf("tokens not invalidated: version %d, revoked %v", store.user.TokenVersion, store.revokedUsers)
+	}
+	if last := store.events[len(store.events)-1]; last.Action != "user.password_change" || last.Outcome != models.AuditOutcomeSuccess {
+		t.Errorf("successful change not audited: %+v", last)
+	}
+}
@@ -0,0 +1,180 @@
+// Package logging sets up structured logging with log/slog. Each subsystem
+// logs through its own logger, whose level can be set separately; secrets
+// are redacted from every record and records logged with a request's
+// context carry its request ID.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// The subsystems that log, for Logger and per-subsystem levels
+const (
+	Config    = "config"
+	DB        = "db"
+	HTTP      = "http"
+	Mailer    = "mailer"
+	Outbox    = "outbox"
+	Scheduler = "scheduler"
+	Server    = "server"
+)
+
+// Subsystems lists every subsystem a level can be set for
+var Subsystems = []string{Config, DB, HTTP, Mailer, Outbox, Scheduler, Server}
+
+// Options configures Setup. Level applies to subsystems without an entry in
+// Levels; Format is json or text.
+type Options struct {
+	Level  string
+	Format string
+	Levels map[string]string
+}
+
+// output is the handler and levels records are written with. Loggers
+// returned by Logger look it up on every record, so they can be created
+// before Setup runs.
+type output struct {
+	handler     slog.Handler
+	level       slog.Level
+	bySubsystem map[string]slog.Level
+}
+
+var current atomic.Pointer[output]
+
+func init() {
+	current.Store(&output{handler: newHandler(log.Writer(), "text"), level: slog.LevelInfo})
+}
+
+// Setup writes logs to w with opts and makes the standard library's log and
+// slog default loggers write through it
+func Setup(w io.Writer, opts Options) error {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+	if opts.Format != "json" && opts.Format != "text" {
+		return fmt.Errorf("invalid log format %q: must be json or text", opts.Format)
+	}
+	bySubsystem := make(map[string]slog.Level, len(opts.Levels))
+	for subsystem, name := range opts.Levels {
+		if !IsSubsystem(subsystem) {
+			return fmt.Errorf("unknown log subsystem %q", subsystem)
+		}
+		if bySubsystem[subsystem], err = ParseLevel(name); err != nil {
+			return err
+		}
+	}
+
+	current.Store(&output{handler: newHandler(w, opts.Format), level: level, bySubsystem: bySubsystem})
+	slog.SetDefault(slog.New(&subsystemHandler{}))
+	return nil
+}
+
+// Logger returns the logger for a subsystem
+func Logger(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{subsystem: subsystem})
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", name)
+}
+
+// IsSubsystem reports whether name is one of Subsystems
+func IsSubsystem(name string) bool {
+	for _, subsystem := range Subsystems {
+		if name == subsystem {
+			return true
+		}
+	}
+	return false
+}
+
+func newHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: redactAttr}
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose log records carry id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored by WithRequestID, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// subsystemHandler filters records by its subsystem's level and passes them
+// to the current output with the subsystem and request ID added
+type subsystemHandler struct {
+	subsystem string
+	// ops replays WithAttrs and WithGroup calls on the current handler
+	ops []func(slog.Handler) slog.Handler
+}
+
+func (h *subsystemHandler) Enabled(_ context.Context, level slog.Level) bool {
+	out := current.Load()
+	min, ok := out.bySubsystem[h.subsystem]
+	if !ok {
+		min = out.level
+	}
+	return level >= min
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, r slog.Record) error {
+	var attrs []slog.Attr
+	if h.subsystem != "" {
+		attrs = append(attrs, slog.String("subsystem", h.subsystem))
+	}
+	if ctx != nil {
+		if id := RequestID(ctx); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+	}
+
+	handler := current.Load().handler
+	if len(attrs) > 0 {
+		handler = handler.WithAttrs(attrs)
+	}
+	for _, op := range h.ops {
+		handler = op(handler)
+	}
+	return handler.Handle(ctx, r)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *subsystemHandler) with(op func(slog.Handler) slog.Handler) slog.Handler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &subsystemHandler{subsystem: h.subsystem, ops: append(ops, op)}
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKey matches attribute names whose values are never logged
+var sensitiveKey = regexp.MustCompile(`(?i)password|passwd|secret|token|authorization|cookie|api_?key|credential|recovery_?code`)
+
+// sensitiveValues match secrets inside otherwise loggable strings, such as
+// error messages, URLs and connection strings
+var sensitiveValues = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Authorization header values
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), "$1 " + redacted},
+	// JWTs anywhere, such as in a URL
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), redacted},
+	// key=value pairs in query strings and DSNs
+	{regexp.MustCompile(`(?i)\b(password|passwd|pwd|secret|token|code)=[^\s&"']+`), "$1=" + redacted},
+}
+
+// redactAttr is the slog ReplaceAttr function that removes secrets from
+// every record
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+	if sensitiveKey.MatchString(a.Key) {
+		if a.Value.Kind() == slog.KindString && a.Value.String() == "" {
+			return a
+		}
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
+
+// Redact replaces the secrets found in s
+func Redact(s string) string {
+	for _, v := range sensitiveValues {
+		s = v.pattern.ReplaceAllString(s, v.replacement)
+	}
+	return s
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes every message as an .eml file into a directory, where it
+// can be opened with a mail client
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create email directory: %w", err)
+	}
+
+	// Timestamped names keep the files in the order they were sent
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(suffix) + ".eml"
+
+	file, err := os.Create(filepath.Join(m.dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := msg.build(m.from).WriteTo(file); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return file.Close()
+}
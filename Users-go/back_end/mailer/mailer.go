@@ -0,0 +1,59 @@
+// Package mailer delivers outgoing email through a transport chosen by
+// configuration: SMTP in production, or files, the log or memory when
+// developing and testing without a mail server.
+package mailer
+
+import (
+	"fmt"
+	"time"
+
+	"newworld-project/config"
+
+	"gopkg.in/gomail.v2"
+)
+
+// Message is an email to a single recipient. When Text is set it is sent as
+// the plain-text alternative to HTML.
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the Mailer for the configured transport
+func New(cfg config.EmailConfig) (Mailer, error) {
+	switch cfg.Transport {
+	case "", "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "file":
+		return NewFileMailer(cfg.Dir, cfg.From), nil
+	case "log":
+		return NewLogMailer(cfg.From), nil
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown email transport %q: must be smtp, file, log or memory", cfg.Transport)
+	}
+}
+
+// build turns msg into a MIME message sent from the given address
+func (msg Message) build(from string) *gomail.Message {
+	m := gomail.NewMessage()
+	m.SetHeader("From", from)
+	m.SetHeader("To", msg.To)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetDateHeader("Date", time.Now())
+	if msg.Text != "" {
+		m.SetBody("text/plain", msg.Text)
+		m.AddAlternative("text/html", msg.HTML)
+	} else {
+		m.SetBody("text/html", msg.HTML)
+	}
+	return m
+}
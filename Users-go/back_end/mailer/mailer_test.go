@@ -0,0 +1,140 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"newworld-project/config"
+	"newworld-project/logging"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		transport string
+		want      Mailer
+	}{
+		{"", &SMTPMailer{}},
+		{"smtp", &SMTPMailer{}},
+		{"file", &FileMailer{}},
+		{"log", &LogMailer{}},
+		{"memory", &MemoryMailer{}},
+	}
+	for _, tt := range tests {
+		m, err := New(config.EmailConfig{Transport: tt.transport})
+		if err != nil {
+			t.Errorf("%q: %v", tt.transport, err)
+			continue
+		}
+		if got, want := fmt.Sprintf("%T", m), fmt.Sprintf("%T", tt.want); got != want {
+			t.Errorf("%q: got %s, want %s", tt.transport, got, want)
+		}
+	}
+
+	if _, err := New(config.EmailConfig{Transport: "pigeon"}); err == nil {
+		t.Error("unknown transport accepted")
+	}
+}
+
+func TestLogMailerRedactsTokens(t *testing.T) {
+	var buf bytes.Buffer
+	if err := logging.Setup(&buf, logging.Options{Level: "info", Format: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logging.Setup(os.Stderr, logging.Options{Level: "info", Format: "text"}) })
+
+	m := NewLogMailer("noreply@example.com")
+	if err := m.Send(Message{To: "alice@example.com", Subject: "Verify", Text: "Open https://example.com/verify-email?token=0123456789abcdef"}); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "https://example.com/verify-email") || strings.Contains(out, "0123456789abcdef") {
+		t.Errorf("logged email = %s", out)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := NewFileMailer(dir, "noreply@example.com")
+
+	for _, to := range []string{"alice@example.com", "bob@example.com"} {
+		if err := m.Send(Message{To: to, Subject: "Hello", HTML: "<p>Hi</p>"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("got %d .eml files, want 2 (%v)", len(files), err)
+	}
+
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	msg, err := mail.ReadMessage(file)
+	if err != nil {
+		t.Fatalf("invalid .eml file: %v", err)
+	}
+	if msg.Header.Get("From") != "noreply@example.com" || msg.Header.Get("To") != "alice@example.com" || msg.Header.Get("Subject") != "Hello" {
+		t.Errorf("unexpected headers %v", msg.Header)
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+	m.Send(Message{To: "alice@example.com", Subject: "One"})
+	m.Send(Message{To: "bob@example.com", Subject: "Two"})
+
+	messages := m.Messages()
+	if len(messages) != 2 || messages[0].Subject != "One" || messages[1].Subject != "Two" {
+		t.Fatalf("unexpected messages %v", messages)
+	}
+
+	// The returned slice is a copy
+	messages[0].Subject = "Changed"
+	if m.Messages()[0].Subject != "One" {
+		t.Error("Messages exposes internal state")
+	}
+}
+
+func TestMessageAlternatives(t *testing.T) {
+	var buf bytes.Buffer
+	msg := Message{To: "alice@example.com", Subject: "Hello", HTML: "<p>Hi</p>", Text: "Hi"}
+	if _, err := msg.build("noreply@example.com").WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v), want multipart/alternative", mediaType, err)
+	}
+
+	// The preferred HTML part comes last
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, strings.Split(part.Header.Get("Content-Type"), ";")[0])
+	}
+	if len(types) != 2 || types[0] != "text/plain" || types[1] != "text/html" {
+		t.Errorf("parts = %v, want [text/plain text/html]", types)
+	}
+}
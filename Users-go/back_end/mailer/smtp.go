@@ -0,0 +1,29 @@
+package mailer
+
+import (
+	"fmt"
+
+	"newworld-project/config"
+
+	"gopkg.in/gomail.v2"
+)
+
+// SMTPMailer sends each message over a new connection to an SMTP server
+type SMTPMailer struct {
+	dialer *gomail.Dialer
+	from   string
+}
+
+func NewSMTPMailer(cfg config.EmailConfig) *SMTPMailer {
+	return &SMTPMailer{
+		dialer: gomail.NewDialer(cfg.Host, cfg.Port, cfg.Username, cfg.Password),
+		from:   cfg.From,
+	}
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := m.dialer.DialAndSend(msg.build(m.from)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
@@ -3,42 +3,115 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
+	"newworld-project/app"
 	"newworld-project/config"
 	"newworld-project/database"
+	"newworld-project/logging"
+	"newworld-project/metrics"
 	"newworld-project/routes"
+	"newworld-project/server"
 )
 
+var logger = logging.Logger(logging.Server)
+
+// fatal logs msg with err and exits
+func fatal(msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
 func main() {
+	// "config print [--redacted]" shows the effective configuration and exits
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		runConfigCommand(os.Args[2:])
+		return
+	}
+
 	// Load configuration
 	config.LoadConfig()
 
+	// "migrate up|down [steps]|status" manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(os.Args[2:])
+		return
+	}
+
 	// Connect to database
-	database.ConnectDB()
+	db := database.ConnectDB(config.ConfigInstance)
 
 	// Setup routes
-	r := routes.SetupRoutes()
+	a, err := app.New(config.ConfigInstance, db)
+	if err != nil {
+		fatal("Failed to set up application", err)
+	}
+	r := routes.SetupRoutes(a)
 
-	// Create server
-	serverAddr := fmt.Sprintf("%s:%s", config.ConfigInstance.Server.Host, config.ConfigInstance.Server.Port)
-	server := &http.Server{
-		Addr:    serverAddr,
-		Handler: r,
+	// Bind before starting background work so a taken port fails fast
+	cfg := config.ConfigInstance.Server
+	listener, err := server.Listen(cfg)
+	if err != nil {
+		fatal("Failed to start server", err)
+	}
+
+	// Serve the metrics on a listener of their own if one is configured
+	var metricsSrv *http.Server
+	if metricsCfg := config.ConfigInstance.Metrics; metricsCfg.Enabled && metricsCfg.Listen != "" {
+		metricsListener, err := net.Listen("tcp", metricsCfg.Listen)
+		if err != nil {
+			fatal("Failed to start metrics listener", err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsSrv = server.New(cfg, mux)
+		go func() {
+			logger.Info("Metrics available", "url", fmt.Sprintf("http://%s/metrics", metricsListener.Addr()))
+			if err := metricsSrv.Serve(metricsListener); err != nil && err != http.ErrServerClosed {
+				fatal("Failed to serve metrics", err)
+			}
+		}()
 	}
 
+	// Deliver queued emails in the background until shutdown
+	outboxCtx, stopOutbox := context.WithCancel(context.Background())
+	outboxDone := make(chan struct{})
+	go func() {
+		defer close(outboxDone)
+		a.Outbox.Run(outboxCtx)
+	}()
+
+	// Run the scheduled jobs until shutdown
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		a.Scheduler.Run(schedulerCtx)
+	}()
+
+	// Create server
+	srv := server.New(cfg, r)
+
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Server starting on %s", serverAddr)
-		log.Printf("API Documentation available at: http://%s/api/v1", serverAddr)
-		log.Printf("Health check available at: http://%s/health", serverAddr)
-		
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal("Failed to start server:", err)
+		addr := listener.Addr()
+		logger.Info("Server listening", "network", addr.Network(), "address", addr.String(), "tls", cfg.TLS.Enabled())
+		if addr.Network() == "tcp" {
+			scheme := "http"
+			if cfg.TLS.Enabled() {
+				scheme = "https"
+			}
+			logger.Info("API Documentation available", "url", fmt.Sprintf("%s://%s/api/v1", scheme, addr))
+			logger.Info("Health check available", "url", fmt.Sprintf("%s://%s/health", scheme, addr))
+		}
+
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			fatal("Failed to start server", err)
 		}
 	}()
 
@@ -46,14 +119,105 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+	logger.Info("Shutting down server")
 
-	// The context is used to inform the server it has 5 seconds to finish
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// The context is used to inform the server how long it has to finish
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
 	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+	if err := srv.Shutdown(ctx); err != nil {
+		fatal("Server forced to shutdown", err)
 	}
+	if metricsSrv != nil {
+		metricsSrv.Shutdown(ctx)
+	}
+
+	// Let emails already being sent finish; the rest stay queued
+	stopOutbox()
+	<-outboxDone
 
-	log.Println("Server exiting")
-} 
\ No newline at end of file
+	// Stop the job that is running, if any; its slot is not retried
+	stopScheduler()
+	<-schedulerDone
+
+	logger.Info("Server exiting")
+}
+
+// runMigrateCommand applies, rolls back or lists database migrations
+func runMigrateCommand(args []string) {
+	db, err := database.Open(config.ConfigInstance.Database)
+	if err != nil {
+		fatal("Failed to connect to database", err)
+	}
+
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := database.MigrateUp(db)
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fatal("Migration failed", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "invalid number of steps %q\n", args[1])
+				os.Exit(2)
+			}
+		}
+		rolledBack, err := database.MigrateDown(db, steps)
+		for _, migration := range rolledBack {
+			fmt.Printf("Rolled back %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fatal("Rollback failed", err)
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("No applied migrations")
+		}
+	case "status":
+		states, err := database.MigrationStatus(db)
+		if err != nil {
+			fatal("Failed to read migration status", err)
+		}
+		for _, state := range states {
+			status := "pending"
+			if state.AppliedAt != nil {
+				status = "applied " + state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-40s %s\n", state.Version, state.Name, status)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "usage: migrate up | down [steps] | status")
+		os.Exit(2)
+	}
+}
+
+// runConfigCommand prints the effective configuration and where each value
+// came from, then reports whether it is valid
+func runConfigCommand(args []string) {
+	if len(args) == 0 || args[0] != "print" || len(args) > 2 || (len(args) == 2 && args[1] != "--redacted") {
+		fmt.Fprintln(os.Stderr, "usage: config print [--redacted]")
+		os.Exit(2)
+	}
+
+	cfg, err := config.Read()
+	if err != nil {
+		fatal("Failed to read configuration", err)
+	}
+	if err := cfg.Print(os.Stdout, len(args) == 2); err != nil {
+		fatal("Failed to print configuration", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal("Configuration check failed", err)
+	}
+}
@@ -0,0 +1,121 @@
+// Package metrics defines the Prometheus metrics the application exports
+// and the handler that serves them.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every application metric
+const namespace = "newworld"
+
+// Registry holds the application's metrics along with the Go runtime and
+// process collectors
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// HTTPRequests counts handled requests by method, route and status.
+	// Requests that matched no route are counted under the route "unmatched".
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes how long requests took to handle
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// Logins counts login attempts by method (password, mfa or passkey),
+	// outcome and failure reason, which is empty for successful logins
+	Logins = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_logins_total",
+		Help:      "Login attempts, by method, outcome and failure reason.",
+	}, []string{"method", "outcome", "reason"})
+
+	// TokensIssued counts token pairs issued, by grant: login for new
+	// sessions, refresh for rotations and password_change for the pair
+	// handed back after a password change
+	TokensIssued = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_tokens_issued_total",
+		Help:      "Token pairs issued, by grant.",
+	}, []string{"grant"})
+
+	// TokenRefreshes counts refresh requests by outcome: success, invalid
+	// or reused
+	TokenRefreshes = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_token_refreshes_total",
+		Help:      "Refresh token exchanges, by outcome.",
+	}, []string{"outcome"})
+
+	// TokenRevocations counts revocations of sessions and their tokens by
+	// reason
+	TokenRevocations = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_token_revocations_total",
+		Help:      "Session and token revocations, by reason.",
+	}, []string{"reason"})
+
+	// EmailDeliveries counts delivery attempts by the outbox worker by
+	// outcome: sent, retry or dead
+	EmailDeliveries = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "email_deliveries_total",
+		Help:      "Email delivery attempts, by outcome.",
+	}, []string{"outcome"})
+
+	// PasswordHashDuration observes bcrypt's time to hash or verify a
+	// password
+	PasswordHashDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "password_hash_duration_seconds",
+		Help:      "Time taken by bcrypt, by operation (hash or verify).",
+		Buckets:   []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"operation"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+var (
+	dbStatsMu sync.Mutex
+	dbStats   prometheus.Collector
+)
+
+// RegisterDB exports the connection pool statistics of db, replacing the
+// database registered before
+func RegisterDB(db *sql.DB) error {
+	dbStatsMu.Lock()
+	defer dbStatsMu.Unlock()
+
+	if dbStats != nil {
+		Registry.Unregister(dbStats)
+	}
+	dbStats = collectors.NewDBStatsCollector(db, "main")
+	return Registry.Register(dbStats)
+}
+
+// Handler serves the registered metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -3,18 +3,38 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
 
-	"newworld-project/database"
-	"newworld-project/models"
+	"newworld-project/repository"
 	"newworld-project/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// sessionTouchInterval limits how often a session's last-used time is written
+const sessionTouchInterval = time.Minute
+
+// ServiceIdentity is an internal caller authenticated by its TLS client
+// certificate instead of a user's token
+type ServiceIdentity struct {
+	Name string
+	Role string
+}
+
+// AuthMiddleware validates the request's bearer token with tokens and checks
+// it against the sessions and users in store. A request without one is
+// accepted from a service whose verified TLS client certificate is listed in
+// services, which maps certificate subjects to roles.
+func AuthMiddleware(tokens *utils.TokenService, store repository.Store, services map[string]string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
+			if service, ok := clientCertService(c.Request, services); ok {
+				c.Set("service", service)
+				c.Set("role", service.Role)
+				c.Next()
+				return
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
 				"message": "Authorization header is required",
@@ -36,31 +56,30 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := tokenParts[1]
 
-		// Check if token is blacklisted
-		var blacklistedToken models.TokenBlacklist
-		if err := database.DB.Where("token = ?", tokenString).First(&blacklistedToken).Error; err == nil {
+		// Validate token
+		claims, err := tokens.ValidateAccessToken(tokenString)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
-				"message": "Token has been revoked",
+				"message": "Invalid or expired token",
 			})
 			c.Abort()
 			return
 		}
 
-		// Validate token
-		claims, err := utils.ValidateToken(tokenString)
-		if err != nil {
+		// Check if token is blacklisted
+		if blacklisted, err := store.Tokens().IsBlacklisted(claims.ID); err == nil && blacklisted {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
-				"message": "Invalid or expired token",
+				"message": "Token has been revoked",
 			})
 			c.Abort()
 			return
 		}
 
 		// Check if user exists and is active
-		var user models.User
-		if err := database.DB.Where("id = ? AND status = ?", claims.UserID, "active").First(&user).Error; err != nil {
+		user, err := store.Users().FindByID(claims.UserID)
+		if err != nil || user.Status != "active" {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
 				"message": "User not found or inactive",
@@ -69,17 +88,84 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Reject tokens issued before the last password change
+		if claims.TokenVersion != user.TokenVersion {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "Token has been invalidated, please log in again",
+			})
+			c.Abort()
+			return
+		}
+
+		// Check that the session the token was issued to is still signed in
+		session, err := store.Sessions().FindActiveSession(claims.SessionID, claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "Session has been revoked",
+			})
+			c.Abort()
+			return
+		}
+
+		// Record activity at most once a minute per session
+		if time.Since(session.LastUsedAt) > sessionTouchInterval {
+			store.Sessions().TouchSession(session.ID, time.Now())
+		}
+
 		// Set user info in context
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("email", claims.Email)
 		c.Set("role", claims.Role)
-		c.Set("user", user)
+		c.Set("user", *user)
+		c.Set("session", *session)
 
 		c.Next()
 	}
 }
 
+// RequireUser rejects services authenticated by client certificate, for
+// routes that act on the signed-in user. It must run after AuthMiddleware.
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("user"); !exists {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "This endpoint requires a user account",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// clientCertService returns the service the request's verified client
+// certificate identifies. The certificate's URI and DNS names are matched
+// first, then its common name.
+func clientCertService(r *http.Request, services map[string]string) (ServiceIdentity, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ServiceIdentity{}, false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	var subjects []string
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, uri.String())
+	}
+	subjects = append(subjects, cert.DNSNames...)
+	subjects = append(subjects, cert.Subject.CommonName)
+	for _, subject := range subjects {
+		if role, ok := services[subject]; ok {
+			return ServiceIdentity{Name: subject, Role: role}, true
+		}
+	}
+	return ServiceIdentity{}, false
+}
+
 func RoleMiddleware(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userRole, exists := c.Get("role")
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"newworld-project/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthMiddlewareClientCertificate(t *testing.T) {
+	_, checker := setupRBACTest(t)
+	gin.SetMode(gin.TestMode)
+
+	spiffe, _ := url.Parse("spiffe://corp/reporting")
+	services := map[string]string{
+		"billing.internal":        models.RoleAdmin,
+		"spiffe://corp/reporting": models.RoleUser,
+	}
+	// The token service and store are not used for services
+	auth := AuthMiddleware(nil, nil, services)
+
+	request := func(path string, cert *x509.Certificate) int {
+		r := gin.New()
+		ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+		r.GET("/admin", auth, RequirePermission(checker, models.PermissionUsersRead), ok)
+		r.GET("/profile", auth, RequireUser(), ok)
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tests := []struct {
+		name string
+		path string
+		cert *x509.Certificate
+		want int
+	}{
+		{"common name", "/admin", &x509.Certificate{Subject: pkix.Name{CommonName: "billing.internal"}}, http.StatusOK},
+		{"URI name", "/admin", &x509.Certificate{URIs: []*url.URL{spiffe}, Subject: pkix.Name{CommonName: "billing.internal"}}, http.StatusForbidden},
+		{"unknown certificate", "/admin", &x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}}, http.StatusUnauthorized},
+		{"no certificate", "/admin", nil, http.StatusUnauthorized},
+		{"user-only route", "/profile", &x509.Certificate{DNSNames: []string{"billing.internal"}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if code := request(tt.path, tt.cert); code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, code, tt.want)
+		}
+	}
+}
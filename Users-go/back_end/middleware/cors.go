@@ -15,11 +15,12 @@ func CORSMiddleware() gin.HandlerFunc {
 		"Accept", 
 		"Authorization", 
 		"X-Requested-With",
+		RequestIDHeader,
 		"Access-Control-Request-Method",
 		"Access-Control-Request-Headers",
 	}
 	config.AllowCredentials = true
-	config.ExposeHeaders = []string{"Content-Length", "Content-Type"}
+	config.ExposeHeaders = []string{"Content-Length", "Content-Type", RequestIDHeader}
 
 	return cors.New(config)
 } 
\ No newline at end of file
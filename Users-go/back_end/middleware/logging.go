@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"newworld-project/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits the request IDs accepted from clients to ones that
+// are safe to log and echo back
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID gives every request an ID, taken from the X-Request-ID header if
+// the client or a proxy sent a valid one. The ID is returned in the
+// X-Request-ID response header and as requestId in JSON error responses,
+// and logs written with the request's context carry it.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		c.Set("requestID", id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+		c.Writer = &requestIDWriter{ResponseWriter: c.Writer, id: id}
+
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDWriter adds the request ID to JSON error responses, which every
+// handler writes in a single call
+type requestIDWriter struct {
+	gin.ResponseWriter
+	id      string
+	written bool
+}
+
+func (w *requestIDWriter) Write(data []byte) (int, error) {
+	if w.written || w.Status() < http.StatusBadRequest ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") ||
+		len(data) < 2 || data[0] != '{' {
+		w.written = true
+		return w.ResponseWriter.Write(data)
+	}
+	w.written = true
+
+	field := `"requestId":"` + w.id + `"`
+	if data[1] != '}' {
+		field += ","
+	}
+	withID := make([]byte, 0, len(data)+len(field))
+	withID = append(withID, '{')
+	withID = append(withID, field...)
+	withID = append(withID, data[1:]...)
+	if _, err := w.ResponseWriter.Write(withID); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// RequestLogger logs every request to the http subsystem once it has been
+// handled. Server errors are logged as errors.
+func RequestLogger() gin.HandlerFunc {
+	logger := logging.Logger(logging.HTTP)
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		ctx := c.Request.Context()
+		if !logger.Enabled(ctx, level) {
+			return
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if query := c.Request.URL.RawQuery; query != "" {
+			attrs = append(attrs, slog.String("query", query))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		logger.LogAttrs(ctx, level, "Request", attrs...)
+	}
+}
+
+// Recovery turns a panic in a handler into a 500 response and logs it with
+// its stack trace
+func Recovery() gin.HandlerFunc {
+	logger := logging.Logger(logging.HTTP)
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		logger.ErrorContext(c.Request.Context(), "Panic while handling request",
+			"error", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Internal server error",
+		})
+	})
+}
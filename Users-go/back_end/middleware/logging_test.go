@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"newworld-project/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestIDAndRequestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	if err := logging.Setup(&logs, logging.Options{Level: "info", Format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	defer logging.Setup(os.Stderr, logging.Options{Level: "info", Format: "text"})
+
+	r := gin.New()
+	r.Use(RequestID(), RequestLogger(), Recovery())
+	r.GET("/ok", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	})
+	r.GET("/missing", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "User not found"})
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	request := func(path, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// A valid incoming ID is kept; success bodies are left alone
+	w := request("/ok?token=secret-1", "abc-123")
+	if got := w.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("response ID = %q", got)
+	}
+	if w.Body.String() != `{"success":true}` {
+		t.Errorf("success body = %s", w.Body)
+	}
+
+	// An invalid one is replaced; error bodies carry the ID
+	w = request("/missing", "not valid\n")
+	id := w.Header().Get(RequestIDHeader)
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body %s: %v", w.Body, err)
+	}
+	if len(id) != 32 || body["requestId"] != id || body["message"] != "User not found" {
+		t.Errorf("ID %q, error body %v", id, body)
+	}
+
+	w = request("/panic", "")
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), `"requestId":"`) {
+		t.Errorf("panic response %d %s", w.Code, w.Body)
+	}
+
+	out := logs.String()
+	if !strings.Contains(out, `"request_id":"abc-123"`) || !strings.Contains(out, `"route":"/ok"`) {
+		t.Errorf("request not logged with its ID:\n%s", out)
+	}
+	if strings.Contains(out, "secret-1") {
+		t.Errorf("query token logged:\n%s", out)
+	}
+	if !strings.Contains(out, "Panic while handling request") || !strings.Contains(out, `"status":500`) {
+		t.Errorf("panic not logged:\n%s", out)
+	}
+}
@@ -0,0 +1,274 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/logging"
+	"newworld-project/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RateLimitStore counts hits per bucket in fixed windows.
+type RateLimitStore interface {
+	// Increment records a hit for bucket and returns the number of hits in
+	// the current window and when that window resets.
+	Increment(bucket string, window time.Duration) (int, time.Time, error)
+}
+
+// RateLimitPolicy limits requests that share a key, e.g. a client IP or an
+// account identifier, to Requests per Window.
+type RateLimitPolicy struct {
+	Name     string
+	Requests int
+	Window   time.Duration
+	// Key returns the value requests are grouped by, or "" to skip the policy.
+	Key func(c *gin.Context) string
+}
+
+// RateLimitMiddleware enforces the given policies in order and rejects the
+// request with 429 as soon as one of them is exceeded. RateLimit-* headers
+// describe the most restrictive policy that applied.
+func RateLimitMiddleware(store RateLimitStore, policies ...RateLimitPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			reported  bool
+			limit     int
+			remaining int
+			resetAt   time.Time
+		)
+
+		for _, policy := range policies {
+			if policy.Requests <= 0 || policy.Window <= 0 {
+				continue
+			}
+
+			key := policy.Key(c)
+			if key == "" {
+				continue
+			}
+
+			count, reset, err := store.Increment(policy.Name+":"+key, policy.Window)
+			if err != nil {
+				// Fail open: an unavailable store must not take the API down
+				logging.Logger(logging.HTTP).ErrorContext(c.Request.Context(), "Rate limit store error", "error", err)
+				continue
+			}
+
+			left := policy.Requests - count
+			if left < 0 {
+				left = 0
+			}
+			if !reported || left < remaining {
+				reported = true
+				limit, remaining, resetAt = policy.Requests, left, reset
+			}
+
+			if count > policy.Requests {
+				setRateLimitHeaders(c, limit, remaining, resetAt)
+				c.Header("Retry-After", strconv.Itoa(secondsUntil(resetAt)))
+				c.JSON(http.StatusTooManyRequests, gin.H{
+					"success": false,
+					"message": "Too many requests, please try again later",
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		if reported {
+			setRateLimitHeaders(c, limit, remaining, resetAt)
+		}
+
+		c.Next()
+	}
+}
+
+func setRateLimitHeaders(c *gin.Context, limit, remaining int, resetAt time.Time) {
+	c.Header("RateLimit-Limit", strconv.Itoa(limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(secondsUntil(resetAt)))
+}
+
+func secondsUntil(t time.Time) int {
+	seconds := int(math.Ceil(time.Until(t).Seconds()))
+	if seconds < 0 {
+		return 0
+	}
+	return seconds
+}
+
+// ClientIPKey groups requests by client IP.
+func ClientIPKey(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// UserKey groups requests by the authenticated user, for endpoints where the
+// account comes from the access token rather than the request body.
+func UserKey(c *gin.Context) string {
+	userID, ok := c.Get("userID")
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("user=%v", userID)
+}
+
+// AccountKey groups requests by the first non-empty account identifier found
+// among the given JSON body fields, e.g. "email" or "username". The body is
+// left intact for the handler.
+func AccountKey(fields ...string) func(c *gin.Context) string {
+	return func(c *gin.Context) string {
+		if c.Request.Body == nil {
+			return ""
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+		if err != nil {
+			return ""
+		}
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return ""
+		}
+
+		for _, field := range fields {
+			if value, ok := payload[field].(string); ok {
+				if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+					return field + "=" + value
+				}
+			}
+		}
+
+		return ""
+	}
+}
+
+// NewRateLimitStore returns the store selected by RATE_LIMIT_STORE. The
+// database store shares counters between instances through db.
+func NewRateLimitStore(cfg config.SecurityConfig, db *gorm.DB) RateLimitStore {
+	if cfg.RateLimitStore == "database" {
+		return NewDatabaseRateLimitStore(db)
+	}
+	return NewMemoryRateLimitStore()
+}
+
+type memoryRateLimitEntry struct {
+	count   int
+	resetAt time.Time
+}
+
+// MemoryRateLimitStore keeps counters in process memory. It is suitable for a
+// single instance only.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryRateLimitEntry
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		entries:   make(map[string]*memoryRateLimitEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryRateLimitStore) Increment(bucket string, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop expired windows once a minute so idle keys do not accumulate
+	if now.Sub(s.lastSweep) > time.Minute {
+		for key, entry := range s.entries {
+			if !now.Before(entry.resetAt) {
+				delete(s.entries, key)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	entry, ok := s.entries[bucket]
+	if !ok || !now.Before(entry.resetAt) {
+		entry = &memoryRateLimitEntry{resetAt: now.Add(window)}
+		s.entries[bucket] = entry
+	}
+	entry.count++
+
+	return entry.count, entry.resetAt, nil
+}
+
+// DatabaseRateLimitStore keeps counters in the rate_limit_counters table so
+// that every instance behind a load balancer enforces the same limits.
+type DatabaseRateLimitStore struct {
+	db *gorm.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewDatabaseRateLimitStore(db *gorm.DB) *DatabaseRateLimitStore {
+	return &DatabaseRateLimitStore{db: db, lastSweep: time.Now()}
+}
+
+func (s *DatabaseRateLimitStore) Increment(bucket string, window time.Duration) (int, time.Time, error) {
+	now := time.Now()
+	s.sweep(now)
+
+	counter := models.RateLimitCounter{
+		Bucket:  bucket,
+		Count:   1,
+		ResetAt: now.Add(window),
+	}
+
+	// Start a new window if the stored one has expired, otherwise count the hit
+	err := s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "bucket"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":    gorm.Expr("CASE WHEN rate_limit_counters.reset_at <= ? THEN 1 ELSE rate_limit_counters.count + 1 END", now),
+			"reset_at": gorm.Expr("CASE WHEN rate_limit_counters.reset_at <= ? THEN ? ELSE rate_limit_counters.reset_at END", now, counter.ResetAt),
+		}),
+	}).Create(&counter).Error
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	if err := s.db.Where("bucket = ?", bucket).First(&counter).Error; err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return counter.Count, counter.ResetAt, nil
+}
+
+// sweep deletes expired windows once a minute, so buckets for IPs and
+// accounts that are never seen again do not accumulate. A failure is only
+// logged, as the next sweep retries.
+func (s *DatabaseRateLimitStore) sweep(now time.Time) {
+	s.mu.Lock()
+	due := now.Sub(s.lastSweep) > time.Minute
+	if due {
+		s.lastSweep = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+
+	if err := s.db.Where("reset_at <= ?", now).Delete(&models.RateLimitCounter{}).Error; err != nil {
+		logging.Logger(logging.HTTP).Error("Failed to delete expired rate limit counters", "error", err)
+	}
+}
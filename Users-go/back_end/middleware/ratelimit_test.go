@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"newworld-project/database"
+	"newworld-project/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.POST("/login", RateLimitMiddleware(NewMemoryRateLimitStore(),
+		RateLimitPolicy{Name: "ip", Requests: 5, Window: time.Minute, Key: ClientIPKey},
+		RateLimitPolicy{Name: "account", Requests: 2, Window: time.Minute, Key: AccountKey("username", "email")},
+	), func(c *gin.Context) {
+		var body struct {
+			Username string `json:"username"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil || body.Username == "" {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	login := func(username string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"`+username+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		username  string
+		status    int
+		remaining string
+	}{
+		{"alice", http.StatusOK, "1"},
+		{"ALICE", http.StatusOK, "0"},
+		{"alice", http.StatusTooManyRequests, "0"},
+		{"bob", http.StatusOK, "1"},
+		{"carol", http.StatusOK, "0"}, // fifth request from this IP
+		{"dave", http.StatusTooManyRequests, "0"},
+	}
+
+	for i, tt := range tests {
+		w := login(tt.username)
+		if w.Code != tt.status {
+			t.Fatalf("request %d (%s): status = %d, want %d", i, tt.username, w.Code, tt.status)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != tt.remaining {
+			t.Errorf("request %d (%s): RateLimit-Remaining = %q, want %q", i, tt.username, got, tt.remaining)
+		}
+		if tt.status == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("request %d (%s): missing Retry-After", i, tt.username)
+		}
+	}
+}
+
+func TestMemoryRateLimitStoreWindow(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+
+	for want := 1; want <= 3; want++ {
+		count, _, _ := store.Increment("k", 20*time.Millisecond)
+		if count != want {
+			t.Fatalf("count = %d, want %d", count, want)
+		}
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if count, _, _ := store.Increment("k", 20*time.Millisecond); count != 1 {
+		t.Errorf("count after window = %d, want 1", count)
+	}
+}
+
+func TestDatabaseRateLimitStoreDeletesExpiredCounters(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=private"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	store := NewDatabaseRateLimitStore(db)
+
+	for _, bucket := range []string{"login-account:username=a", "login-account:username=b"} {
+		if count, _, err := store.Increment(bucket, time.Millisecond); err != nil || count != 1 {
+			t.Fatalf("%s: count = %d, %v", bucket, count, err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// The next hit after the sweep interval removes the expired windows
+	store.lastSweep = time.Now().Add(-2 * time.Minute)
+	if _, _, err := store.Increment("login-ip:192.0.2.1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	var buckets []string
+	db.Model(&models.RateLimitCounter{}).Order("bucket").Pluck("bucket", &buckets)
+	if len(buckets) != 1 || buckets[0] != "login-ip:192.0.2.1" {
+		t.Errorf("buckets after sweep = %v, want only the live one", buckets)
+	}
+}
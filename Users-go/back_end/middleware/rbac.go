@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"newworld-project/models"
+	"newworld-project/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// permissionCacheTTL bounds how long other instances may act on stale role
+// definitions; changes made through this instance invalidate it immediately
+const permissionCacheTTL = 30 * time.Second
+
+// PermissionChecker resolves the effective permissions of roles, caching
+// the role definitions it loads from the store.
+type PermissionChecker struct {
+	store repository.Store
+
+	mu       sync.Mutex
+	byRole   map[string]map[string]bool
+	loadedAt time.Time
+}
+
+// NewPermissionChecker returns a checker that loads roles from store
+func NewPermissionChecker(store repository.Store) *PermissionChecker {
+	return &PermissionChecker{store: store}
+}
+
+// Invalidate forces the next permission check to reload roles from the
+// store. Call it after changing roles or their permissions.
+func (p *PermissionChecker) Invalidate() {
+	p.mu.Lock()
+	p.byRole = nil
+	p.mu.Unlock()
+}
+
+// RolePermissions returns the effective permissions of a role, including
+// those inherited from its ancestors, sorted by name.
+func (p *PermissionChecker) RolePermissions(role string) ([]string, error) {
+	byRole, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := make([]string, 0, len(byRole[role]))
+	for permission := range byRole[role] {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions, nil
+}
+
+// HasPermission reports whether a role grants a permission.
+func (p *PermissionChecker) HasPermission(role, permission string) (bool, error) {
+	byRole, err := p.load()
+	if err != nil {
+		return false, err
+	}
+	return byRole[role][permission], nil
+}
+
+// RequirePermission allows the request only if the role of the authenticated
+// user or service grants every listed permission. It must run after
+// AuthMiddleware.
+func RequirePermission(checker *PermissionChecker, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var role string
+		if value, exists := c.Get("user"); exists {
+			role = value.(models.User).Role
+		} else if value, exists := c.Get("service"); exists {
+			role = value.(ServiceIdentity).Role
+		} else {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "User role not found",
+			})
+			c.Abort()
+			return
+		}
+
+		for _, permission := range permissions {
+			granted, err := checker.HasPermission(role, permission)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": "Failed to check permissions",
+				})
+				c.Abort()
+				return
+			}
+			if !granted {
+				c.JSON(http.StatusForbidden, gin.H{
+					"success": false,
+					"message": "Insufficient permissions",
+					"missing": permission,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// load returns the effective permission set of every role, reloading it
+// from the store when the cache is empty or expired.
+func (p *PermissionChecker) load() (map[string]map[string]bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.byRole != nil && time.Since(p.loadedAt) < permissionCacheTTL {
+		return p.byRole, nil
+	}
+
+	roles, err := p.store.Roles().List()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]models.Role, len(roles))
+	for _, role := range roles {
+		byID[role.ID] = role
+	}
+
+	byRole := make(map[string]map[string]bool, len(roles))
+	for _, role := range roles {
+		effective := make(map[string]bool)
+		// Walk up the inheritance chain; visited guards against cycles
+		visited := make(map[uint]bool)
+		for current, ok := role, true; ok && !visited[current.ID]; {
+			visited[current.ID] = true
+			for _, permission := range current.Permissions {
+				effective[permission.Name] = true
+			}
+			if current.ParentID == nil {
+				break
+			}
+			current, ok = byID[*current.ParentID]
+		}
+		byRole[role.Name] = effective
+	}
+
+	p.byRole = byRole
+	p.loadedAt = time.Now()
+	return byRole, nil
+}
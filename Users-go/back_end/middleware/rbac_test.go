@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"newworld-project/database"
+	"newworld-project/models"
+	"newworld-project/repository"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupRBACTest returns a seeded in-memory database and a checker reading it
+func setupRBACTest(t *testing.T) (*gorm.DB, *PermissionChecker) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=private"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SeedRBAC(db); err != nil {
+		t.Fatal(err)
+	}
+	return db, NewPermissionChecker(repository.NewGormStore(db))
+}
+
+func TestRolePermissionsInheritance(t *testing.T) {
+	db, checker := setupRBACTest(t)
+
+	var user, admin models.Role
+	db.Where("name = ?", models.RoleUser).First(&user)
+	db.Where("name = ?", models.RoleAdmin).First(&admin)
+
+	// support inherits from user; auditor inherits from support
+	var usersRead models.Permission
+	db.Where("name = ?", models.PermissionUsersRead).First(&usersRead)
+	support := models.Role{Name: "support", ParentID: &user.ID, Permissions: []models.Permission{usersRead}}
+	db.Create(&support)
+	auditor := models.Role{Name: "auditor", ParentID: &support.ID}
+	db.Create(&auditor)
+
+	tests := []struct {
+		role string
+		want []string
+	}{
+		{models.RoleUser, []string{}},
+		{models.RoleAdmin, []string{"audit:read", "emails:read", "emails:write", "metrics:read", "roles:read", "roles:write", "users:read", "users:write"}},
+		{"support", []string{"users:read"}},
+		{"auditor", []string{"users:read"}},
+		{"missing", []string{}},
+	}
+	for _, tt := range tests {
+		got, err := checker.RolePermissions(tt.role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RolePermissions(%q) = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+
+	// A cycle introduced directly in the database must not hang resolution
+	db.Model(&user).Update("parent_id", auditor.ID)
+	checker.Invalidate()
+	if got, _ := checker.RolePermissions(models.RoleUser); !reflect.DeepEqual(got, []string{"users:read"}) {
+		t.Errorf("RolePermissions with cycle = %v", got)
+	}
+}
+
+func TestSeedRBACIsIdempotent(t *testing.T) {
+	db, checker := setupRBACTest(t)
+
+	// Removing a permission from admin must survive a restart
+	var admin models.Role
+	db.Where("name = ?", models.RoleAdmin).First(&admin)
+	var rolesWrite models.Permission
+	db.Where("name = ?", models.PermissionRolesWrite).First(&rolesWrite)
+	db.Model(&admin).Association("Permissions").Delete(&rolesWrite)
+
+	if err := database.SeedRBAC(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var roles, permissions int64
+	db.Model(&models.Role{}).Count(&roles)
+	db.Model(&models.Permission{}).Count(&permissions)
+	if roles != 2 || permissions != int64(len(models.DefaultPermissions)) {
+		t.Errorf("after reseeding: %d roles, %d permissions", roles, permissions)
+	}
+	if granted, _ := checker.HasPermission(models.RoleAdmin, models.PermissionRolesWrite); granted {
+		t.Error("seeding granted a permission that was removed from admin")
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	_, checker := setupRBACTest(t)
+	gin.SetMode(gin.TestMode)
+
+	request := func(role string) int {
+		r := gin.New()
+		r.GET("/", func(c *gin.Context) {
+			c.Set("user", models.User{Role: role})
+			c.Next()
+		}, RequirePermission(checker, models.PermissionUsersRead, models.PermissionUsersWrite), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Code
+	}
+
+	if code := request(models.RoleAdmin); code != http.StatusOK {
+		t.Errorf("admin = %d, want 200", code)
+	}
+	if code := request(models.RoleUser); code != http.StatusForbidden {
+		t.Errorf("user = %d, want 403", code)
+	}
+}
+
+// fakeRoleStore serves roles from memory and counts how often they are
+// listed. Other repositories are left to the embedded nil Store and panic.
+type fakeRoleStore struct {
+	repository.Store
+	roles []models.Role
+	loads int
+}
+
+type fakeRoles struct {
+	repository.RoleRepository
+	s *fakeRoleStore
+}
+
+func (s *fakeRoleStore) Roles() repository.RoleRepository { return fakeRoles{s: s} }
+
+func (r fakeRoles) List() ([]models.Role, error) {
+	r.s.loads++
+	return r.s.roles, nil
+}
+
+func TestPermissionCheckerWithFakeStore(t *testing.T) {
+	parentID := uint(1)
+	store := &fakeRoleStore{roles: []models.Role{
+		{ID: 1, Name: "support", Permissions: []models.Permission{{Name: models.PermissionUsersRead}}},
+		{ID: 2, Name: "auditor", ParentID: &parentID, Permissions: []models.Permission{{Name: models.PermissionAuditRead}}},
+	}}
+	checker := NewPermissionChecker(store)
+
+	for _, permission := range []string{models.PermissionUsersRead, models.PermissionAuditRead} {
+		if granted, err := checker.HasPermission("auditor", permission); err != nil || !granted {
+			t.Errorf("auditor %s = %v, %v", permission, granted, err)
+		}
+	}
+	if granted, _ := checker.HasPermission("support", models.PermissionAuditRead); granted {
+		t.Error("support inherited from its child")
+	}
+	if store.loads != 1 {
+		t.Errorf("roles loaded %d times, want once while cached", store.loads)
+	}
+
+	checker.Invalidate()
+	checker.HasPermission("support", models.PermissionUsersRead)
+	if store.loads != 2 {
+		t.Errorf("roles loaded %d times after Invalidate, want 2", store.loads)
+	}
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Outcomes of an audited action
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// ErrAuditEventImmutable is returned when code tries to change or remove a
+// recorded audit event
+var ErrAuditEventImmutable = errors.New("audit events are append-only")
+
+// AuditEvent is an append-only record of a security-relevant action. ActorID
+// is the user who performed it and TargetID the user it was performed on;
+// either is nil when unknown.
+type AuditEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ActorID   *uint     `json:"actorId" gorm:"index"`
+	TargetID  *uint     `json:"targetId" gorm:"index"`
+	Action    string    `json:"action" gorm:"not null;size:64;index"`
+	Outcome   string    `json:"outcome" gorm:"not null;size:16"`
+	IPAddress string    `json:"ipAddress" gorm:"size:45"`
+	UserAgent string    `json:"userAgent" gorm:"size:512"`
+	Metadata  string    `json:"metadata" gorm:"type:text"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+}
+
+// BeforeUpdate keeps audit events from being rewritten through GORM
+func (e *AuditEvent) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// BeforeDelete keeps audit events from being removed through GORM
+func (e *AuditEvent) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// AuditEventQuery filters the admin audit log. Action matches exactly, or
+// by prefix when it ends in "*" (e.g. "auth.*").
+type AuditEventQuery struct {
+	ActorID   uint      `form:"actorId"`
+	TargetID  uint      `form:"targetId"`
+	Action    string    `form:"action" binding:"max=64"`
+	Outcome   string    `form:"outcome" binding:"omitempty,oneof=success failure"`
+	IPAddress string    `form:"ip" binding:"max=45"`
+	From      time.Time `form:"from"`
+	To        time.Time `form:"to"`
+	Cursor    string    `form:"cursor" binding:"max=64"`
+	Limit     int       `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// SecurityActivityQuery pages through the current user's own audit events
+type SecurityActivityQuery struct {
+	Cursor string `form:"cursor" binding:"max=64"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
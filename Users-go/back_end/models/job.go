@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ScheduledJob records the runs of a background job, shared by every
+// instance of the service. An instance runs a scheduled time (a slot) only
+// after moving LastSlot up to it while no other instance holds the lock, so
+// each slot runs once however many instances are up.
+type ScheduledJob struct {
+	Name           string     `json:"name" gorm:"primaryKey;size:64"`
+	LockedBy       string     `json:"lockedBy" gorm:"size:255"`
+	LockedUntil    *time.Time `json:"lockedUntil"`
+	LastSlot       *time.Time `json:"lastSlot"`
+	LastStartedAt  *time.Time `json:"lastStartedAt"`
+	LastFinishedAt *time.Time `json:"lastFinishedAt"`
+	LastResult     string     `json:"lastResult" gorm:"size:255"`
+	LastError      string     `json:"lastError" gorm:"size:1024"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Delivery states of an outbound email
+const (
+	EmailStatusPending = "pending"
+	EmailStatusSent    = "sent"
+	EmailStatusDead    = "dead"
+)
+
+// OutboxEmail is an email queued for the outbox workers. It is written in the
+// same transaction as the change that triggers it, so the email goes out if
+// and only if that change is committed. The body is discarded once sent
+// because it may contain single-use tokens, and a dead email's body is
+// discarded once those tokens have expired.
+type OutboxEmail struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Recipient     string     `json:"recipient" gorm:"not null;size:255"`
+	Subject       string     `json:"subject" gorm:"not null;size:255"`
+	HTML          string     `json:"-" gorm:"type:text"`
+	Text          string     `json:"-" gorm:"type:text"`
+	Status        string     `json:"status" gorm:"not null;size:16;index:idx_outbox_emails_status_next_attempt_at,priority:1"`
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt" gorm:"not null;index:idx_outbox_emails_status_next_attempt_at,priority:2"`
+	LastError     string     `json:"lastError" gorm:"size:1024"`
+	SentAt        *time.Time `json:"sentAt"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+// OutboxEmailQuery filters and pages the admin view of the outbox
+type OutboxEmailQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=pending sent dead"`
+	Cursor string `form:"cursor" binding:"max=64"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RateLimitCounter is the hit count of one rate limit bucket in its current
+// fixed window.
+type RateLimitCounter struct {
+	Bucket  string    `json:"bucket" gorm:"primaryKey;size:255"`
+	Count   int       `json:"count" gorm:"not null"`
+	ResetAt time.Time `json:"resetAt" gorm:"not null;index"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// Permissions checked by RequirePermission. They are seeded into the
+// permissions table at startup; roles are managed through the admin API.
+const (
+	PermissionUsersRead   = "users:read"
+	PermissionUsersWrite  = "users:write"
+	PermissionRolesRead   = "roles:read"
+	PermissionRolesWrite  = "roles:write"
+	PermissionAuditRead   = "audit:read"
+	PermissionEmailsRead  = "emails:read"
+	PermissionEmailsWrite = "emails:write"
+	PermissionMetricsRead = "metrics:read"
+)
+
+// Built-in roles that always exist and cannot be deleted
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// DefaultPermissions lists every permission known to the application with
+// its description
+var DefaultPermissions = map[string]string{
+	PermissionUsersRead:   "View user accounts",
+	PermissionUsersWrite:  "Manage user accounts",
+	PermissionRolesRead:   "View roles and permissions",
+	PermissionRolesWrite:  "Manage roles and permissions",
+	PermissionAuditRead:   "View the audit log",
+	PermissionEmailsRead:  "View the outbound email queue",
+	PermissionEmailsWrite: "Retry undelivered emails",
+	PermissionMetricsRead: "Scrape the Prometheus metrics",
+}
+
+type Permission struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex;not null;size:64"`
+	Description string    `json:"description" gorm:"size:255"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Role is a named set of permissions. A role inherits every permission of
+// its parent, recursively. Users reference their role by name.
+type Role struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	Name        string       `json:"name" gorm:"uniqueIndex;not null;size:20"`
+	Description string       `json:"description" gorm:"size:255"`
+	ParentID    *uint        `json:"parentId"`
+	Parent      *Role        `json:"parent,omitempty"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+}
+
+type RoleCreate struct {
+	Name        string   `json:"name" binding:"required,min=2,max=20,alphanum"`
+	Description string   `json:"description" binding:"max=255"`
+	Parent      string   `json:"parent" binding:"max=20"`
+	Permissions []string `json:"permissions"`
+}
+
+type RoleUpdate struct {
+	Description string   `json:"description" binding:"max=255"`
+	Parent      string   `json:"parent" binding:"max=20"`
+	Permissions []string `json:"permissions"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -16,12 +17,22 @@ type User struct {
 	Phone             *string        `json:"phone" gorm:"size:20"`
 	DateOfBirth       *time.Time     `json:"dateOfBirth"`
 	Bio               *string        `json:"bio" gorm:"size:500"`
+	Locale            string         `json:"locale" gorm:"size:16;not null;default:''"`
 	Role              string         `json:"role" gorm:"default:'user';size:20"`
 	Status            string         `json:"status" gorm:"default:'pending_verification';size:20"`
 	EmailVerified     bool           `json:"emailVerified" gorm:"default:false"`
 	EmailVerifiedAt   *time.Time     `json:"emailVerifiedAt"`
 	LastLoginAt       *time.Time     `json:"lastLoginAt"`
 	PasswordChangedAt *time.Time     `json:"passwordChangedAt"`
+	TokenVersion      int            `json:"-" gorm:"not null;default:0"`
+	FailedLogins      int            `json:"-" gorm:"not null;default:0"`
+	LastFailedLoginAt *time.Time     `json:"-"`
+	LockedUntil       *time.Time     `json:"lockedUntil"`
+	MFAEnabled        bool           `json:"mfaEnabled" gorm:"default:false"`
+	MFAEnabledAt      *time.Time     `json:"mfaEnabledAt"`
+	TOTPSecret        string         `json:"-" gorm:"size:64"`
+	TOTPLastCounter   int64          `json:"-" gorm:"not null;default:0"`
+	WebAuthnHandle    []byte         `json:"-" gorm:"size:64;uniqueIndex"`
 	CreatedAt         time.Time      `json:"createdAt"`
 	UpdatedAt         time.Time      `json:"updatedAt"`
 	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
@@ -36,6 +47,7 @@ type UserRegistration struct {
 	LastName        string `json:"lastName" binding:"required,min=1,max=50"`
 	Phone           string `json:"phone" binding:"omitempty"`
 	DateOfBirth     string `json:"dateOfBirth" binding:"omitempty"`
+	Locale          string `json:"locale" binding:"omitempty,max=16,bcp47_language_tag"`
 	AcceptTerms     bool   `json:"acceptTerms" binding:"required"`
 }
 
@@ -52,12 +64,37 @@ type UserProfile struct {
 	Phone       string `json:"phone" binding:"omitempty,e164"`
 	DateOfBirth string `json:"dateOfBirth" binding:"omitempty,datetime=2006-01-02"`
 	Bio         string `json:"bio" binding:"omitempty,max=500"`
+	Locale      string `json:"locale" binding:"omitempty,max=16,bcp47_language_tag"`
 }
 
 type ChangePassword struct {
 	CurrentPassword string `json:"currentPassword" binding:"required"`
 	NewPassword     string `json:"newPassword" binding:"required,min=8,max=128"`
 	ConfirmPassword string `json:"confirmPassword" binding:"required"`
+	// KeepCurrentSession signs out every other session but keeps the one
+	// making the request, which receives a new token pair
+	KeepCurrentSession bool `json:"keepCurrentSession"`
+}
+
+// AdminUserQuery filters, sorts and pages the admin user listing
+type AdminUserQuery struct {
+	Page     int    `form:"page" binding:"omitempty,min=1"`
+	PageSize int    `form:"pageSize" binding:"omitempty,min=1,max=100"`
+	Search   string `form:"search" binding:"max=100"`
+	Role     string `form:"role" binding:"max=20"`
+	Status   string `form:"status" binding:"omitempty,oneof=active pending_verification suspended banned"`
+	Sort     string `form:"sort" binding:"omitempty,oneof=id username email created_at last_login_at"`
+	Order    string `form:"order" binding:"omitempty,oneof=asc desc"`
+	Deleted  string `form:"deleted" binding:"omitempty,oneof=exclude include only"`
+}
+
+type AdminUpdateRole struct {
+	Role string `json:"role" binding:"required,max=20"`
+}
+
+type AdminUpdateStatus struct {
+	Status string `json:"status" binding:"required,oneof=active suspended banned"`
+	Reason string `json:"reason" binding:"max=500"`
 }
 
 type EmailVerification struct {
@@ -74,21 +111,62 @@ type ResetPassword struct {
 	ConfirmPassword string `json:"confirmPassword" binding:"required"`
 }
 
+type MFACode struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFALogin struct {
+	MFAToken     string `json:"mfaToken" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recoveryCode" binding:"required_without=Code"`
+}
+
+// MFAReauth re-authenticates the user before MFA settings change. Code may be
+// a TOTP code or a recovery code.
+type MFAReauth struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// Reauthentication confirms the password, and a second-factor code if two-factor
+// authentication is enabled, before the account's sign-in methods change
+type Reauthentication struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code"`
+}
+
+// PasskeyCeremony carries the browser's PublicKeyCredential back to the
+// server together with the ID of the ceremony it answers.
+type PasskeyCeremony struct {
+	SessionID  string          `json:"sessionId" binding:"required"`
+	Name       string          `json:"name" binding:"omitempty,max=100"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type UnlockAccount struct {
+	Token string `json:"token" binding:"required"`
+}
+
 type RefreshToken struct {
 	RefreshToken string `json:"refreshToken" binding:"required"`
 }
 
+// TokenBlacklist revokes an access token, identified by its jti claim, until
+// it expires
 type TokenBlacklist struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
-	Token     string    `json:"token" gorm:"uniqueIndex;not null"`
-	ExpiresAt time.Time `json:"expiresAt" gorm:"not null"`
+	TokenID   string    `json:"tokenId" gorm:"uniqueIndex;not null;size:64"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null;index"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+// EmailVerificationToken, PasswordResetToken and AccountUnlockToken are
+// single-use tokens sent by email. Only their SHA-256 digest is stored, so a
+// leaked database does not give away working links.
 type EmailVerificationToken struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
 	UserID    uint      `json:"userId" gorm:"not null"`
-	Token     string    `json:"token" gorm:"uniqueIndex;not null"`
+	TokenHash string    `json:"-" gorm:"uniqueIndex;not null;size:64"`
 	ExpiresAt time.Time `json:"expiresAt" gorm:"not null"`
 	Used      bool      `json:"used" gorm:"default:false"`
 	CreatedAt time.Time `json:"createdAt"`
@@ -97,8 +175,85 @@ type EmailVerificationToken struct {
 type PasswordResetToken struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
 	UserID    uint      `json:"userId" gorm:"not null"`
-	Token     string    `json:"token" gorm:"uniqueIndex;not null"`
+	TokenHash string    `json:"-" gorm:"uniqueIndex;not null;size:64"`
 	ExpiresAt time.Time `json:"expiresAt" gorm:"not null"`
 	Used      bool      `json:"used" gorm:"default:false"`
 	CreatedAt time.Time `json:"createdAt"`
-} 
\ No newline at end of file
+} 
+
+// RefreshTokenRecord is one issued refresh token. Tokens minted from the same
+// login share a FamilyID; each refresh rotates the token and records its parent.
+type RefreshTokenRecord struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"userId" gorm:"not null;index"`
+	FamilyID  string     `json:"familyId" gorm:"not null;index;size:64"`
+	TokenID   string     `json:"tokenId" gorm:"uniqueIndex;not null;size:64"`
+	ParentID  *uint      `json:"parentId"`
+	ExpiresAt time.Time  `json:"expiresAt" gorm:"not null"`
+	RotatedAt *time.Time `json:"rotatedAt"`
+	RevokedAt *time.Time `json:"revokedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// Session is one signed-in device. It spans a refresh token family and is
+// referenced by the sid claim of every token issued to it.
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"userId" gorm:"not null;index"`
+	FamilyID   string     `json:"-" gorm:"uniqueIndex;not null;size:64"`
+	UserAgent  string     `json:"userAgent" gorm:"size:512"`
+	IPAddress  string     `json:"ipAddress" gorm:"size:45"`
+	LastUsedAt time.Time  `json:"lastUsedAt"`
+	ExpiresAt  time.Time  `json:"expiresAt" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type AccountUnlockToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"userId" gorm:"not null"`
+	TokenHash string    `json:"-" gorm:"uniqueIndex;not null;size:64"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null"`
+	Used      bool      `json:"used" gorm:"default:false"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// RecoveryCode is a single-use MFA backup code; only its SHA-256 digest is
+// stored.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"userId" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null;size:64"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// PasskeyCredential is a WebAuthn public key credential registered by a user.
+type PasskeyCredential struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	UserID          uint       `json:"userId" gorm:"not null;index"`
+	Name            string     `json:"name" gorm:"size:100"`
+	CredentialID    []byte     `json:"-" gorm:"not null;uniqueIndex;size:1023"`
+	PublicKey       []byte     `json:"-" gorm:"not null"`
+	AttestationType string     `json:"attestationType" gorm:"size:32"`
+	Transports      string     `json:"transports" gorm:"size:100"`
+	AAGUID          []byte     `json:"-"`
+	SignCount       uint32     `json:"signCount"`
+	BackupEligible  bool       `json:"backupEligible"`
+	BackupState     bool       `json:"backupState"`
+	CloneWarning    bool       `json:"cloneWarning"`
+	LastUsedAt      *time.Time `json:"lastUsedAt"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// WebAuthnSession holds the challenge of a registration or login ceremony
+// between its begin and finish requests.
+type WebAuthnSession struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	SessionID string    `json:"sessionId" gorm:"uniqueIndex;not null;size:64"`
+	UserID    *uint     `json:"userId"`
+	Ceremony  string    `json:"ceremony" gorm:"not null;size:20"`
+	Data      string    `json:"-" gorm:"not null"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt"`
+}
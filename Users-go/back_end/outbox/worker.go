@@ -0,0 +1,205 @@
+// Package outbox sends the emails queued in the outbox table with a pool of
+// background workers, retrying failures with exponential back-off until they
+// are moved to the dead-letter state.
+package outbox
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/logging"
+	"newworld-project/mailer"
+	"newworld-project/metrics"
+	"newworld-project/models"
+	"newworld-project/repository"
+)
+
+var logger = logging.Logger(logging.Outbox)
+
+// Options tune the worker pool. Zero values fall back to the defaults of
+// OptionsFromConfig.
+type Options struct {
+	Workers      int
+	PollInterval time.Duration
+	BatchSize    int
+
+	// An email is given up after MaxAttempts attempts. The first retry
+	// waits RetryDelay, doubling after every further failure up to
+	// MaxRetryDelay.
+	MaxAttempts   int
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+
+	// Lease is how long a claimed email is held back from other workers
+	// while it is being sent
+	Lease time.Duration
+}
+
+// OptionsFromConfig reads the worker options from the email configuration
+func OptionsFromConfig(cfg config.EmailConfig) Options {
+	return Options{
+		Workers:       cfg.OutboxWorkers,
+		PollInterval:  time.Duration(cfg.OutboxPollInterval) * time.Second,
+		MaxAttempts:   cfg.MaxAttempts,
+		RetryDelay:    time.Duration(cfg.RetryDelay) * time.Second,
+		MaxRetryDelay: time.Duration(cfg.MaxRetryDelay) * time.Second,
+	}
+}
+
+// Worker delivers queued emails through a Mailer
+type Worker struct {
+	store  repository.Store
+	mailer mailer.Mailer
+	opts   Options
+}
+
+func NewWorker(store repository.Store, m mailer.Mailer, opts Options) *Worker {
+	if opts.Workers <= 0 {
+		opts.Workers = 2
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 2 * time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 50
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 30 * time.Second
+	}
+	if opts.MaxRetryDelay < opts.RetryDelay {
+		opts.MaxRetryDelay = opts.RetryDelay
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = 5 * time.Minute
+	}
+	return &Worker{store: store, mailer: m, opts: opts}
+}
+
+// Run polls the outbox and sends due emails until ctx is cancelled. Emails
+// being sent when ctx is cancelled are finished before Run returns.
+func (w *Worker) Run(ctx context.Context) {
+	jobs := make(chan models.OutboxEmail)
+	var wg sync.WaitGroup
+	for i := 0; i < w.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for email := range jobs {
+				w.deliver(email)
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		for _, email := range w.claimDue() {
+			select {
+			case jobs <- email:
+			case <-ctx.Done():
+				// The lease expires and another poll picks it up
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ProcessDue sends one batch of due emails in the calling goroutine and
+// returns how many it attempted
+func (w *Worker) ProcessDue() int {
+	emails := w.claimDue()
+	for _, email := range emails {
+		w.deliver(email)
+	}
+	return len(emails)
+}
+
+// claimDue claims up to one batch of emails that are due
+func (w *Worker) claimDue() []models.OutboxEmail {
+	now := time.Now()
+	due, err := w.store.Outbox().Due(now, w.opts.BatchSize)
+	if err != nil {
+		logger.Error("Failed to read email outbox", "error", err)
+		return nil
+	}
+
+	claimed := due[:0]
+	for _, email := range due {
+		ok, err := w.store.Outbox().Claim(email.ID, now, now.Add(w.opts.Lease))
+		if err != nil {
+			logger.Error("Failed to claim email", "email_id", email.ID, "error", err)
+			continue
+		}
+		if ok {
+			email.Attempts++
+			claimed = append(claimed, email)
+		}
+	}
+	return claimed
+}
+
+// deliver sends a claimed email and records the outcome
+func (w *Worker) deliver(email models.OutboxEmail) {
+	err := w.mailer.Send(mailer.Message{
+		To:      email.Recipient,
+		Subject: email.Subject,
+		HTML:    email.HTML,
+		Text:    email.Text,
+	})
+	if err == nil {
+		metrics.EmailDeliveries.WithLabelValues("sent").Inc()
+		if err := w.store.Outbox().MarkSent(email.ID, time.Now()); err != nil {
+			logger.Error("Failed to mark email as sent", "email_id", email.ID, "error", err)
+		}
+		return
+	}
+
+	var nextAttemptAt *time.Time
+	if email.Attempts < w.opts.MaxAttempts {
+		next := time.Now().Add(w.retryDelay(email.Attempts))
+		nextAttemptAt = &next
+		metrics.EmailDeliveries.WithLabelValues("retry").Inc()
+		logger.Warn("Sending email failed, will retry",
+			"email_id", email.ID, "to", email.Recipient, "attempt", email.Attempts, "retry_at", next, "error", err)
+	} else {
+		metrics.EmailDeliveries.WithLabelValues("dead").Inc()
+		logger.Error("Sending email failed, moved to dead letters",
+			"email_id", email.ID, "to", email.Recipient, "attempts", email.Attempts, "error", err)
+	}
+
+	lastError := err.Error()
+	if len(lastError) > 1024 {
+		lastError = lastError[:1024]
+	}
+	if err := w.store.Outbox().MarkFailed(email.ID, lastError, nextAttemptAt); err != nil {
+		logger.Error("Failed to record email failure", "email_id", email.ID, "error", err)
+	}
+}
+
+// retryDelay returns how long to wait after the given number of failed
+// attempts
+func (w *Worker) retryDelay(attempts int) time.Duration {
+	delay := w.opts.RetryDelay
+	for i := 1; i < attempts && delay < w.opts.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > w.opts.MaxRetryDelay {
+		delay = w.opts.MaxRetryDelay
+	}
+	return delay
+}
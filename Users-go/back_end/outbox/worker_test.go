@@ -0,0 +1,138 @@
+package outbox
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"newworld-project/database"
+	"newworld-project/mailer"
+	"newworld-project/models"
+	"newworld-project/repository"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func newTestStore(t *testing.T) repository.Store {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=private"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	return repository.NewGormStore(db)
+}
+
+// failingMailer rejects every message
+type failingMailer struct{}
+
+func (failingMailer) Send(mailer.Message) error { return errors.New("connection refused") }
+
+func enqueue(t *testing.T, store repository.Store) *models.OutboxEmail {
+	email := &models.OutboxEmail{Recipient: "alice@example.com", Subject: "Hello", HTML: "<p>token</p>"}
+	if err := store.Outbox().Enqueue(email); err != nil {
+		t.Fatal(err)
+	}
+	return email
+}
+
+func TestWorkerDelivers(t *testing.T) {
+	store := newTestStore(t)
+	m := mailer.NewMemoryMailer()
+	w := NewWorker(store, m, Options{})
+	email := enqueue(t, store)
+
+	if n := w.ProcessDue(); n != 1 {
+		t.Fatalf("ProcessDue = %d, want 1", n)
+	}
+	if messages := m.Messages(); len(messages) != 1 || messages[0].To != "alice@example.com" || messages[0].HTML != "<p>token</p>" {
+		t.Fatalf("unexpected messages %v", messages)
+	}
+
+	sent, err := store.Outbox().Find(email.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.Status != models.EmailStatusSent || sent.SentAt == nil || sent.Attempts != 1 {
+		t.Errorf("status %q, sentAt %v, attempts %d", sent.Status, sent.SentAt, sent.Attempts)
+	}
+	if sent.HTML != "" {
+		t.Error("body kept after sending")
+	}
+
+	// Sent emails are not picked up again
+	if n := w.ProcessDue(); n != 0 {
+		t.Errorf("ProcessDue after send = %d, want 0", n)
+	}
+}
+
+func TestWorkerRetriesThenGivesUp(t *testing.T) {
+	store := newTestStore(t)
+	w := NewWorker(store, failingMailer{}, Options{MaxAttempts: 3, RetryDelay: time.Minute, MaxRetryDelay: time.Hour})
+	email := enqueue(t, store)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		before := time.Now()
+		if n := w.ProcessDue(); n != 1 {
+			t.Fatalf("attempt %d: ProcessDue = %d, want 1", attempt, n)
+		}
+		failed, err := store.Outbox().Find(email.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed.Attempts != attempt || failed.LastError != "connection refused" {
+			t.Fatalf("attempt %d: attempts %d, last error %q", attempt, failed.Attempts, failed.LastError)
+		}
+		if attempt < 3 {
+			wait := failed.NextAttemptAt.Sub(before)
+			want := time.Minute << (attempt - 1)
+			if failed.Status != models.EmailStatusPending || wait < want || wait > want+time.Minute {
+				t.Fatalf("attempt %d: status %q, next attempt in %s, want %s", attempt, failed.Status, wait, want)
+			}
+			// Nothing is due until the back-off has passed
+			if n := w.ProcessDue(); n != 0 {
+				t.Fatalf("attempt %d: retried before the back-off", attempt)
+			}
+			store.Outbox().MarkFailed(email.ID, failed.LastError, &before)
+		} else if failed.Status != models.EmailStatusDead {
+			t.Fatalf("status after %d failures = %q, want dead", attempt, failed.Status)
+		}
+	}
+
+	// An administrator can put a dead email back in the queue
+	if ok, err := store.Outbox().Retry(email.ID, time.Now()); !ok || err != nil {
+		t.Fatalf("Retry = %v, %v", ok, err)
+	}
+	retried, _ := store.Outbox().Find(email.ID)
+	if retried.Status != models.EmailStatusPending || retried.Attempts != 0 {
+		t.Errorf("retried email status %q, attempts %d", retried.Status, retried.Attempts)
+	}
+	if ok, _ := store.Outbox().Retry(email.ID, time.Now()); ok {
+		t.Error("Retry accepted an email that is not dead")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	w := NewWorker(nil, nil, Options{RetryDelay: 30 * time.Second, MaxRetryDelay: 5 * time.Minute})
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{5, 5 * time.Minute},
+		{20, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := w.retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
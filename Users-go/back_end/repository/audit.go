@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"newworld-project/models"
+
+	"gorm.io/gorm"
+)
+
+// AuditFilter selects audit events. Zero fields match everything.
+type AuditFilter struct {
+	ActorID  uint
+	TargetID uint
+	Action   string
+	// ActionPrefix matches actions starting with it, e.g. "auth."
+	ActionPrefix string
+	Outcome      string
+	IPAddress    string
+	From         time.Time
+	To           time.Time
+}
+
+// AuditRepository stores the append-only audit log
+type AuditRepository interface {
+	Create(event *models.AuditEvent) error
+
+	// List returns up to limit events matching filter with an ID below
+	// beforeID (0 for no bound), newest first
+	List(filter AuditFilter, beforeID uint, limit int) ([]models.AuditEvent, error)
+}
+
+type gormAuditRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAuditRepository) Create(event *models.AuditEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *gormAuditRepository) List(filter AuditFilter, beforeID uint, limit int) ([]models.AuditEvent, error) {
+	query := r.db.Model(&models.AuditEvent{})
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.TargetID != 0 {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ActionPrefix != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(filter.ActionPrefix)
+		query = query.Where(`action LIKE ? ESCAPE '\'`, escaped+"%")
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.IPAddress != "" {
+		query = query.Where("ip_address = ?", filter.IPAddress)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if beforeID != 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var events []models.AuditEvent
+	err := query.Order("id DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
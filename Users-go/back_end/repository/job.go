@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"time"
+
+	"newworld-project/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobRepository coordinates scheduled jobs between instances
+type JobRepository interface {
+	// Claim takes the run of a job scheduled for slot. It holds the job's
+	// lock for owner until leaseUntil and returns false if the slot was
+	// already run or another instance holds the lock.
+	Claim(name string, slot time.Time, owner string, now, leaseUntil time.Time) (bool, error)
+	// Finish records the outcome of owner's run and releases the lock
+	Finish(name, owner string, at time.Time, result, lastError string) error
+}
+
+type gormJobRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormJobRepository) Claim(name string, slot time.Time, owner string, now, leaseUntil time.Time) (bool, error) {
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.ScheduledJob{Name: name}).Error; err != nil {
+		return false, err
+	}
+
+	result := r.db.Model(&models.ScheduledJob{}).
+		Where("name = ? AND (last_slot IS NULL OR last_slot < ?) AND (locked_until IS NULL OR locked_until <= ?)", name, slot, now).
+		Updates(map[string]interface{}{
+			"locked_by":       owner,
+			"locked_until":    leaseUntil,
+			"last_slot":       slot,
+			"last_started_at": now,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *gormJobRepository) Finish(name, owner string, at time.Time, result, lastError string) error {
+	return r.db.Model(&models.ScheduledJob{}).Where("name = ? AND locked_by = ?", name, owner).
+		Updates(map[string]interface{}{
+			"locked_by":        "",
+			"locked_until":     nil,
+			"last_finished_at": at,
+			"last_result":      result,
+			"last_error":       lastError,
+		}).Error
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"time"
+
+	"newworld-project/models"
+
+	"gorm.io/gorm"
+)
+
+// MFARepository stores the second-factor state of users: the last TOTP step
+// used and their recovery codes. The TOTP secret and whether MFA is enabled
+// are user columns set through UserRepository.Update.
+type MFARepository interface {
+	// AdvanceTOTPCounter records counter as the user's last used TOTP step.
+	// It reports false if that step or a later one was already used, so a
+	// code cannot be replayed by a concurrent request.
+	AdvanceTOTPCounter(userID uint, counter int64) (bool, error)
+
+	// UseRecoveryCode marks the user's unused recovery code with the given
+	// hash as used, reporting false if there is none
+	UseRecoveryCode(userID uint, codeHash string, at time.Time) (bool, error)
+
+	// ReplaceRecoveryCodes deletes the user's recovery codes and stores new
+	// ones with the given hashes
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+
+	DeleteRecoveryCodes(userID uint) error
+}
+
+type gormMFARepository struct {
+	db *gorm.DB
+}
+
+func (r *gormMFARepository) AdvanceTOTPCounter(userID uint, counter int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_counter < ?", userID, counter).
+		Update("totp_last_counter", counter)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *gormMFARepository) UseRecoveryCode(userID uint, codeHash string, at time.Time) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", at)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *gormMFARepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	if err := r.DeleteRecoveryCodes(userID); err != nil {
+		return err
+	}
+
+	records := make([]models.RecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+	return r.db.Create(&records).Error
+}
+
+func (r *gormMFARepository) DeleteRecoveryCodes(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
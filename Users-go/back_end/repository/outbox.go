@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"newworld-project/models"
+
+	"gorm.io/gorm"
+)
+
+// OutboxStats describes the email queue
+type OutboxStats struct {
+	// Count is the number of emails in each delivery state
+	Count map[string]int64
+	// OldestPendingAt is when the oldest unsent email was queued, or nil if
+	// the queue is empty
+	OldestPendingAt *time.Time
+}
+
+// OutboxRepository queues outbound emails and tracks their delivery
+type OutboxRepository interface {
+	Enqueue(email *models.OutboxEmail) error
+	Find(id uint) (*models.OutboxEmail, error)
+
+	// Due returns up to limit pending emails whose next attempt is due,
+	// longest waiting first
+	Due(now time.Time, limit int) ([]models.OutboxEmail, error)
+	// Claim takes a due email for one delivery attempt. It counts the
+	// attempt and holds the email back until leaseUntil, so it is retried
+	// if the sender dies. It returns false if another worker was first.
+	Claim(id uint, now, leaseUntil time.Time) (bool, error)
+	MarkSent(id uint, at time.Time) error
+	// MarkFailed records a failed attempt and schedules the next one at
+	// nextAttemptAt, or moves the email to the dead-letter state if nil
+	MarkFailed(id uint, lastError string, nextAttemptAt *time.Time) error
+	// Retry puts a dead email back in the queue with a fresh attempt count.
+	// It returns false if the email is not dead.
+	Retry(id uint, at time.Time) (bool, error)
+	// PurgeDeadBodies clears the bodies of emails that went dead before
+	// cutoff and returns how many were cleared
+	PurgeDeadBodies(cutoff time.Time) (int64, error)
+
+	// List returns up to limit emails in status ("" for any) with an ID
+	// below beforeID (0 for no bound), newest first
+	List(status string, beforeID uint, limit int) ([]models.OutboxEmail, error)
+	Stats() (*OutboxStats, error)
+}
+
+type gormOutboxRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormOutboxRepository) Enqueue(email *models.OutboxEmail) error {
+	email.Status = models.EmailStatusPending
+	if email.NextAttemptAt.IsZero() {
+		email.NextAttemptAt = time.Now()
+	}
+	return r.db.Create(email).Error
+}
+
+func (r *gormOutboxRepository) Find(id uint) (*models.OutboxEmail, error) {
+	var email models.OutboxEmail
+	if err := first(r.db.Where("id = ?", id), &email); err != nil {
+		return nil, err
+	}
+	return &email, nil
+}
+
+func (r *gormOutboxRepository) Due(now time.Time, limit int) ([]models.OutboxEmail, error) {
+	var emails []models.OutboxEmail
+	err := r.db.Where("status = ? AND next_attempt_at <= ?", models.EmailStatusPending, now).
+		Order("next_attempt_at").Limit(limit).Find(&emails).Error
+	return emails, err
+}
+
+func (r *gormOutboxRepository) Claim(id uint, now, leaseUntil time.Time) (bool, error) {
+	result := r.db.Model(&models.OutboxEmail{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", id, models.EmailStatusPending, now).
+		Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": leaseUntil,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *gormOutboxRepository) MarkSent(id uint, at time.Time) error {
+	return r.db.Model(&models.OutboxEmail{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     models.EmailStatusSent,
+		"sent_at":    at,
+		"html":       "",
+		"text":       "",
+		"last_error": "",
+	}).Error
+}
+
+func (r *gormOutboxRepository) MarkFailed(id uint, lastError string, nextAttemptAt *time.Time) error {
+	fields := map[string]interface{}{"last_error": lastError}
+	if nextAttemptAt != nil {
+		fields["next_attempt_at"] = *nextAttemptAt
+	} else {
+		fields["status"] = models.EmailStatusDead
+	}
+	return r.db.Model(&models.OutboxEmail{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r *gormOutboxRepository) Retry(id uint, at time.Time) (bool, error) {
+	result := r.db.Model(&models.OutboxEmail{}).
+		Where("id = ? AND status = ?", id, models.EmailStatusDead).
+		Updates(map[string]interface{}{
+			"status":          models.EmailStatusPending,
+			"attempts":        0,
+			"next_attempt_at": at,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *gormOutboxRepository) PurgeDeadBodies(cutoff time.Time) (int64, error) {
+	result := r.db.Model(&models.OutboxEmail{}).
+		Where("status = ? AND updated_at < ? AND (html <> '' OR text <> '')", models.EmailStatusDead, cutoff).
+		Updates(map[string]interface{}{"html": "", "text": ""})
+	return result.RowsAffected, result.Error
+}
+
+func (r *gormOutboxRepository) List(status string, beforeID uint, limit int) ([]models.OutboxEmail, error) {
+	query := r.db.Model(&models.OutboxEmail{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var emails []models.OutboxEmail
+	err := query.Order("id DESC").Limit(limit).Find(&emails).Error
+	return emails, err
+}
+
+func (r *gormOutboxRepository) Stats() (*OutboxStats, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := r.db.Model(&models.OutboxEmail{}).Select("status, COUNT(*) AS count").Group("status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	stats := &OutboxStats{Count: map[string]int64{
+		models.EmailStatusPending: 0,
+		models.EmailStatusSent:    0,
+		models.EmailStatusDead:    0,
+	}}
+	for _, row := range rows {
+		stats.Count[row.Status] = row.Count
+	}
+
+	var oldest models.OutboxEmail
+	err := first(r.db.Where("status = ?", models.EmailStatusPending).Order("created_at"), &oldest)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		stats.OldestPendingAt = &oldest.CreatedAt
+	}
+	return stats, nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"time"
+
+	"newworld-project/models"
+
+	"gorm.io/gorm"
+)
+
+// PasskeyRepository stores users' passkeys and the state of WebAuthn
+// ceremonies between their begin and finish requests
+type PasskeyRepository interface {
+	// ListByUser returns a user's passkeys, oldest first
+	ListByUser(userID uint) ([]models.PasskeyCredential, error)
+	Create(passkey *models.PasskeyCredential) error
+
+	// Delete removes one of the user's passkeys, reporting false if the user
+	// has no passkey with that ID
+	Delete(id, userID uint) (bool, error)
+
+	// UpdateByCredentialID sets the given columns of the passkey with a
+	// WebAuthn credential ID
+	UpdateByCredentialID(credentialID []byte, fields map[string]interface{}) error
+
+	SaveCeremony(session *models.WebAuthnSession) error
+
+	// ConsumeCeremony deletes and returns the unexpired ceremony state with
+	// the given ID and kind, restricted to a user unless userID is nil. Each
+	// ceremony can be consumed once; later calls return ErrNotFound.
+	ConsumeCeremony(sessionID, ceremony string, userID *uint, now time.Time) (*models.WebAuthnSession, error)
+}
+
+type gormPasskeyRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPasskeyRepository) ListByUser(userID uint) ([]models.PasskeyCredential, error) {
+	var passkeys []models.PasskeyCredential
+	err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&passkeys).Error
+	return passkeys, err
+}
+
+func (r *gormPasskeyRepository) Create(passkey *models.PasskeyCredential) error {
+	return r.db.Create(passkey).Error
+}
+
+func (r *gormPasskeyRepository) Delete(id, userID uint) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.PasskeyCredential{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormPasskeyRepository) UpdateByCredentialID(credentialID []byte, fields map[string]interface{}) error {
+	return r.db.Model(&models.PasskeyCredential{}).Where("credential_id = ?", credentialID).Updates(fields).Error
+}
+
+func (r *gormPasskeyRepository) SaveCeremony(session *models.WebAuthnSession) error {
+	return r.db.Create(session).Error
+}
+
+func (r *gormPasskeyRepository) ConsumeCeremony(sessionID, ceremony string, userID *uint, now time.Time) (*models.WebAuthnSession, error) {
+	query := r.db.Where("session_id = ? AND ceremony = ? AND expires_at > ?", sessionID, ceremony, now)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+
+	var session models.WebAuthnSession
+	if err := first(query, &session); err != nil {
+		return nil, err
+	}
+
+	// Only the request whose delete takes effect may use the ceremony
+	result := r.db.Delete(&session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
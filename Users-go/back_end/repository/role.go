@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"newworld-project/models"
+
+	"gorm.io/gorm"
+)
+
+// RoleRepository stores roles, the permissions granted to them directly and
+// the permissions known to the application
+type RoleRepository interface {
+	// List returns every role with its parent and permissions, by name
+	List() ([]models.Role, error)
+
+	// FindByID and FindByName return a role with its parent and permissions
+	FindByID(id uint) (*models.Role, error)
+	FindByName(name string) (*models.Role, error)
+
+	// Create saves a new role without permissions; grant them with
+	// SetPermissions
+	Create(role *models.Role) error
+
+	// Update saves a role's description and parent
+	Update(role *models.Role) error
+
+	// SetPermissions replaces the permissions granted directly to a role
+	SetPermissions(role *models.Role, permissions []models.Permission) error
+
+	// Delete removes a role and its permission grants
+	Delete(role *models.Role) error
+
+	// CountChildren returns how many roles inherit from a role directly
+	CountChildren(id uint) (int64, error)
+
+	// ListPermissions returns every permission, by name
+	ListPermissions() ([]models.Permission, error)
+
+	// FindPermissions returns the permissions with the given names; names
+	// that do not exist are left out
+	FindPermissions(names []string) ([]models.Permission, error)
+}
+
+type gormRoleRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRoleRepository) List() ([]models.Role, error) {
+	var roles []models.Role
+	err := r.db.Preload("Parent").Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func (r *gormRoleRepository) FindByID(id uint) (*models.Role, error) {
+	var role models.Role
+	if err := first(r.db.Preload("Parent").Preload("Permissions").Where("id = ?", id), &role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *gormRoleRepository) FindByName(name string) (*models.Role, error) {
+	var role models.Role
+	if err := first(r.db.Preload("Parent").Preload("Permissions").Where("name = ?", name), &role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *gormRoleRepository) Create(role *models.Role) error {
+	return r.db.Omit("Parent", "Permissions").Create(role).Error
+}
+
+func (r *gormRoleRepository) Update(role *models.Role) error {
+	return r.db.Model(&models.Role{}).Where("id = ?", role.ID).Updates(map[string]interface{}{
+		"description": role.Description,
+		"parent_id":   role.ParentID,
+	}).Error
+}
+
+func (r *gormRoleRepository) SetPermissions(role *models.Role, permissions []models.Permission) error {
+	return r.db.Model(&models.Role{ID: role.ID}).Association("Permissions").Replace(permissions)
+}
+
+func (r *gormRoleRepository) Delete(role *models.Role) error {
+	if err := r.db.Model(&models.Role{ID: role.ID}).Association("Permissions").Clear(); err != nil {
+		return err
+	}
+	return r.db.Delete(&models.Role{}, role.ID).Error
+}
+
+func (r *gormRoleRepository) CountChildren(id uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Role{}).Where("parent_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+func (r *gormRoleRepository) ListPermissions() ([]models.Permission, error) {
+	var permissions []models.Permission
+	err := r.db.Order("name").Find(&permissions).Error
+	return permissions, err
+}
+
+func (r *gormRoleRepository) FindPermissions(names []string) ([]models.Permission, error) {
+	permissions := []models.Permission{}
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	err := r.db.Where("name IN ?", names).Find(&permissions).Error
+	return permissions, err
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"time"
+
+	"newworld-project/models"
+
+	"gorm.io/gorm"
+)
+
+// SessionRepository stores sign-in sessions and the refresh tokens issued
+// within them. A session and its refresh tokens share a family ID.
+type SessionRepository interface {
+	// SaveSession creates or updates a session
+	SaveSession(session *models.Session) error
+	FindSessionByFamily(familyID string) (*models.Session, error)
+
+	// FindActiveSession returns the user's unrevoked session in a family
+	FindActiveSession(familyID string, userID uint) (*models.Session, error)
+
+	// FindActiveSessionByID returns one of the user's unrevoked sessions
+	FindActiveSessionByID(id, userID uint) (*models.Session, error)
+
+	// ListActiveSessions returns the user's unrevoked, unexpired sessions,
+	// most recently used first
+	ListActiveSessions(userID uint) ([]models.Session, error)
+
+	// TouchSession records that a session was used
+	TouchSession(id uint, at time.Time) error
+
+	CreateRefreshToken(record *models.RefreshTokenRecord) error
+	FindRefreshToken(tokenID string) (*models.RefreshTokenRecord, error)
+
+	// MarkRefreshTokenRotated marks a refresh token as exchanged. It reports
+	// false if the token was already rotated or revoked, so that only one
+	// concurrent request can rotate it.
+	MarkRefreshTokenRotated(id uint, at time.Time) (bool, error)
+
+	// RevokeFamily revokes a session and every refresh token in it
+	RevokeFamily(familyID string, at time.Time) error
+
+	// RevokeUserSessions revokes all of a user's sessions except
+	// keepSessionID (0 keeps none) together with their refresh tokens, and
+	// returns how many sessions were revoked
+	RevokeUserSessions(userID, keepSessionID uint, at time.Time) (int64, error)
+
+	// RevokeUserRefreshTokens revokes every refresh token of a user,
+	// including those of sessions that stay signed in
+	RevokeUserRefreshTokens(userID uint, at time.Time) error
+
+	// PurgeExpired deletes expired sessions, refresh tokens and passkey
+	// ceremonies, and returns how many rows it deleted
+	PurgeExpired(now time.Time) (int64, error)
+}
+
+type gormSessionRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormSessionRepository) SaveSession(session *models.Session) error {
+	return r.db.Save(session).Error
+}
+
+func (r *gormSessionRepository) FindSessionByFamily(familyID string) (*models.Session, error) {
+	var session models.Session
+	if err := first(r.db.Where("family_id = ?", familyID), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepository) FindActiveSession(familyID string, userID uint) (*models.Session, error) {
+	var session models.Session
+	if err := first(r.db.Where("family_id = ? AND user_id = ? AND revoked_at IS NULL", familyID, userID), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepository) FindActiveSessionByID(id, userID uint) (*models.Session, error) {
+	var session models.Session
+	if err := first(r.db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepository) ListActiveSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *gormSessionRepository) TouchSession(id uint, at time.Time) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+func (r *gormSessionRepository) CreateRefreshToken(record *models.RefreshTokenRecord) error {
+	return r.db.Create(record).Error
+}
+
+func (r *gormSessionRepository) FindRefreshToken(tokenID string) (*models.RefreshTokenRecord, error) {
+	var record models.RefreshTokenRecord
+	if err := first(r.db.Where("token_id = ?", tokenID), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *gormSessionRepository) MarkRefreshTokenRotated(id uint, at time.Time) (bool, error) {
+	result := r.db.Model(&models.RefreshTokenRecord{}).
+		Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", id).
+		Update("rotated_at", at)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *gormSessionRepository) RevokeFamily(familyID string, at time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshTokenRecord{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", at).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Session{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", at).Error
+	})
+}
+
+func (r *gormSessionRepository) RevokeUserSessions(userID, keepSessionID uint, at time.Time) (int64, error) {
+	var revoked int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		families := tx.Model(&models.Session{}).Select("family_id").
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepSessionID)
+
+		if err := tx.Model(&models.RefreshTokenRecord{}).
+			Where("family_id IN (?) AND revoked_at IS NULL", families).
+			Update("revoked_at", at).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Session{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepSessionID).
+			Update("revoked_at", at)
+		revoked = result.RowsAffected
+		return result.Error
+	})
+	return revoked, err
+}
+
+func (r *gormSessionRepository) RevokeUserRefreshTokens(userID uint, at time.Time) error {
+	return r.db.Model(&models.RefreshTokenRecord{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", at).Error
+}
+
+func (r *gormSessionRepository) PurgeExpired(now time.Time) (int64, error) {
+	var deleted int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&models.RefreshTokenRecord{},
+			&models.Session{},
+			&models.WebAuthnSession{},
+		} {
+			result := tx.Where("expires_at <= ?", now).Delete(model)
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted += result.RowsAffected
+		}
+		return nil
+	})
+	return deleted, err
+}
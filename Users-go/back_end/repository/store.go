@@ -0,0 +1,66 @@
+// Package repository hides how accounts, tokens, sessions, second factors,
+// passkeys, roles, audit events, queued emails and scheduled jobs are stored
+// behind interfaces, so handlers can be given a database-backed Store in
+// production and in-memory fakes in tests.
+package repository
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned when a lookup matches no record
+var ErrNotFound = errors.New("record not found")
+
+// Store gives access to every repository
+type Store interface {
+	Users() UserRepository
+	Tokens() TokenRepository
+	Sessions() SessionRepository
+	MFA() MFARepository
+	Passkeys() PasskeyRepository
+	Roles() RoleRepository
+	Audit() AuditRepository
+	Outbox() OutboxRepository
+	Jobs() JobRepository
+
+	// Transaction runs fn with a Store whose repositories share one
+	// transaction. It commits if fn returns nil and rolls back otherwise.
+	Transaction(fn func(tx Store) error) error
+}
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore returns a Store backed by db
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Users() UserRepository       { return &gormUserRepository{db: s.db} }
+func (s *gormStore) Tokens() TokenRepository     { return &gormTokenRepository{db: s.db} }
+func (s *gormStore) Sessions() SessionRepository { return &gormSessionRepository{db: s.db} }
+func (s *gormStore) MFA() MFARepository          { return &gormMFARepository{db: s.db} }
+func (s *gormStore) Passkeys() PasskeyRepository { return &gormPasskeyRepository{db: s.db} }
+func (s *gormStore) Roles() RoleRepository       { return &gormRoleRepository{db: s.db} }
+func (s *gormStore) Audit() AuditRepository      { return &gormAuditRepository{db: s.db} }
+func (s *gormStore) Outbox() OutboxRepository    { return &gormOutboxRepository{db: s.db} }
+func (s *gormStore) Jobs() JobRepository         { return &gormJobRepository{db: s.db} }
+
+func (s *gormStore) Transaction(fn func(tx Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx})
+	})
+}
+
+// first loads the first record matching query into dest, translating GORM's
+// not-found error into ErrNotFound
+func first(query *gorm.DB, dest interface{}) error {
+	err := query.First(dest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"time"
+
+	"newworld-project/models"
+
+	"gorm.io/gorm"
+)
+
+// TokenRepository stores revoked access tokens and the single-use tokens
+// sent by email. Email tokens are stored and looked up by the digest from
+// utils.HashToken. The Find methods only return tokens that are unused and
+// unexpired.
+type TokenRepository interface {
+	// Blacklist revokes the access token with the given jti until it
+	// expires
+	Blacklist(tokenID string, expiresAt time.Time) error
+	IsBlacklisted(tokenID string) (bool, error)
+
+	CreateEmailVerification(token *models.EmailVerificationToken) error
+	FindEmailVerification(tokenHash string) (*models.EmailVerificationToken, error)
+	MarkEmailVerificationUsed(id uint) error
+
+	CreatePasswordReset(token *models.PasswordResetToken) error
+	FindPasswordReset(tokenHash string) (*models.PasswordResetToken, error)
+	MarkPasswordResetUsed(id uint) error
+
+	CreateAccountUnlock(token *models.AccountUnlockToken) error
+	FindAccountUnlock(tokenHash string) (*models.AccountUnlockToken, error)
+	MarkAccountUnlockUsed(id uint) error
+
+	// PurgeExpired deletes blacklist entries for access tokens that have
+	// expired and email tokens that are used or expired, and returns how
+	// many rows it deleted
+	PurgeExpired(now time.Time) (int64, error)
+}
+
+type gormTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormTokenRepository) Blacklist(tokenID string, expiresAt time.Time) error {
+	return r.db.Create(&models.TokenBlacklist{TokenID: tokenID, ExpiresAt: expiresAt}).Error
+}
+
+func (r *gormTokenRepository) IsBlacklisted(tokenID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.TokenBlacklist{}).Where("token_id = ?", tokenID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormTokenRepository) CreateEmailVerification(token *models.EmailVerificationToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *gormTokenRepository) FindEmailVerification(tokenHash string) (*models.EmailVerificationToken, error) {
+	var record models.EmailVerificationToken
+	if err := first(r.usable(tokenHash), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *gormTokenRepository) MarkEmailVerificationUsed(id uint) error {
+	return r.markUsed(&models.EmailVerificationToken{}, id)
+}
+
+func (r *gormTokenRepository) CreatePasswordReset(token *models.PasswordResetToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *gormTokenRepository) FindPasswordReset(tokenHash string) (*models.PasswordResetToken, error) {
+	var record models.PasswordResetToken
+	if err := first(r.usable(tokenHash), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *gormTokenRepository) MarkPasswordResetUsed(id uint) error {
+	return r.markUsed(&models.PasswordResetToken{}, id)
+}
+
+func (r *gormTokenRepository) CreateAccountUnlock(token *models.AccountUnlockToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *gormTokenRepository) FindAccountUnlock(tokenHash string) (*models.AccountUnlockToken, error) {
+	var record models.AccountUnlockToken
+	if err := first(r.usable(tokenHash), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *gormTokenRepository) MarkAccountUnlockUsed(id uint) error {
+	return r.markUsed(&models.AccountUnlockToken{}, id)
+}
+
+// usable selects the unused, unexpired token with the given digest
+func (r *gormTokenRepository) usable(tokenHash string) *gorm.DB {
+	return r.db.Where("token_hash = ? AND used = ? AND expires_at > ?", tokenHash, false, time.Now())
+}
+
+func (r *gormTokenRepository) markUsed(model interface{}, id uint) error {
+	return r.db.Model(model).Where("id = ?", id).Update("used", true).Error
+}
+
+func (r *gormTokenRepository) PurgeExpired(now time.Time) (int64, error) {
+	var deleted int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("expires_at <= ?", now).Delete(&models.TokenBlacklist{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted += result.RowsAffected
+
+		for _, model := range []interface{}{
+			&models.EmailVerificationToken{},
+			&models.PasswordResetToken{},
+			&models.AccountUnlockToken{},
+		} {
+			result := tx.Where("used = ? OR expires_at <= ?", true, now).Delete(model)
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted += result.RowsAffected
+		}
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"newworld-project/models"
+
+	"gorm.io/gorm"
+)
+
+// UserFilter selects and orders users for List. Zero fields match
+// everything.
+type UserFilter struct {
+	// Search matches part of the username, email or name, ignoring case
+	Search string
+	Role   string
+	Status string
+	// Deleted is "include" to list soft-deleted users as well or "only" to
+	// list nothing else
+	Deleted string
+
+	// Sort is a user column and Order is asc or desc; callers must restrict
+	// both to known values
+	Sort   string
+	Order  string
+	Offset int
+	Limit  int
+}
+
+// UserRepository stores user accounts. Soft-deleted users are only returned
+// by the methods that say so.
+type UserRepository interface {
+	FindByID(id uint) (*models.User, error)
+	FindByUsername(username string) (*models.User, error)
+	FindByEmail(email string) (*models.User, error)
+	FindByWebAuthnHandle(handle []byte) (*models.User, error)
+
+	// FindByIDWithDeleted is FindByID including soft-deleted users
+	FindByIDWithDeleted(id uint) (*models.User, error)
+
+	// List returns a page of the users matching filter and the number of
+	// matching users in total
+	List(filter UserFilter) ([]models.User, int64, error)
+
+	// CountByRole returns how many users, including soft-deleted ones, have
+	// a role
+	CountByRole(role string) (int64, error)
+
+	Create(user *models.User) error
+
+	// Update sets the given columns of a user
+	Update(id uint, fields map[string]interface{}) error
+
+	// Delete soft-deletes a user and Restore undoes it
+	Delete(id uint) error
+	Restore(id uint) error
+
+	// RecordFailedLogin counts a failed login at the given time and returns
+	// the number of consecutive failures. restart begins a new count instead
+	// of adding to the previous one.
+	RecordFailedLogin(id uint, at time.Time, restart bool) (int, error)
+
+	// IncrementTokenVersion makes every token issued to the user so far stale
+	IncrementTokenVersion(id uint) error
+
+	// PurgeUnverified permanently deletes up to limit accounts created
+	// before createdBefore that never verified their email address or
+	// signed in. PurgeDeleted does the same for accounts soft-deleted before
+	// deletedBefore. The tokens, sessions and credentials of the accounts go
+	// with them; their audit events are kept. Both return the IDs of the
+	// deleted accounts.
+	PurgeUnverified(createdBefore time.Time, limit int) ([]uint, error)
+	PurgeDeleted(deletedBefore time.Time, limit int) ([]uint, error)
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormUserRepository) FindByID(id uint) (*models.User, error) {
+	var user models.User
+	if err := first(r.db.Where("id = ?", id), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByUsername(username string) (*models.User, error) {
+	var user models.User
+	if err := first(r.db.Where("username = ?", username), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByEmail(email string) (*models.User, error) {
+	var user models.User
+	if err := first(r.db.Where("email = ?", email), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByWebAuthnHandle(handle []byte) (*models.User, error) {
+	var user models.User
+	if err := first(r.db.Where("web_authn_handle = ?", handle), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByIDWithDeleted(id uint) (*models.User, error) {
+	var user models.User
+	if err := first(r.db.Unscoped().Where("id = ?", id), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) List(filter UserFilter) ([]models.User, int64, error) {
+	query := r.db.Model(&models.User{})
+	switch filter.Deleted {
+	case "include":
+		query = query.Unscoped()
+	case "only":
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+
+	if filter.Search != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(filter.Search))
+		like := "%" + escaped + "%"
+		query = query.Where(`LOWER(username) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\' OR LOWER(first_name) LIKE ? ESCAPE '\' OR LOWER(last_name) LIKE ? ESCAPE '\'`,
+			like, like, like, like)
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	err := query.Order(filter.Sort + " " + filter.Order).Order("id " + filter.Order).
+		Offset(filter.Offset).Limit(filter.Limit).
+		Find(&users).Error
+	return users, total, err
+}
+
+func (r *gormUserRepository) CountByRole(role string) (int64, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.User{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
+func (r *gormUserRepository) Create(user *models.User) error {
+	return r.db.Create(user).Error
+}
+
+func (r *gormUserRepository) Update(id uint, fields map[string]interface{}) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r *gormUserRepository) Delete(id uint) error {
+	return r.db.Delete(&models.User{}, id).Error
+}
+
+func (r *gormUserRepository) Restore(id uint) error {
+	return r.db.Unscoped().Model(&models.User{}).Where("id = ?", id).Update("deleted_at", nil).Error
+}
+
+func (r *gormUserRepository) RecordFailedLogin(id uint, at time.Time, restart bool) (int, error) {
+	var failures interface{} = gorm.Expr("failed_logins + 1")
+	if restart {
+		failures = 1
+	}
+
+	if err := r.db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"failed_logins":        failures,
+		"last_failed_login_at": at,
+	}).Error; err != nil {
+		return 0, err
+	}
+
+	var user models.User
+	if err := first(r.db.Select("failed_logins").Where("id = ?", id), &user); err != nil {
+		return 0, err
+	}
+	return user.FailedLogins, nil
+}
+
+func (r *gormUserRepository) IncrementTokenVersion(id uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).
+		Update("token_version", gorm.Expr("token_version + 1")).Error
+}
+
+func (r *gormUserRepository) PurgeUnverified(createdBefore time.Time, limit int) ([]uint, error) {
+	return r.purge(limit, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("email_verified = ? AND last_login_at IS NULL AND created_at < ?", false, createdBefore)
+	})
+}
+
+func (r *gormUserRepository) PurgeDeleted(deletedBefore time.Time, limit int) ([]uint, error) {
+	return r.purge(limit, func(tx *gorm.DB) *gorm.DB {
+		return tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore)
+	})
+}
+
+// purge hard-deletes up to limit users selected by where and every row that
+// belongs to them
+func (r *gormUserRepository) purge(limit int, where func(tx *gorm.DB) *gorm.DB) ([]uint, error) {
+	var ids []uint
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := where(tx.Model(&models.User{})).Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		for _, model := range []interface{}{
+			&models.EmailVerificationToken{},
+			&models.PasswordResetToken{},
+			&models.AccountUnlockToken{},
+			&models.RefreshTokenRecord{},
+			&models.Session{},
+			&models.RecoveryCode{},
+			&models.PasskeyCredential{},
+			&models.WebAuthnSession{},
+		} {
+			if err := tx.Where("user_id IN ?", ids).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&models.User{}).Error
+	})
+	return ids, err
+}
@@ -0,0 +1,329 @@
+package routes
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"newworld-project/config"
+	"newworld-project/models"
+	"newworld-project/utils"
+)
+
+func TestRegister(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+
+	with := func(changes map[string]interface{}) map[string]interface{} {
+		body := registration("bob")
+		for key, value := range changes {
+			if value == nil {
+				delete(body, key)
+			} else {
+				body[key] = value
+			}
+		}
+		return body
+	}
+
+	tests := []struct {
+		name    string
+		body    map[string]interface{}
+		want    int
+		message string
+	}{
+		{"duplicate email", with(map[string]interface{}{"email": "alice@example.com"}), http.StatusConflict, "Email already exists"},
+		{"duplicate username", with(map[string]interface{}{"username": "alice", "email": "other@example.com"}), http.StatusConflict, "Username already exists"},
+		{"passwords differ", with(map[string]interface{}{"confirmPassword": "Password2"}), http.StatusBadRequest, "Passwords do not match"},
+		{"weak password", with(map[string]interface{}{"password": "password1", "confirmPassword": "password1"}), http.StatusBadRequest, "Password must contain at least one uppercase letter, one lowercase letter, and one number"},
+		{"short password", with(map[string]interface{}{"password": "Pass1", "confirmPassword": "Pass1"}), http.StatusBadRequest, "Validation failed"},
+		{"invalid email", with(map[string]interface{}{"email": "bob"}), http.StatusBadRequest, "Validation failed"},
+		{"missing first name", with(map[string]interface{}{"firstName": nil}), http.StatusBadRequest, "Validation failed"},
+		{"terms not accepted", with(map[string]interface{}{"acceptTerms": false}), http.StatusBadRequest, "Validation failed"},
+		{"invalid date of birth", with(map[string]interface{}{"dateOfBirth": "01/02/2000"}), http.StatusBadRequest, "Invalid date format"},
+		{"invalid locale", with(map[string]interface{}{"locale": "not a language"}), http.StatusBadRequest, "Validation failed"},
+		{"valid", with(map[string]interface{}{"locale": "zh-CN"}), http.StatusCreated, "User registered successfully. Please check your email for verification."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := s.request(http.MethodPost, "/api/v1/auth/register", "", tt.body)
+			if code != tt.want || response["message"] != tt.message {
+				t.Fatalf("got %d %q, want %d %q", code, response["message"], tt.want, tt.message)
+			}
+		})
+	}
+
+	// The verification email is in the language chosen at registration
+	email := s.nextEmail("bob@example.com")
+	token := s.linkToken(email)
+	if email.Subject != "验证您的邮箱 - NewWorld Project" || !strings.Contains(email.Text, "token="+token) {
+		t.Errorf("verification email subject %q, text %q", email.Subject, email.Text)
+	}
+	s.expectNoEmail()
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	s.register("mallory")
+	s.db.Model(&models.User{}).Where("username = ?", "mallory").Update("status", "suspended")
+
+	tests := []struct {
+		name    string
+		body    map[string]interface{}
+		want    int
+		message string
+	}{
+		{"by username", map[string]interface{}{"username": "alice", "password": testPassword}, http.StatusOK, "Login successful"},
+		{"by email", map[string]interface{}{"email": "alice@example.com", "password": testPassword}, http.StatusOK, "Login successful"},
+		{"wrong password", map[string]interface{}{"username": "alice", "password": "Wrong1234"}, http.StatusUnauthorized, "用户名或邮箱不存在或密码错误"},
+		{"unknown user", map[string]interface{}{"username": "nobody", "password": testPassword}, http.StatusUnauthorized, "用户名或邮箱不存在或密码错误"},
+		{"no identifier", map[string]interface{}{"password": testPassword}, http.StatusBadRequest, "用户名或邮箱必填"},
+		{"no password", map[string]interface{}{"username": "alice"}, http.StatusBadRequest, "Invalid request data"},
+		{"invalid email", map[string]interface{}{"email": "alice", "password": testPassword}, http.StatusBadRequest, "Invalid request data"},
+		{"suspended account", map[string]interface{}{"username": "mallory", "password": testPassword}, http.StatusForbidden, "Account has been suspended"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := s.request(http.MethodPost, "/api/v1/auth/login", "", tt.body)
+			if code != tt.want || response["message"] != tt.message {
+				t.Fatalf("got %d %q, want %d %q", code, response["message"], tt.want, tt.message)
+			}
+			if code == http.StatusOK {
+				if tokens := tokensFrom(data(response)["token"]); tokens.Access == "" || tokens.Refresh == "" {
+					t.Errorf("missing tokens in %v", data(response))
+				}
+			}
+		})
+	}
+}
+
+func TestLoginLockedAccount(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	config.ConfigInstance.Security.LockoutThreshold = 3
+	config.ConfigInstance.Security.LockoutDuration = 60
+	config.ConfigInstance.Security.LockoutMaxDuration = 600
+
+	// Responses are compared without their request IDs
+	login := func(username, password string) (int, map[string]interface{}) {
+		code, response := s.request(http.MethodPost, "/api/v1/auth/login", "", map[string]interface{}{
+			"username": username,
+			"password": password,
+		})
+		delete(response, "requestId")
+		return code, response
+	}
+	_, unknown := login("nobody", testPassword)
+
+	for i := 1; i <= 3; i++ {
+		if code, response := login("alice", "Wrong1234"); code != http.StatusUnauthorized || !reflect.DeepEqual(response, unknown) {
+			t.Fatalf("failure %d: got %d %v, want %v", i, code, response, unknown)
+		}
+	}
+	if email := s.nextEmail("alice@example.com"); !strings.Contains(email.Text, "token=") {
+		t.Errorf("unlock email without link: %q", email.Text)
+	}
+
+	// The correct password on a locked account gets the unknown-user answer
+	if code, response := login("alice", testPassword); code != http.StatusUnauthorized || !reflect.DeepEqual(response, unknown) {
+		t.Fatalf("locked login: got %d %v, want %v", code, response, unknown)
+	}
+	s.expectNoEmail()
+}
+
+func TestVerifyEmail(t *testing.T) {
+	s := newTestServer(t)
+	token := s.register("alice")
+
+	// Only the digest of the emailed token is stored
+	var stored models.EmailVerificationToken
+	s.db.First(&stored)
+	if stored.TokenHash != utils.HashToken(token) || stored.TokenHash == token {
+		t.Fatalf("stored token hash %q", stored.TokenHash)
+	}
+
+	tests := []struct {
+		name    string
+		body    map[string]interface{}
+		want    int
+		message string
+	}{
+		{"missing token", map[string]interface{}{}, http.StatusBadRequest, "Invalid request data"},
+		{"unknown token", map[string]interface{}{"token": "not-a-token"}, http.StatusBadRequest, "Invalid or expired verification token"},
+		{"valid", map[string]interface{}{"token": token}, http.StatusOK, "Email verified successfully"},
+		{"already used", map[string]interface{}{"token": token}, http.StatusBadRequest, "Invalid or expired verification token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := s.request(http.MethodPost, "/api/v1/auth/verify-email", "", tt.body)
+			if code != tt.want || response["message"] != tt.message {
+				t.Fatalf("got %d %q, want %d %q", code, response["message"], tt.want, tt.message)
+			}
+		})
+	}
+
+	tokens := s.login("alice", testPassword)
+	if _, response := s.request(http.MethodGet, "/api/v1/users/profile", tokens.Access, nil); data(response)["emailVerified"] != true {
+		t.Error("email not marked as verified")
+	}
+}
+
+func TestForgotAndResetPassword(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	before := s.login("alice", testPassword)
+
+	forgotTests := []struct {
+		name    string
+		email   string
+		want    int
+		message string
+	}{
+		{"invalid email", "alice", http.StatusBadRequest, "Invalid request data"},
+		{"unknown email", "nobody@example.com", http.StatusOK, "If the email exists, a password reset link has been sent"},
+	}
+	for _, tt := range forgotTests {
+		t.Run("forgot "+tt.name, func(t *testing.T) {
+			code, response := s.request(http.MethodPost, "/api/v1/auth/forgot-password", "", map[string]interface{}{"email": tt.email})
+			if code != tt.want || response["message"] != tt.message {
+				t.Fatalf("got %d %q, want %d %q", code, response["message"], tt.want, tt.message)
+			}
+		})
+	}
+	s.expectNoEmail()
+
+	code, _ := s.request(http.MethodPost, "/api/v1/auth/forgot-password", "", map[string]interface{}{"email": "alice@example.com"})
+	if code != http.StatusOK {
+		t.Fatalf("forgot password: status %d", code)
+	}
+	token := s.linkToken(s.nextEmail("alice@example.com"))
+
+	reset := func(token, password, confirm string) map[string]interface{} {
+		return map[string]interface{}{"token": token, "newPassword": password, "confirmPassword": confirm}
+	}
+	resetTests := []struct {
+		name    string
+		body    map[string]interface{}
+		want    int
+		message string
+	}{
+		{"passwords differ", reset(token, "NewPassword1", "NewPassword2"), http.StatusBadRequest, "Passwords do not match"},
+		{"short password", reset(token, "New1", "New1"), http.StatusBadRequest, "Invalid request data"},
+		{"unknown token", reset("not-a-token", "NewPassword1", "NewPassword1"), http.StatusBadRequest, "Invalid or expired reset token"},
+		{"valid", reset(token, "NewPassword1", "NewPassword1"), http.StatusOK, "Password reset successfully"},
+		{"already used", reset(token, "NewPassword2", "NewPassword2"), http.StatusBadRequest, "Invalid or expired reset token"},
+	}
+	for _, tt := range resetTests {
+		t.Run("reset "+tt.name, func(t *testing.T) {
+			code, response := s.request(http.MethodPost, "/api/v1/auth/reset-password", "", tt.body)
+			if code != tt.want || response["message"] != tt.message {
+				t.Fatalf("got %d %q, want %d %q", code, response["message"], tt.want, tt.message)
+			}
+		})
+	}
+
+	if code, _ := s.request(http.MethodPost, "/api/v1/auth/login", "", map[string]interface{}{"username": "alice", "password": testPassword}); code != http.StatusUnauthorized {
+		t.Errorf("old password: status %d, want 401", code)
+	}
+	s.login("alice", "NewPassword1")
+
+	// Tokens issued before the reset no longer work
+	if code, _ := s.request(http.MethodGet, "/api/v1/users/profile", before.Access, nil); code != http.StatusUnauthorized {
+		t.Errorf("access token from before reset: status %d, want 401", code)
+	}
+	if code, _ := s.request(http.MethodPost, "/api/v1/auth/refresh", "", map[string]interface{}{"refreshToken": before.Refresh}); code != http.StatusUnauthorized {
+		t.Errorf("refresh token from before reset: status %d, want 401", code)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	tokens := s.login("alice", testPassword)
+
+	refresh := func(token string) (int, map[string]interface{}) {
+		return s.request(http.MethodPost, "/api/v1/auth/refresh", "", map[string]interface{}{"refreshToken": token})
+	}
+
+	code, response := refresh(tokens.Refresh)
+	if code != http.StatusOK {
+		t.Fatalf("refresh: status %d: %v", code, response["message"])
+	}
+	rotated := tokensFrom(data(response))
+	if rotated.Access == "" || rotated.Refresh == "" || rotated.Refresh == tokens.Refresh {
+		t.Fatalf("refresh did not rotate tokens: %v", data(response))
+	}
+	if code, _ := s.request(http.MethodGet, "/api/v1/users/profile", rotated.Access, nil); code != http.StatusOK {
+		t.Errorf("refreshed access token: status %d", code)
+	}
+
+	tests := []struct {
+		name    string
+		body    map[string]interface{}
+		want    int
+		message string
+	}{
+		{"missing token", map[string]interface{}{}, http.StatusBadRequest, "Invalid request data"},
+		{"malformed token", map[string]interface{}{"refreshToken": "not-a-jwt"}, http.StatusUnauthorized, "Invalid refresh token"},
+		{"access token", map[string]interface{}{"refreshToken": rotated.Access}, http.StatusUnauthorized, "Invalid refresh token"},
+		{"reused token", map[string]interface{}{"refreshToken": tokens.Refresh}, http.StatusUnauthorized, "Refresh token has already been used; please log in again"},
+		// Reuse revokes the whole session, including the rotated token
+		{"rotated token after reuse", map[string]interface{}{"refreshToken": rotated.Refresh}, http.StatusUnauthorized, "Refresh token has already been used; please log in again"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := s.request(http.MethodPost, "/api/v1/auth/refresh", "", tt.body)
+			if code != tt.want || response["message"] != tt.message {
+				t.Fatalf("got %d %q, want %d %q", code, response["message"], tt.want, tt.message)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	tokens := s.login("alice", testPassword)
+	other := s.login("alice", testPassword)
+
+	if code, response := s.request(http.MethodPost, "/api/v1/auth/logout", "", nil); code != http.StatusUnauthorized || response["message"] != "Authorization header is required" {
+		t.Fatalf("logout without token: %d %q", code, response["message"])
+	}
+	if code, response := s.request(http.MethodPost, "/api/v1/auth/logout", tokens.Access, nil); code != http.StatusOK || response["message"] != "Logout successful" {
+		t.Fatalf("logout: %d %q", code, response["message"])
+	}
+
+	// The blacklist holds the jti, not the token
+	claims, err := s.tokens.ValidateAccessToken(tokens.Access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blacklisted []models.TokenBlacklist
+	s.db.Find(&blacklisted)
+	if len(blacklisted) != 1 || blacklisted[0].TokenID != claims.ID {
+		t.Fatalf("blacklist = %+v, want jti %s", blacklisted, claims.ID)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   map[string]interface{}
+		want   int
+	}{
+		{"access token revoked", http.MethodGet, "/api/v1/users/profile", tokens.Access, nil, http.StatusUnauthorized},
+		{"second logout", http.MethodPost, "/api/v1/auth/logout", tokens.Access, nil, http.StatusUnauthorized},
+		{"refresh token revoked", http.MethodPost, "/api/v1/auth/refresh", "", map[string]interface{}{"refreshToken": tokens.Refresh}, http.StatusUnauthorized},
+		{"other session unaffected", http.MethodGet, "/api/v1/users/profile", other.Access, nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, response := s.request(tt.method, tt.path, tt.token, tt.body); code != tt.want {
+				t.Fatalf("got %d %q, want %d", code, response["message"], tt.want)
+			}
+		})
+	}
+}
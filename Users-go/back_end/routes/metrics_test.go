@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"newworld-project/metrics"
+	"newworld-project/models"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	s.register("root")
+	s.db.Model(&models.User{}).Where("username = ?", "root").Update("role", models.RoleAdmin)
+
+	// The counters are global, so compare against their values beforehand
+	successes := metrics.Logins.WithLabelValues("password", models.AuditOutcomeSuccess, "")
+	failures := metrics.Logins.WithLabelValues("password", models.AuditOutcomeFailure, "invalid_password")
+	issued := metrics.TokensIssued.WithLabelValues("login")
+	successesBefore, failuresBefore, issuedBefore := testutil.ToFloat64(successes), testutil.ToFloat64(failures), testutil.ToFloat64(issued)
+
+	alice := s.login("alice", testPassword)
+	root := s.login("root", testPassword)
+	if code, _ := s.request(http.MethodPost, "/api/v1/auth/login", "", map[string]interface{}{
+		"username": "alice",
+		"password": "Wrong-password1",
+	}); code != http.StatusUnauthorized {
+		t.Fatalf("login with wrong password: %d", code)
+	}
+
+	if got := testutil.ToFloat64(successes) - successesBefore; got != 2 {
+		t.Errorf("successful logins counted %v times, want 2", got)
+	}
+	if got := testutil.ToFloat64(failures) - failuresBefore; got != 1 {
+		t.Errorf("failed logins counted %v times, want 1", got)
+	}
+	if got := testutil.ToFloat64(issued) - issuedBefore; got != 2 {
+		t.Errorf("token pairs counted %v times, want 2", got)
+	}
+
+	scrape := func(token string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		s.engine.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	if code, _ := scrape(""); code != http.StatusUnauthorized {
+		t.Errorf("anonymous scrape: %d", code)
+	}
+	if code, _ := scrape(alice.Access); code != http.StatusForbidden {
+		t.Errorf("scrape without metrics:read: %d", code)
+	}
+	code, body := scrape(root.Access)
+	if code != http.StatusOK {
+		t.Fatalf("admin scrape: %d", code)
+	}
+	for _, want := range []string{
+		`newworld_http_requests_total{method="POST",route="/api/v1/auth/login",status="401"}`,
+		`newworld_http_request_duration_seconds_bucket{method="POST",route="/api/v1/auth/login",status="200"`,
+		`newworld_password_hash_duration_seconds_count{operation="verify"}`,
+		`go_sql_open_connections{db_name="main"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+}
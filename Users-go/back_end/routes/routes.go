@@ -2,14 +2,28 @@ package routes
 
 import (
 	"net/http"
+	"time"
+
+	"newworld-project/app"
 	"newworld-project/handlers"
+	"newworld-project/metrics"
 	"newworld-project/middleware"
+	"newworld-project/models"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes() *gin.Engine {
-	r := gin.Default()
+// SetupRoutes builds the router with handlers wired to the container's
+// dependencies
+func SetupRoutes(a *app.App) *gin.Engine {
+	r := gin.New()
+
+	// Tag each request with an ID, log it, count it and recover from panics
+	r.Use(middleware.RequestID(), middleware.RequestLogger())
+	if a.Config.Metrics.Enabled {
+		r.Use(middleware.Metrics())
+	}
+	r.Use(middleware.Recovery())
 
 	// Set trusted proxies to avoid security warnings
 	// In development, trust localhost only
@@ -37,8 +51,33 @@ func SetupRoutes() *gin.Engine {
 		})
 	})
 
+	// Public keys for verifying issued tokens
+	keysHandler := handlers.NewKeysHandler(a.Tokens)
+	r.GET("/.well-known/jwks.json", keysHandler.JWKS)
+
+	// Prometheus metrics, unless they have a listener of their own. Scrapers
+	// authenticate with a token or a client certificate mapped to a role
+	// with metrics:read.
+	if a.Config.Metrics.Enabled && a.Config.Metrics.Listen == "" {
+		r.GET("/metrics",
+			middleware.AuthMiddleware(a.Tokens, a.Store, a.Config.Server.TLS.ClientIdentities),
+			middleware.RequirePermission(a.Permissions, models.PermissionMetricsRead),
+			gin.WrapH(metrics.Handler()))
+	}
+
+	// Rate limiting
+	security := a.Config.Security
+	rateLimitStore := a.RateLimits
+	rateLimitWindow := time.Duration(security.RateLimitWindow) * time.Second
+	rateLimitPolicy := func(name string, requests int, key func(*gin.Context) string) middleware.RateLimitPolicy {
+		return middleware.RateLimitPolicy{Name: name, Requests: requests, Window: rateLimitWindow, Key: key}
+	}
+
 	// API v1 routes
 	v1 := r.Group("/api/v1")
+	v1.Use(middleware.RateLimitMiddleware(rateLimitStore,
+		rateLimitPolicy("api", security.RateLimitRequests, middleware.ClientIPKey),
+	))
 	{
 		// API documentation endpoint
 		v1.GET("", func(c *gin.Context) {
@@ -54,45 +93,171 @@ func SetupRoutes() *gin.Engine {
 						"reset-password":  "POST /api/v1/auth/reset-password",
 						"refresh":         "POST /api/v1/auth/refresh",
 						"logout":          "POST /api/v1/auth/logout",
+						"unlock-account":  "POST /api/v1/auth/unlock-account",
+						"mfa-verify":      "POST /api/v1/auth/mfa/verify",
+						"passkey-begin":   "POST /api/v1/auth/passkeys/login/begin",
+						"passkey-finish":  "POST /api/v1/auth/passkeys/login/finish",
 					},
 					"users": gin.H{
 						"profile":         "GET /api/v1/users/profile",
 						"update-profile":  "PUT /api/v1/users/profile",
 						"change-password": "POST /api/v1/users/change-password",
+						"mfa-setup":       "POST /api/v1/users/mfa/totp/setup",
+						"mfa-confirm":     "POST /api/v1/users/mfa/totp/confirm",
+						"mfa-disable":     "POST /api/v1/users/mfa/disable",
+						"recovery-codes":  "POST /api/v1/users/mfa/recovery-codes",
+						"passkeys":        "GET /api/v1/users/passkeys",
+						"passkey-begin":   "POST /api/v1/users/passkeys/register/begin",
+						"passkey-finish":  "POST /api/v1/users/passkeys/register/finish",
+						"passkey-delete":  "DELETE /api/v1/users/passkeys/:id",
+						"sessions":        "GET /api/v1/users/sessions",
+						"session-revoke":  "DELETE /api/v1/users/sessions/:id",
+						"sessions-others": "POST /api/v1/users/sessions/revoke-others",
+						"activity":        "GET /api/v1/users/security-activity",
+					},
+					"admin": gin.H{
+						"users":               "GET /api/v1/admin/users",
+						"user":                "GET /api/v1/admin/users/:id",
+						"update-role":         "PUT /api/v1/admin/users/:id/role",
+						"update-status":       "PUT /api/v1/admin/users/:id/status",
+						"force-reset":         "POST /api/v1/admin/users/:id/force-password-reset",
+						"resend-verification": "POST /api/v1/admin/users/:id/resend-verification",
+						"delete-user":         "DELETE /api/v1/admin/users/:id",
+						"restore-user":        "POST /api/v1/admin/users/:id/restore",
+						"unlock-user":         "POST /api/v1/admin/users/:id/unlock",
+						"permissions":         "GET /api/v1/admin/permissions",
+						"roles":               "GET /api/v1/admin/roles",
+						"role-create":         "POST /api/v1/admin/roles",
+						"role-update":         "PUT /api/v1/admin/roles/:id",
+						"role-delete":         "DELETE /api/v1/admin/roles/:id",
+						"audit-events":        "GET /api/v1/admin/audit-events",
+						"emails":              "GET /api/v1/admin/emails",
+						"email-stats":         "GET /api/v1/admin/emails/stats",
+						"email-retry":         "POST /api/v1/admin/emails/:id/retry",
 					},
 				},
 				"swagger": "/docs",
 			})
 		})
 
+		// Email template previews for development
+		if a.Config.Email.TemplatePreview {
+			previewHandler := handlers.NewEmailPreviewHandler(a.Config, a.Store)
+			v1.GET("/dev/emails", previewHandler.ListTemplates)
+			v1.GET("/dev/emails/:name", previewHandler.Preview)
+		}
+
 		// Auth routes (no authentication required)
 		auth := v1.Group("/auth")
 		{
-			authHandler := handlers.NewAuthHandler()
-			
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
+			authHandler := handlers.NewAuthHandler(a.Config, a.Store, a.Tokens, a.Emails)
+
+			auth.POST("/register", middleware.RateLimitMiddleware(rateLimitStore,
+				rateLimitPolicy("register-ip", security.AuthRateLimitRequests, middleware.ClientIPKey),
+			), authHandler.Register)
+			auth.POST("/login", middleware.RateLimitMiddleware(rateLimitStore,
+				rateLimitPolicy("login-ip", security.AuthRateLimitRequests, middleware.ClientIPKey),
+				rateLimitPolicy("login-account", security.AccountRateLimitRequests, middleware.AccountKey("username", "email")),
+			), authHandler.Login)
 			auth.POST("/verify-email", authHandler.VerifyEmail)
-			auth.POST("/forgot-password", authHandler.ForgotPassword)
+			auth.POST("/forgot-password", middleware.RateLimitMiddleware(rateLimitStore,
+				rateLimitPolicy("forgot-password-ip", security.AuthRateLimitRequests, middleware.ClientIPKey),
+				rateLimitPolicy("forgot-password-account", security.AccountRateLimitRequests, middleware.AccountKey("email")),
+			), authHandler.ForgotPassword)
 			auth.POST("/reset-password", authHandler.ResetPassword)
+			auth.POST("/refresh", authHandler.RefreshToken)
+			auth.POST("/unlock-account", authHandler.UnlockAccount)
+
+			mfaHandler := handlers.NewMFAHandler(a.Config, a.Store, a.Tokens, a.Emails)
+			auth.POST("/mfa/verify", middleware.RateLimitMiddleware(rateLimitStore,
+				rateLimitPolicy("mfa-ip", security.AuthRateLimitRequests, middleware.ClientIPKey),
+			), mfaHandler.VerifyLogin)
+
+			passkeyHandler := a.Passkeys
+			auth.POST("/passkeys/login/begin", middleware.RateLimitMiddleware(rateLimitStore,
+				rateLimitPolicy("passkey-ip", security.AuthRateLimitRequests, middleware.ClientIPKey),
+			), passkeyHandler.BeginLogin)
+			auth.POST("/passkeys/login/finish", passkeyHandler.FinishLogin)
 		}
 
 		// Protected routes (authentication required)
 		protected := v1.Group("")
-		protected.Use(middleware.AuthMiddleware())
+		protected.Use(middleware.AuthMiddleware(a.Tokens, a.Store, a.Config.Server.TLS.ClientIdentities))
 		{
 			// Auth routes that require authentication
-			authHandler := handlers.NewAuthHandler()
-			protected.POST("/auth/refresh", authHandler.RefreshToken)
-			protected.POST("/auth/logout", authHandler.Logout)
+			authHandler := handlers.NewAuthHandler(a.Config, a.Store, a.Tokens, a.Emails)
+			protected.POST("/auth/logout", middleware.RequireUser(), authHandler.Logout)
 
 			// User routes
-			userHandler := handlers.NewUserHandler()
-			users := protected.Group("/users")
+			userHandler := handlers.NewUserHandler(a.Config, a.Store, a.Tokens, a.Permissions)
+			users := protected.Group("/users", middleware.RequireUser())
 			{
 				users.GET("/profile", userHandler.GetProfile)
 				users.PUT("/profile", userHandler.UpdateProfile)
 				users.POST("/change-password", userHandler.ChangePassword)
+
+				// Endpoints that re-authenticate with the password are limited like login
+				reauthLimit := middleware.RateLimitMiddleware(rateLimitStore,
+					rateLimitPolicy("reauth-ip", security.AuthRateLimitRequests, middleware.ClientIPKey),
+					rateLimitPolicy("reauth-account", security.AccountRateLimitRequests, middleware.UserKey),
+				)
+
+				mfaHandler := handlers.NewMFAHandler(a.Config, a.Store, a.Tokens, a.Emails)
+				users.POST("/mfa/totp/setup", mfaHandler.SetupTOTP)
+				users.POST("/mfa/totp/confirm", mfaHandler.ConfirmTOTP)
+				users.POST("/mfa/disable", reauthLimit, mfaHandler.Disable)
+				users.POST("/mfa/recovery-codes", reauthLimit, mfaHandler.RegenerateRecoveryCodes)
+
+				passkeyHandler := a.Passkeys
+				users.GET("/passkeys", passkeyHandler.ListPasskeys)
+				users.POST("/passkeys/register/begin", reauthLimit, passkeyHandler.BeginRegistration)
+				users.POST("/passkeys/register/finish", passkeyHandler.FinishRegistration)
+				users.DELETE("/passkeys/:id", reauthLimit, passkeyHandler.DeletePasskey)
+
+				sessionHandler := handlers.NewSessionHandler(a.Config, a.Store)
+				users.GET("/sessions", sessionHandler.ListSessions)
+				users.DELETE("/sessions/:id", sessionHandler.RevokeSession)
+				users.POST("/sessions/revoke-others", sessionHandler.RevokeOtherSessions)
+
+				auditHandler := handlers.NewAuditHandler(a.Config, a.Store)
+				users.GET("/security-activity", auditHandler.SecurityActivity)
+			}
+
+			// Admin routes
+			adminHandler := handlers.NewAdminHandler(a.Config, a.Store, a.Emails)
+			roleHandler := handlers.NewRoleHandler(a.Config, a.Store, a.Permissions)
+			auditHandler := handlers.NewAuditHandler(a.Config, a.Store)
+			outboxHandler := handlers.NewOutboxHandler(a.Config, a.Store)
+			canReadUsers := middleware.RequirePermission(a.Permissions, models.PermissionUsersRead)
+			canWriteUsers := middleware.RequirePermission(a.Permissions, models.PermissionUsersWrite)
+			canReadRoles := middleware.RequirePermission(a.Permissions, models.PermissionRolesRead)
+			canWriteRoles := middleware.RequirePermission(a.Permissions, models.PermissionRolesWrite)
+			canReadAudit := middleware.RequirePermission(a.Permissions, models.PermissionAuditRead)
+			canReadEmails := middleware.RequirePermission(a.Permissions, models.PermissionEmailsRead)
+			canWriteEmails := middleware.RequirePermission(a.Permissions, models.PermissionEmailsWrite)
+			admin := protected.Group("/admin")
+			{
+				admin.GET("/users", canReadUsers, adminHandler.ListUsers)
+				admin.GET("/users/:id", canReadUsers, adminHandler.GetUser)
+				admin.PUT("/users/:id/role", canWriteUsers, canWriteRoles, adminHandler.UpdateRole)
+				admin.PUT("/users/:id/status", canWriteUsers, adminHandler.UpdateStatus)
+				admin.POST("/users/:id/force-password-reset", canWriteUsers, adminHandler.ForcePasswordReset)
+				admin.POST("/users/:id/resend-verification", canWriteUsers, adminHandler.ResendVerification)
+				admin.DELETE("/users/:id", canWriteUsers, adminHandler.DeleteUser)
+				admin.POST("/users/:id/restore", canWriteUsers, adminHandler.RestoreUser)
+				admin.POST("/users/:id/unlock", canWriteUsers, adminHandler.UnlockUser)
+
+				admin.GET("/permissions", canReadRoles, roleHandler.ListPermissions)
+				admin.GET("/roles", canReadRoles, roleHandler.ListRoles)
+				admin.POST("/roles", canWriteRoles, roleHandler.CreateRole)
+				admin.PUT("/roles/:id", canWriteRoles, roleHandler.UpdateRole)
+				admin.DELETE("/roles/:id", canWriteRoles, roleHandler.DeleteRole)
+
+				admin.GET("/audit-events", canReadAudit, auditHandler.ListEvents)
+
+				admin.GET("/emails", canReadEmails, outboxHandler.ListEmails)
+				admin.GET("/emails/stats", canReadEmails, outboxHandler.Stats)
+				admin.POST("/emails/:id/retry", canWriteEmails, outboxHandler.RetryEmail)
 			}
 		}
 	}
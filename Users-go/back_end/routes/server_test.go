@@ -0,0 +1,246 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"newworld-project/app"
+	"newworld-project/config"
+	"newworld-project/database"
+	"newworld-project/mailer"
+	"newworld-project/outbox"
+	"newworld-project/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testPassword = "Password1"
+
+var databaseCounter atomic.Int64
+
+// testServer is the real router over a fresh in-memory SQLite database, with
+// outgoing email kept in memory. The outbox is drained on demand by pollEmail
+// rather than by background workers.
+type testServer struct {
+	t      *testing.T
+	engine *gin.Engine
+	db     *gorm.DB
+	mailer *mailer.MemoryMailer
+	outbox *outbox.Worker
+	tokens *utils.TokenService
+
+	// read counts the emails already returned by nextEmail
+	read int
+}
+
+// newTestServer builds the router from SetupRoutes the way main does. Rate
+// limits and account lockout are disabled so tests can repeat requests.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	previousConfig, previousWriter := config.ConfigInstance, gin.DefaultWriter
+	t.Cleanup(func() { config.ConfigInstance, gin.DefaultWriter = previousConfig, previousWriter })
+	gin.DefaultWriter = io.Discard
+
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:             "test-secret",
+			Issuer:             "newworld-project",
+			Audience:           "newworld-api",
+			AccessTokenExpiry:  3600,
+			RefreshTokenExpiry: 604800,
+			MFAChallengeExpiry: 300,
+		},
+		Email: config.EmailConfig{
+			From:      "noreply@example.com",
+			Transport: "memory",
+		},
+		App: config.AppConfig{
+			Name:        "NewWorld Project",
+			URL:         "http://localhost:8080",
+			FrontendURL: "http://localhost:3000",
+		},
+		Security: config.SecurityConfig{
+			BcryptCost:     4,
+			RateLimitStore: "memory",
+		},
+		WebAuthn: config.WebAuthnConfig{
+			RPID:          "localhost",
+			RPDisplayName: "NewWorld Project",
+			RPOrigins:     []string{"http://localhost:3000"},
+		},
+		Metrics: config.MetricsConfig{Enabled: true},
+	}
+	config.ConfigInstance = cfg
+
+	dsn := fmt.Sprintf("file:routes_test_%d?mode=memory&cache=shared", databaseCounter.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SeedRBAC(db); err != nil {
+		t.Fatal(err)
+	}
+	// Closing the last connection discards the in-memory database
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	a, err := app.New(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{t: t, engine: SetupRoutes(a), db: db, mailer: a.Mailer.(*mailer.MemoryMailer), outbox: a.Outbox, tokens: a.Tokens}
+}
+
+// request sends a JSON request, authenticated if token is set, and decodes
+// the JSON response
+func (s *testServer) request(method, path, token string, body interface{}) (int, map[string]interface{}) {
+	s.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		s.t.Fatalf("%s %s: invalid JSON response %q", method, path, w.Body.String())
+	}
+	return w.Code, response
+}
+
+// pollEmail waits up to timeout for an email that nextEmail has not
+// returned yet
+func (s *testServer) pollEmail(timeout time.Duration) (mailer.Message, bool) {
+	for deadline := time.Now().Add(timeout); ; time.Sleep(5 * time.Millisecond) {
+		s.outbox.ProcessDue()
+		if messages := s.mailer.Messages(); len(messages) > s.read {
+			s.read++
+			return messages[s.read-1], true
+		}
+		if time.Now().After(deadline) {
+			return mailer.Message{}, false
+		}
+	}
+}
+
+// nextEmail waits for the next email and checks its recipient
+func (s *testServer) nextEmail(to string) mailer.Message {
+	s.t.Helper()
+	email, ok := s.pollEmail(2 * time.Second)
+	if !ok {
+		s.t.Fatalf("no email sent to %s", to)
+	}
+	if email.To != to {
+		s.t.Fatalf("email sent to %s, want %s", email.To, to)
+	}
+	return email
+}
+
+// expectNoEmail fails if an email is sent within a short grace period
+func (s *testServer) expectNoEmail() {
+	s.t.Helper()
+	if email, ok := s.pollEmail(100 * time.Millisecond); ok {
+		s.t.Fatalf("unexpected email to %s: %s", email.To, email.Subject)
+	}
+}
+
+var linkTokenPattern = regexp.MustCompile(`[?&]token=([A-Za-z0-9_-]+)`)
+
+// linkToken extracts the token from the link in an email
+func (s *testServer) linkToken(email mailer.Message) string {
+	s.t.Helper()
+	match := linkTokenPattern.FindStringSubmatch(email.HTML)
+	if match == nil {
+		s.t.Fatalf("no token link in email %q", email.Subject)
+	}
+	return match[1]
+}
+
+// registration returns a valid registration request for username
+func registration(username string) map[string]interface{} {
+	return map[string]interface{}{
+		"username":        username,
+		"email":           username + "@example.com",
+		"password":        testPassword,
+		"confirmPassword": testPassword,
+		"firstName":       "Test",
+		"lastName":        "User",
+		"acceptTerms":     true,
+	}
+}
+
+// register signs up username with testPassword and returns the token from
+// the verification email
+func (s *testServer) register(username string) string {
+	s.t.Helper()
+	code, response := s.request(http.MethodPost, "/api/v1/auth/register", "", registration(username))
+	if code != http.StatusCreated {
+		s.t.Fatalf("register %s: status %d: %v", username, code, response["message"])
+	}
+	return s.linkToken(s.nextEmail(username + "@example.com"))
+}
+
+// testTokens is the token pair returned by login and refresh
+type testTokens struct {
+	Access  string
+	Refresh string
+}
+
+func tokensFrom(data interface{}) testTokens {
+	pair, _ := data.(map[string]interface{})
+	access, _ := pair["accessToken"].(string)
+	refresh, _ := pair["refreshToken"].(string)
+	return testTokens{Access: access, Refresh: refresh}
+}
+
+// login signs in and returns the issued tokens
+func (s *testServer) login(username, password string) testTokens {
+	s.t.Helper()
+	code, response := s.request(http.MethodPost, "/api/v1/auth/login", "", map[string]interface{}{
+		"username": username,
+		"password": password,
+	})
+	if code != http.StatusOK {
+		s.t.Fatalf("login %s: status %d: %v", username, code, response["message"])
+	}
+	return tokensFrom(data(response)["token"])
+}
+
+// data returns the "data" object of a response
+func data(response map[string]interface{}) map[string]interface{} {
+	d, _ := response["data"].(map[string]interface{})
+	return d
+}
@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	tokens := s.login("alice", testPassword)
+
+	profile := func(changes map[string]interface{}) map[string]interface{} {
+		body := map[string]interface{}{
+			"firstName":   "Alice",
+			"lastName":    "Liddell",
+			"phone":       "+8613800138000",
+			"dateOfBirth": "2000-01-02",
+			"bio":         "Curious",
+		}
+		for key, value := range changes {
+			body[key] = value
+		}
+		return body
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		token   string
+		body    map[string]interface{}
+		want    int
+		message interface{}
+	}{
+		{"get without token", http.MethodGet, "", nil, http.StatusUnauthorized, "Authorization header is required"},
+		{"get with invalid token", http.MethodGet, "not-a-jwt", nil, http.StatusUnauthorized, "Invalid or expired token"},
+		{"get with refresh token", http.MethodGet, tokens.Refresh, nil, http.StatusUnauthorized, "Invalid or expired token"},
+		{"get", http.MethodGet, tokens.Access, nil, http.StatusOK, nil},
+		{"update without token", http.MethodPut, "", profile(nil), http.StatusUnauthorized, "Authorization header is required"},
+		{"update with invalid phone", http.MethodPut, tokens.Access, profile(map[string]interface{}{"phone": "12345"}), http.StatusBadRequest, "Validation failed"},
+		{"update with invalid date", http.MethodPut, tokens.Access, profile(map[string]interface{}{"dateOfBirth": "02/01/2000"}), http.StatusBadRequest, "Validation failed"},
+		{"update with long bio", http.MethodPut, tokens.Access, profile(map[string]interface{}{"bio": string(make([]byte, 501))}), http.StatusBadRequest, "Validation failed"},
+		{"update with invalid locale", http.MethodPut, tokens.Access, profile(map[string]interface{}{"locale": "zh_CN!"}), http.StatusBadRequest, "Validation failed"},
+		{"update", http.MethodPut, tokens.Access, profile(map[string]interface{}{"locale": "zh"}), http.StatusOK, "Profile updated successfully"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := s.request(tt.method, "/api/v1/users/profile", tt.token, tt.body)
+			if code != tt.want || response["message"] != tt.message {
+				t.Fatalf("got %d %q, want %d %q", code, response["message"], tt.want, tt.message)
+			}
+		})
+	}
+
+	code, response := s.request(http.MethodGet, "/api/v1/users/profile", tokens.Access, nil)
+	if code != http.StatusOK {
+		t.Fatalf("get profile: status %d", code)
+	}
+	got := data(response)
+	if got["username"] != "alice" || got["firstName"] != "Alice" || got["lastName"] != "Liddell" || got["phone"] != "+8613800138000" || got["bio"] != "Curious" || got["locale"] != "zh" {
+		t.Errorf("profile not updated: %v", got)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	s := newTestServer(t)
+	s.register("alice")
+	tokens := s.login("alice", testPassword)
+	other := s.login("alice", testPassword)
+
+	change := func(current, password, confirm string) map[string]interface{} {
+		return map[string]interface{}{"currentPassword": current, "newPassword": password, "confirmPassword": confirm}
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		body    map[string]interface{}
+		want    int
+		message string
+	}{
+		{"without token", "", change(testPassword, "NewPassword1", "NewPassword1"), http.StatusUnauthorized, "Authorization header is required"},
+		{"missing current password", tokens.Access, change("", "NewPassword1", "NewPassword1"), http.StatusBadRequest, "Validation failed"},
+		{"short password", tokens.Access, change(testPassword, "New1", "New1"), http.StatusBadRequest, "Validation failed"},
+		{"passwords differ", tokens.Access, change(testPassword, "NewPassword1", "NewPassword2"), http.StatusBadRequest, "New passwords do not match"},
+		{"wrong current password", tokens.Access, change("Wrong1234", "NewPassword1", "NewPassword1"), http.StatusBadRequest, "Current password is incorrect"},
+		{"valid", tokens.Access, change(testPassword, "NewPassword1", "NewPassword1"), http.StatusOK, "Password changed successfully"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := s.request(http.MethodPost, "/api/v1/users/change-password", tt.token, tt.body)
+			if code != tt.want || response["message"] != tt.message {
+				t.Fatalf("got %d %q, want %d %q", code, response["message"], tt.want, tt.message)
+			}
+		})
+	}
+
+	// Every session is signed out, including the one that changed the password
+	for _, token := range []string{tokens.Access, other.Access} {
+		if code, _ := s.request(http.MethodGet, "/api/v1/users/profile", token, nil); code != http.StatusUnauthorized {
+			t.Errorf("access token from before the change: status %d, want 401", code)
+		}
+	}
+	if code, _ := s.request(http.MethodPost, "/api/v1/auth/login", "", map[string]interface{}{"username": "alice", "password": testPassword}); code != http.StatusUnauthorized {
+		t.Errorf("old password: status %d, want 401", code)
+	}
+	tokens = s.login("alice", "NewPassword1")
+
+	// Keeping the current session returns a fresh token pair for it
+	code, response := s.request(http.MethodPost, "/api/v1/users/change-password", tokens.Access, map[string]interface{}{
+		"currentPassword":    "NewPassword1",
+		"newPassword":        "NewPassword2",
+		"confirmPassword":    "NewPassword2",
+		"keepCurrentSession": true,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("change password keeping session: status %d: %v", code, response["message"])
+	}
+	kept := tokensFrom(data(response)["token"])
+	if code, _ := s.request(http.MethodGet, "/api/v1/users/profile", kept.Access, nil); code != http.StatusOK {
+		t.Errorf("new access token for kept session: status %d", code)
+	}
+}
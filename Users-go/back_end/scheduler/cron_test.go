@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAndNext(t *testing.T) {
+	// Wednesday
+	from := time.Date(2030, 1, 2, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"*/20 * * * *", []string{"2030-01-02 10:20", "2030-01-02 10:40", "2030-01-02 11:00"}},
+		{"0 * * * *", []string{"2030-01-02 11:00", "2030-01-02 12:00"}},
+		{"30 3 * * *", []string{"2030-01-03 03:30", "2030-01-04 03:30"}},
+		{"0 9-17/4 * * 1-5", []string{"2030-01-02 13:00", "2030-01-02 17:00", "2030-01-03 09:00"}},
+		{"15 8 * * 0,6", []string{"2030-01-05 08:15", "2030-01-06 08:15", "2030-01-12 08:15"}},
+		{"0 0 * * 7", []string{"2030-01-06 00:00"}},
+		// Both day fields restricted: either may match
+		{"0 0 15 * 5", []string{"2030-01-04 00:00", "2030-01-11 00:00", "2030-01-15 00:00"}},
+		{"0 0 29 2 *", []string{"2032-02-29 00:00"}},
+		{"5/30 * * * *", []string{"2030-01-02 10:35", "2030-01-02 11:05"}},
+		{"@daily", []string{"2030-01-03 00:00"}},
+		{"@monthly", []string{"2030-02-01 00:00", "2030-03-01 00:00"}},
+		{"@every 90m", []string{"2030-01-02 10:30", "2030-01-02 12:00"}},
+	}
+	for _, tt := range tests {
+		schedule, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		next := from
+		for _, want := range tt.want {
+			next = schedule.Next(next)
+			if got := next.Format("2006-01-02 15:04"); got != want {
+				t.Errorf("%q: got %s, want %s", tt.spec, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseRejectsInvalidSchedules(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"0 0 30 2 *",
+		"@reboot",
+		"@every 0s",
+		"@every soon",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) accepted", spec)
+		}
+	}
+}
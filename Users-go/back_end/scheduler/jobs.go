@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/models"
+	"newworld-project/repository"
+)
+
+// Names of the built-in jobs
+const (
+	PurgeTokens          = "purge_tokens"
+	PurgeUnverifiedUsers = "purge_unverified_users"
+	PurgeDeletedUsers    = "purge_deleted_users"
+)
+
+// purgeBatchSize is how many accounts are deleted per transaction
+const purgeBatchSize = 100
+
+// emailTokenLifetime is the longest a token sent by email stays valid.
+// Dead emails keep their bodies that long so that an administrator can
+// still retry them.
+const emailTokenLifetime = 24 * time.Hour
+
+// JobsFromConfig returns the built-in jobs that have a schedule, or none if
+// the scheduler is disabled
+func JobsFromConfig(cfg config.SchedulerConfig) ([]Job, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	unverifiedRetention := time.Duration(cfg.UnverifiedUserRetention) * 24 * time.Hour
+	deletedRetention := time.Duration(cfg.DeletedUserRetention) * 24 * time.Hour
+
+	var jobs []Job
+	for _, job := range []struct {
+		name     string
+		schedule string
+		run      func(ctx context.Context, store repository.Store) (string, error)
+	}{
+		{PurgeTokens, cfg.PurgeTokensSchedule, purgeTokens},
+		{PurgeUnverifiedUsers, cfg.PurgeUnverifiedUsersSchedule, purgeUsers("unverified", unverifiedRetention, repository.UserRepository.PurgeUnverified)},
+		{PurgeDeletedUsers, cfg.PurgeDeletedUsersSchedule, purgeUsers("deleted", deletedRetention, repository.UserRepository.PurgeDeleted)},
+	} {
+		spec := strings.TrimSpace(job.schedule)
+		if spec == "" || strings.EqualFold(spec, "off") {
+			continue
+		}
+		schedule, err := Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", job.name, err)
+		}
+		jobs = append(jobs, Job{Name: job.name, Schedule: schedule, Run: job.run})
+	}
+	return jobs, nil
+}
+
+// purgeTokens deletes revoked, used and expired tokens and expired sessions,
+// and clears the bodies of dead emails whose tokens have expired
+func purgeTokens(ctx context.Context, store repository.Store) (string, error) {
+	now := time.Now()
+	tokens, err := store.Tokens().PurgeExpired(now)
+	if err != nil {
+		return "", err
+	}
+	sessions, err := store.Sessions().PurgeExpired(now)
+	if err != nil {
+		return "", err
+	}
+	emails, err := store.Outbox().PurgeDeadBodies(now.Add(-emailTokenLifetime))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("deleted %d tokens and %d sessions, cleared %d dead emails", tokens, sessions, emails), nil
+}
+
+// purgeUsers returns a job that hard-deletes the accounts selected by purge
+// once they are older than retention, recording an audit event for each
+func purgeUsers(reason string, retention time.Duration, purge func(repository.UserRepository, time.Time, int) ([]uint, error)) func(context.Context, repository.Store) (string, error) {
+	return func(ctx context.Context, store repository.Store) (string, error) {
+		cutoff := time.Now().Add(-retention)
+		total := 0
+		for ctx.Err() == nil {
+			var ids []uint
+			err := store.Transaction(func(tx repository.Store) error {
+				var err error
+				if ids, err = purge(tx.Users(), cutoff, purgeBatchSize); err != nil {
+					return err
+				}
+				for _, id := range ids {
+					id := id
+					if err := tx.Audit().Create(&models.AuditEvent{
+						TargetID: &id,
+						Action:   "system.user.purge",
+						Outcome:  models.AuditOutcomeSuccess,
+						Metadata: fmt.Sprintf(`{"reason":%q}`, reason),
+					}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Sprintf("deleted %d %s accounts", total, reason), err
+			}
+			total += len(ids)
+			if len(ids) < purgeBatchSize {
+				break
+			}
+		}
+		return fmt.Sprintf("deleted %d %s accounts", total, reason), ctx.Err()
+	}
+}
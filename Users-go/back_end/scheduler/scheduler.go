@@ -0,0 +1,151 @@
+// Package scheduler runs background jobs on cron schedules. The schedule of
+// a job is the same on every instance of the service and each run is claimed
+// through the database first, so a job runs once per scheduled time however
+// many instances are up.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"newworld-project/logging"
+	"newworld-project/repository"
+)
+
+var logger = logging.Logger(logging.Scheduler)
+
+// Job is a named task run on a schedule
+type Job struct {
+	Name     string
+	Schedule Schedule
+
+	// Run does the work and returns a short summary of what it did. It
+	// should return early when ctx is cancelled.
+	Run func(ctx context.Context, store repository.Store) (string, error)
+}
+
+// Options tune the scheduler. Zero values fall back to defaults.
+type Options struct {
+	// Owner identifies this instance in the job locks; it defaults to the
+	// host name and process ID
+	Owner string
+
+	// Lease is how long a run holds a job's lock. If an instance dies
+	// mid-run the lock expires and the job runs again at its next slot.
+	Lease time.Duration
+}
+
+// Scheduler runs jobs at their scheduled times
+type Scheduler struct {
+	store repository.Store
+	jobs  []Job
+	opts  Options
+
+	// next is the upcoming slot of each job, set on the first RunDue
+	next map[string]time.Time
+}
+
+func New(store repository.Store, jobs []Job, opts Options) *Scheduler {
+	if opts.Owner == "" {
+		host, _ := os.Hostname()
+		opts.Owner = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = time.Hour
+	}
+	return &Scheduler{store: store, jobs: jobs, opts: opts, next: map[string]time.Time{}}
+}
+
+// Run runs the jobs as they come due until ctx is cancelled. A job that is
+// running when ctx is cancelled is asked to stop and waited for. Run returns
+// straight away if there are no jobs.
+func (s *Scheduler) Run(ctx context.Context) {
+	if len(s.jobs) == 0 {
+		return
+	}
+	s.RunDue(ctx, time.Now())
+	for _, job := range s.jobs {
+		logger.Info("Scheduled job", "job", job.Name, "next_run", s.next[job.Name])
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(s.earliest()))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		s.RunDue(ctx, time.Now())
+	}
+}
+
+// RunDue runs, in the calling goroutine, every job whose next slot is at or
+// before now and that no other instance has run for that slot. The first
+// call only works out the next slots. It returns the names of the jobs it
+// ran.
+func (s *Scheduler) RunDue(ctx context.Context, now time.Time) []string {
+	var ran []string
+	for _, job := range s.jobs {
+		slot, ok := s.next[job.Name]
+		if !ok {
+			s.next[job.Name] = job.Schedule.Next(now)
+			continue
+		}
+		if slot.After(now) || ctx.Err() != nil {
+			continue
+		}
+
+		s.next[job.Name] = job.Schedule.Next(now)
+		if s.run(ctx, job, slot, now) {
+			ran = append(ran, job.Name)
+		}
+	}
+	return ran
+}
+
+// run claims the slot of a job and runs it, reporting whether it did
+func (s *Scheduler) run(ctx context.Context, job Job, slot, now time.Time) bool {
+	claimed, err := s.store.Jobs().Claim(job.Name, slot, s.opts.Owner, now, now.Add(s.opts.Lease))
+	if err != nil {
+		logger.Error("Failed to claim job", "job", job.Name, "error", err)
+		return false
+	}
+	if !claimed {
+		return false
+	}
+
+	started := time.Now()
+	result, err := job.Run(ctx, s.store)
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+		if len(lastError) > 1024 {
+			lastError = lastError[:1024]
+		}
+		logger.Error("Job failed", "job", job.Name, "duration", time.Since(started), "error", err)
+	} else {
+		logger.Info("Job finished", "job", job.Name, "duration", time.Since(started), "result", result)
+	}
+	if len(result) > 255 {
+		result = result[:255]
+	}
+
+	if err := s.store.Jobs().Finish(job.Name, s.opts.Owner, time.Now(), result, lastError); err != nil {
+		logger.Error("Failed to record job run", "job", job.Name, "error", err)
+	}
+	return true
+}
+
+// earliest returns the soonest upcoming slot of any job
+func (s *Scheduler) earliest() time.Time {
+	var earliest time.Time
+	for _, next := range s.next {
+		if !next.IsZero() && (earliest.IsZero() || next.Before(earliest)) {
+			earliest = next
+		}
+	}
+	return earliest
+}
@@ -0,0 +1,266 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/database"
+	"newworld-project/models"
+	"newworld-project/repository"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=private"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestJobRunsOncePerSlotAcrossInstances(t *testing.T) {
+	db := newTestDB(t)
+	store := repository.NewGormStore(db)
+	schedule, _ := Parse("0 * * * *")
+	runs := 0
+	job := Job{Name: "count", Schedule: schedule, Run: func(context.Context, repository.Store) (string, error) {
+		runs++
+		return "counted", nil
+	}}
+
+	ctx := context.Background()
+	start := time.Date(2030, 1, 2, 10, 30, 0, 0, time.UTC)
+	a := New(store, []Job{job}, Options{Owner: "a"})
+	b := New(store, []Job{job}, Options{Owner: "b"})
+	for _, s := range []*Scheduler{a, b} {
+		if ran := s.RunDue(ctx, start); len(ran) != 0 {
+			t.Fatalf("first RunDue ran %v", ran)
+		}
+	}
+
+	if ran := a.RunDue(ctx, start.Add(20*time.Minute)); len(ran) != 0 {
+		t.Fatalf("ran %v before 11:00", ran)
+	}
+
+	// Both instances reach the 11:00 and 12:00 slots; each slot runs once
+	for _, at := range []time.Time{start.Add(31 * time.Minute), start.Add(90 * time.Minute)} {
+		ranA, ranB := a.RunDue(ctx, at), b.RunDue(ctx, at.Add(time.Second))
+		if len(ranA)+len(ranB) != 1 {
+			t.Errorf("at %s: a ran %v, b ran %v", at.Format("15:04"), ranA, ranB)
+		}
+	}
+	if runs != 2 {
+		t.Errorf("runs = %d, want 2", runs)
+	}
+
+	var state models.ScheduledJob
+	if err := db.First(&state, "name = ?", "count").Error; err != nil {
+		t.Fatal(err)
+	}
+	if state.LockedBy != "" || state.LockedUntil != nil || state.LastResult != "counted" || !state.LastSlot.Equal(start.Add(90*time.Minute)) {
+		t.Errorf("job state %+v", state)
+	}
+}
+
+func TestJobLockHeldUntilLeaseExpires(t *testing.T) {
+	db := newTestDB(t)
+	jobs := repository.NewGormStore(db).Jobs()
+	now := time.Date(2030, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	// a crashes while running the 10:00 slot
+	if ok, err := jobs.Claim("purge", now, "a", now, now.Add(time.Hour)); !ok || err != nil {
+		t.Fatalf("claim = %v, %v", ok, err)
+	}
+
+	tests := []struct {
+		slot, at time.Time
+		want     bool
+	}{
+		{now, now.Add(time.Minute), false},
+		{now.Add(30 * time.Minute), now.Add(30 * time.Minute), false},
+		{now.Add(time.Hour), now.Add(time.Hour), true},
+		{now.Add(time.Hour), now.Add(2 * time.Hour), false},
+	}
+	for _, tt := range tests {
+		if ok, err := jobs.Claim("purge", tt.slot, "b", tt.at, tt.at.Add(time.Hour)); ok != tt.want || err != nil {
+			t.Errorf("claim slot %s at %s = %v, %v; want %v", tt.slot.Format("15:04"), tt.at.Format("15:04"), ok, err, tt.want)
+		}
+	}
+
+	// a's late report does not release b's lock
+	if err := jobs.Finish("purge", "a", now.Add(time.Hour), "", "killed"); err != nil {
+		t.Fatal(err)
+	}
+	var state models.ScheduledJob
+	db.First(&state, "name = ?", "purge")
+	if state.LockedBy != "b" || state.LastError != "" {
+		t.Errorf("job state %+v", state)
+	}
+}
+
+func TestFailedJobIsRecorded(t *testing.T) {
+	db := newTestDB(t)
+	schedule, _ := Parse("@every 1m")
+	s := New(repository.NewGormStore(db), []Job{{Name: "broken", Schedule: schedule, Run: func(context.Context, repository.Store) (string, error) {
+		return "", errors.New("disk full")
+	}}}, Options{})
+
+	now := time.Now()
+	s.RunDue(context.Background(), now)
+	if ran := s.RunDue(context.Background(), now.Add(time.Minute)); len(ran) != 1 {
+		t.Fatalf("ran %v", ran)
+	}
+	var state models.ScheduledJob
+	db.First(&state, "name = ?", "broken")
+	if state.LastError != "disk full" || state.LastFinishedAt == nil || state.LockedUntil != nil {
+		t.Errorf("job state %+v", state)
+	}
+}
+
+func TestJobsFromConfig(t *testing.T) {
+	cfg := config.SchedulerConfig{
+		Enabled:                      true,
+		PurgeTokensSchedule:          "@hourly",
+		PurgeUnverifiedUsersSchedule: "off",
+		PurgeDeletedUsersSchedule:    "0 4 * * *",
+	}
+	jobs, err := JobsFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].Name != PurgeTokens || jobs[1].Name != PurgeDeletedUsers {
+		t.Errorf("jobs = %v", jobs)
+	}
+
+	cfg.PurgeTokensSchedule = "every hour"
+	if _, err := JobsFromConfig(cfg); err == nil {
+		t.Error("invalid schedule accepted")
+	}
+
+	cfg.Enabled = false
+	if jobs, err := JobsFromConfig(cfg); len(jobs) != 0 || err != nil {
+		t.Errorf("disabled scheduler has jobs %v, %v", jobs, err)
+	}
+}
+
+func findJob(t *testing.T, name string, cfg config.SchedulerConfig) Job {
+	cfg.Enabled = true
+	cfg.PurgeTokensSchedule = "@hourly"
+	cfg.PurgeUnverifiedUsersSchedule = "@daily"
+	cfg.PurgeDeletedUsersSchedule = "@daily"
+	jobs, err := JobsFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+	t.Fatalf("no job %s", name)
+	return Job{}
+}
+
+func TestPurgeTokens(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+
+	db.Create(&models.TokenBlacklist{TokenID: "expired", ExpiresAt: past})
+	db.Create(&models.TokenBlacklist{TokenID: "live", ExpiresAt: future})
+	db.Create(&models.EmailVerificationToken{UserID: 1, TokenHash: "expired", ExpiresAt: past})
+	db.Create(&models.EmailVerificationToken{UserID: 1, TokenHash: "used", ExpiresAt: future, Used: true})
+	db.Create(&models.EmailVerificationToken{UserID: 1, TokenHash: "live", ExpiresAt: future})
+	db.Create(&models.PasswordResetToken{UserID: 1, TokenHash: "expired", ExpiresAt: past})
+	db.Create(&models.AccountUnlockToken{UserID: 1, TokenHash: "used", ExpiresAt: future, Used: true})
+	db.Create(&models.Session{UserID: 1, FamilyID: "expired", ExpiresAt: past})
+	db.Create(&models.Session{UserID: 1, FamilyID: "live", ExpiresAt: future})
+	db.Create(&models.RefreshTokenRecord{UserID: 1, FamilyID: "expired", TokenID: "expired", ExpiresAt: past})
+	db.Create(&models.WebAuthnSession{SessionID: "expired", Ceremony: "login", Data: "{}", ExpiresAt: past})
+	for _, deadFor := range []time.Duration{25 * time.Hour, time.Hour} {
+		email := &models.OutboxEmail{Recipient: "alice@example.com", Subject: "Verify", HTML: "token", Text: "token", Status: models.EmailStatusDead}
+		db.Create(email)
+		db.Model(email).UpdateColumn("updated_at", now.Add(-deadFor))
+	}
+
+	result, err := findJob(t, PurgeTokens, config.SchedulerConfig{}).Run(context.Background(), repository.NewGormStore(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "deleted 5 tokens and 3 sessions, cleared 1 dead emails" {
+		t.Errorf("result = %q", result)
+	}
+
+	var blacklisted, verifications, sessions int64
+	db.Model(&models.TokenBlacklist{}).Count(&blacklisted)
+	db.Model(&models.EmailVerificationToken{}).Count(&verifications)
+	db.Model(&models.Session{}).Count(&sessions)
+	if blacklisted != 1 || verifications != 1 || sessions != 1 {
+		t.Errorf("left %d blacklisted, %d verification tokens, %d sessions; want 1 of each", blacklisted, verifications, sessions)
+	}
+
+	var emails []models.OutboxEmail
+	db.Order("id").Find(&emails)
+	if len(emails) != 2 || emails[0].HTML != "" || emails[0].Text != "" || emails[1].HTML == "" {
+		t.Errorf("dead email bodies after purge = %+v, want only the older one cleared", emails)
+	}
+}
+
+func TestPurgeUsers(t *testing.T) {
+	db := newTestDB(t)
+	old := time.Now().AddDate(0, 0, -10)
+	recent := time.Now().AddDate(0, 0, -2)
+
+	create := func(username string, verified bool, createdAt time.Time, lastLoginAt, deletedAt *time.Time) *models.User {
+		user := &models.User{Username: username, Email: username + "@example.com", Password: "x", EmailVerified: verified, LastLoginAt: lastLoginAt, CreatedAt: createdAt}
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+		if deletedAt != nil {
+			db.Unscoped().Model(user).Update("deleted_at", *deletedAt)
+		}
+		db.Create(&models.Session{UserID: user.ID, FamilyID: username, ExpiresAt: time.Now().Add(time.Hour)})
+		return user
+	}
+	stale := create("stale", false, old, nil, nil)
+	create("fresh", false, recent, nil, nil)
+	create("verified", true, old, nil, nil)
+	create("signedin", false, old, &recent, nil)
+	gone := create("gone", true, old, nil, &old)
+	create("justgone", true, old, nil, &recent)
+
+	store := repository.NewGormStore(db)
+	cfg := config.SchedulerConfig{UnverifiedUserRetention: 7, DeletedUserRetention: 7}
+	for name, want := range map[string]string{
+		PurgeUnverifiedUsers: "deleted 1 unverified accounts",
+		PurgeDeletedUsers:    "deleted 1 deleted accounts",
+	} {
+		if result, err := findJob(t, name, cfg).Run(context.Background(), store); result != want || err != nil {
+			t.Errorf("%s = %q, %v; want %q", name, result, err, want)
+		}
+	}
+
+	var remaining []string
+	db.Unscoped().Model(&models.User{}).Order("id").Pluck("username", &remaining)
+	if len(remaining) != 4 || remaining[0] != "fresh" || remaining[3] != "justgone" {
+		t.Errorf("remaining users %v", remaining)
+	}
+
+	var orphans, events int64
+	db.Model(&models.Session{}).Where("user_id IN ?", []uint{stale.ID, gone.ID}).Count(&orphans)
+	db.Model(&models.AuditEvent{}).Where("action = ? AND target_id IN ?", "system.user.purge", []uint{stale.ID, gone.ID}).Count(&events)
+	if orphans != 0 || events != 2 {
+		t.Errorf("%d sessions of purged users left, %d audit events", orphans, events)
+	}
+}
@@ -0,0 +1,134 @@
+// Package server opens the listener the HTTP server runs on, with TLS if
+// configured, and builds the http.Server with the configured timeouts.
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"newworld-project/config"
+)
+
+// autoPortRange is how many ports after SERVER_PORT auto-port tries
+const autoPortRange = 100
+
+// Listen opens the listener described by cfg: a TCP address from Host and
+// Port by default, a Unix socket for a Listen of "unix:<path>" or the socket
+// passed by systemd for "systemd". A TCP port that is taken is an error
+// unless AutoPort is set, in which case the next free port is used. The
+// bound port is written to PortFile if set. The listener serves TLS when
+// cfg.TLS is enabled.
+func Listen(cfg config.ServerConfig) (net.Listener, error) {
+	var tlsConfig *tls.Config
+	if cfg.TLS.Enabled() {
+		var err error
+		if tlsConfig, err = NewTLSConfig(cfg.TLS); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := listen(cfg)
+	if err != nil || tlsConfig == nil {
+		return listener, err
+	}
+	return tls.NewListener(listener, tlsConfig), nil
+}
+
+func listen(cfg config.ServerConfig) (net.Listener, error) {
+	switch {
+	case cfg.Listen == "systemd":
+		return systemdListener()
+	case strings.HasPrefix(cfg.Listen, "unix:"):
+		return unixListener(strings.TrimPrefix(cfg.Listen, "unix:"))
+	case cfg.Listen != "":
+		return nil, fmt.Errorf("invalid SERVER_LISTEN %q: must be unix:<path> or systemd", cfg.Listen)
+	}
+
+	port, err := strconv.Atoi(cfg.Port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SERVER_PORT %q", cfg.Port)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(cfg.Host, cfg.Port))
+	// Port 0 already asks the kernel for any free port
+	if err != nil && cfg.AutoPort && port != 0 {
+		for next := port + 1; next <= port+autoPortRange && next <= 65535; next++ {
+			if listener, err = net.Listen("tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(next))); err == nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		if cfg.AutoPort {
+			return nil, fmt.Errorf("no free port between %d and %d on %q: %w", port, port+autoPortRange, cfg.Host, err)
+		}
+		return nil, fmt.Errorf("cannot listen on %s (set SERVER_PORT to a free port): %w", net.JoinHostPort(cfg.Host, cfg.Port), err)
+	}
+
+	if cfg.PortFile != "" {
+		bound := listener.Addr().(*net.TCPAddr).Port
+		if err := os.WriteFile(cfg.PortFile, []byte(strconv.Itoa(bound)+"\n"), 0o644); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("SERVER_PORT_FILE: %w", err)
+		}
+	}
+	return listener, nil
+}
+
+// unixListener listens on a Unix socket, replacing a socket file left behind
+// by a server that is no longer running
+func unixListener(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("SERVER_LISTEN unix: needs a socket path")
+	}
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("cannot listen on %s: file exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("cannot listen on %s: another server is using it", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+// systemdListener takes over the socket passed by systemd socket activation
+// (LISTEN_PID and LISTEN_FDS, with the socket as file descriptor 3)
+func systemdListener() (net.Listener, error) {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	fds, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if pid != os.Getpid() || fds < 1 {
+		return nil, errors.New("SERVER_LISTEN is systemd but no socket was passed; start the service from a .socket unit")
+	}
+	if fds > 1 {
+		return nil, fmt.Errorf("systemd passed %d sockets, want 1", fds)
+	}
+	// Keep the sockets from being inherited by child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	const firstFD = 3
+	file := os.NewFile(firstFD, "systemd socket")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("systemd socket: %w", err)
+	}
+	return listener, nil
+}
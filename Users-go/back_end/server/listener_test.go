@@ -0,0 +1,113 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"newworld-project/config"
+)
+
+// takenPort returns a port another listener holds until the test ends
+func takenPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestListenTakenPortFails(t *testing.T) {
+	port := takenPort(t)
+	_, err := Listen(config.ServerConfig{Host: "127.0.0.1", Port: strconv.Itoa(port)})
+	if err == nil || !strings.Contains(err.Error(), "SERVER_PORT") {
+		t.Fatalf("Listen on a taken port: %v", err)
+	}
+}
+
+func TestListenAutoPortWritesPortFile(t *testing.T) {
+	port := takenPort(t)
+	portFile := filepath.Join(t.TempDir(), "port")
+	l, err := Listen(config.ServerConfig{Host: "127.0.0.1", Port: strconv.Itoa(port), AutoPort: true, PortFile: portFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	bound := l.Addr().(*net.TCPAddr).Port
+	if bound == port {
+		t.Fatalf("bound the taken port %d", port)
+	}
+	data, err := os.ReadFile(portFile)
+	if err != nil || string(data) != strconv.Itoa(bound)+"\n" {
+		t.Errorf("port file = %q, %v; want %d", data, err, bound)
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	cfg := config.ServerConfig{Listen: "unix:" + path}
+
+	l, err := Listen(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(cfg); err == nil || !strings.Contains(err.Error(), "another server") {
+		t.Errorf("second listener on a live socket: %v", err)
+	}
+
+	srv := New(config.ServerConfig{ReadTimeout: 5}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	if srv.ReadTimeout != 5*time.Second || srv.WriteTimeout != 0 {
+		t.Errorf("timeouts read %s, write %s", srv.ReadTimeout, srv.WriteTimeout)
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	client := http.Client{Transport: &http.Transport{
+		Dial: func(string, string) (net.Conn, error) { return net.Dial("unix", path) },
+	}}
+	resp, err := client.Get("http://unix/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d", resp.StatusCode)
+	}
+
+	// A socket file left behind by a dead server is replaced
+	stale, err := net.Listen("unix", filepath.Join(t.TempDir(), "stale.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stalePath := stale.Addr().String()
+	stale.Close()
+	l, err = Listen(config.ServerConfig{Listen: "unix:" + stalePath})
+	if err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	l.Close()
+
+	notSocket := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(notSocket, nil, 0o644)
+	if _, err := Listen(config.ServerConfig{Listen: "unix:" + notSocket}); err == nil {
+		t.Error("regular file replaced by a socket")
+	}
+}
+
+func TestListenSystemdWithoutSocket(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if _, err := Listen(config.ServerConfig{Listen: "systemd"}); err == nil || !strings.Contains(err.Error(), "socket") {
+		t.Errorf("Listen = %v, want an error about the missing socket", err)
+	}
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/logging"
+)
+
+// New builds the HTTP server for handler with the timeouts from cfg. A zero
+// timeout means none. Errors such as failed TLS handshakes are logged as
+// warnings of the server subsystem.
+func New(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ErrorLog:          slog.NewLogLogger(logging.Logger(logging.Server).Handler(), slog.LevelWarn),
+		ReadTimeout:       seconds(cfg.ReadTimeout),
+		ReadHeaderTimeout: seconds(cfg.ReadHeaderTimeout),
+		WriteTimeout:      seconds(cfg.WriteTimeout),
+		IdleTimeout:       seconds(cfg.IdleTimeout),
+	}
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"newworld-project/config"
+	"newworld-project/logging"
+)
+
+// NewTLSConfig builds the TLS configuration for cfg. The certificate, key
+// and client CA files are read now, so a missing or invalid file fails
+// startup, and read again when they change; a rotated file that cannot be
+// loaded is logged and the previous one kept.
+func NewTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	version, err := cfg.Version()
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := cfg.CipherSuiteIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion:   version,
+		CipherSuites: cipherSuites,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if cfg.ClientCAFile != "" {
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.ClientAuth == "require" {
+			base.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	r := &tlsReloader{
+		base:     base,
+		files:    []string{cfg.CertFile, cfg.KeyFile, cfg.ClientCAFile},
+		interval: time.Duration(cfg.ReloadInterval) * time.Second,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	// The returned config only hands each handshake to the current one
+	return &tls.Config{
+		MinVersion:         version,
+		NextProtos:         base.NextProtos,
+		GetConfigForClient: r.configForClient,
+	}, nil
+}
+
+// tlsReloader holds the TLS configuration loaded from the certificate, key
+// and client CA files, reloading it when one of them changes
+type tlsReloader struct {
+	base     *tls.Config
+	files    []string
+	interval time.Duration
+
+	mu        sync.Mutex
+	current   *tls.Config
+	modTimes  []time.Time
+	checkedAt time.Time
+}
+
+func (r *tlsReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= r.interval {
+		r.checkedAt = time.Now()
+		if r.changed() {
+			if err := r.loadLocked(); err != nil {
+				logging.Logger(logging.Server).Error("Failed to reload TLS certificates, keeping the previous ones", "error", err)
+			} else {
+				logging.Logger(logging.Server).Info("Reloaded TLS certificates")
+			}
+		}
+	}
+	return r.current, nil
+}
+
+func (r *tlsReloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkedAt = time.Now()
+	return r.loadLocked()
+}
+
+// loadLocked reads the files into a new configuration. Modification times
+// are recorded first, so a file replaced while it is read, or one that
+// failed to load, is read again once it changes.
+func (r *tlsReloader) loadLocked() error {
+	r.modTimes = r.stat()
+	cert, key, ca := r.files[0], r.files[1], r.files[2]
+
+	certificate, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return fmt.Errorf("TLS_CERT_FILE/TLS_KEY_FILE: %w", err)
+	}
+	next := r.base.Clone()
+	next.Certificates = []tls.Certificate{certificate}
+
+	if ca != "" {
+		data, err := os.ReadFile(ca)
+		if err != nil {
+			return fmt.Errorf("TLS_CLIENT_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return errors.New("TLS_CLIENT_CA_FILE: no PEM certificates found")
+		}
+		next.ClientCAs = pool
+	}
+
+	r.current = next
+	return nil
+}
+
+// stat returns the modification time of each file, the zero time for one
+// that is unset or missing
+func (r *tlsReloader) stat() []time.Time {
+	modTimes := make([]time.Time, len(r.files))
+	for i, file := range r.files {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+func (r *tlsReloader) changed() bool {
+	for i, modTime := range r.stat() {
+		if !modTime.Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"newworld-project/config"
+)
+
+// testCert is a certificate and key signed by parent, or self-signed when
+// parent is nil
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, certFile, c.certPEM())
+	writeTestFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveTLS serves the client certificate's common name, if any, over a TLS
+// listener for cfg and returns its address
+func serveTLS(t *testing.T, cfg config.TLSConfig) string {
+	l, err := Listen(config.ServerConfig{Host: "127.0.0.1", Port: "0", TLS: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(config.ServerConfig{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) > 0 {
+			w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+		}
+	}))
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return l.Addr().String()
+}
+
+func TestTLSReloadsRotatedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "Test CA", nil)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	first := newTestCert(t, "localhost", ca)
+	first.write(t, certFile, keyFile)
+	addr := serveTLS(t, config.TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2"})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	served := func() *big.Int {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber
+	}
+	if got := served(); got.Cmp(first.cert.SerialNumber) != 0 {
+		t.Fatalf("served serial %s, want %s", got, first.cert.SerialNumber)
+	}
+
+	rotated := newTestCert(t, "localhost", ca)
+	rotated.write(t, certFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if got := served(); got.Cmp(rotated.cert.SerialNumber) != 0 {
+		t.Errorf("served serial %s after rotation, want %s", got, rotated.cert.SerialNumber)
+	}
+
+	// A broken replacement keeps the last good certificate
+	writeTestFile(t, certFile, []byte("not a certificate"))
+	os.Chtimes(certFile, later.Add(time.Minute), later.Add(time.Minute))
+	if got := served(); got.Cmp(rotated.cert.SerialNumber) != 0 {
+		t.Errorf("served serial %s after a bad rotation, want %s", got, rotated.cert.SerialNumber)
+	}
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	newTestCert(t, "localhost", nil).write(t, certFile, keyFile)
+	addr := serveTLS(t, config.TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3"})
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12})
+	if err == nil {
+		conn.Close()
+		t.Fatal("TLS 1.2 client accepted with a 1.3 minimum")
+	}
+}
+
+func TestTLSClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "Client CA", nil)
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	newTestCert(t, "localhost", nil).write(t, certFile, keyFile)
+	writeTestFile(t, caFile, ca.certPEM())
+	service := newTestCert(t, "billing.internal", ca)
+	stranger := newTestCert(t, "stranger", newTestCert(t, "Other CA", nil))
+
+	get := func(addr string, client *testCert) (string, error) {
+		clientConfig := &tls.Config{InsecureSkipVerify: true}
+		if client != nil {
+			// Send the certificate even if the server does not list its CA
+			clientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				cert := client.tlsCertificate()
+				return &cert, nil
+			}
+		}
+		httpClient := http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		resp, err := httpClient.Get("https://" + addr + "/")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	cfg := config.TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", ClientCAFile: caFile, ClientAuth: "optional"}
+	optional := serveTLS(t, cfg)
+	if got, err := get(optional, service); err != nil || got != "billing.internal" {
+		t.Errorf("optional, trusted certificate: %q, %v", got, err)
+	}
+	if got, err := get(optional, nil); err != nil || got != "" {
+		t.Errorf("optional, no certificate: %q, %v", got, err)
+	}
+	if _, err := get(optional, stranger); err == nil {
+		t.Error("optional: certificate from an unknown CA accepted")
+	}
+
+	cfg.ClientAuth = "require"
+	required := serveTLS(t, cfg)
+	if _, err := get(required, nil); err == nil {
+		t.Error("require: connection without a certificate accepted")
+	}
+	if got, err := get(required, service); err != nil || got != "billing.internal" {
+		t.Errorf("require, trusted certificate: %q, %v", got, err)
+	}
+}
+
+func TestNewTLSConfigRejectsBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	newTestCert(t, "localhost", nil).write(t, certFile, keyFile)
+	writeTestFile(t, filepath.Join(dir, "empty.crt"), nil)
+
+	tests := []struct {
+		name string
+		cfg  config.TLSConfig
+	}{
+		{"missing key", config.TLSConfig{CertFile: certFile, KeyFile: filepath.Join(dir, "missing"), MinVersion: "1.2"}},
+		{"client CA without certificates", config.TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", ClientCAFile: filepath.Join(dir, "empty.crt")}},
+		{"insecure cipher suite", config.TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewTLSConfig(tt.cfg); err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+}
+
+func TestListenTLSWithoutCertificate(t *testing.T) {
+	cfg := config.ServerConfig{Host: "127.0.0.1", Port: "0", TLS: config.TLSConfig{CertFile: "missing.crt", KeyFile: "missing.key", MinVersion: "1.2"}}
+	if _, err := Listen(cfg); err == nil || !strings.Contains(err.Error(), "TLS_CERT_FILE") {
+		t.Errorf("Listen = %v, want an error about the certificate", err)
+	}
+}
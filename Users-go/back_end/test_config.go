@@ -1,3 +1,8 @@
+//go:build ignore
+
+// Prints the loaded configuration and checks the port. Run it with
+// "go run test_config.go"; the build tag keeps it out of the main package.
+
 package main
 
 import (
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"newworld-project/config"
 	"time"
@@ -8,11 +10,27 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Values of the token_use claim
+const (
+	TokenUseAccess       = "access"
+	TokenUseRefresh      = "refresh"
+	TokenUseMFAChallenge = "mfa_challenge"
+)
+
+var ErrWrongTokenUse = errors.New("token is not valid for this use")
+
 type JWTClaims struct {
 	UserID   uint   `json:"userId"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Role     string `json:"role"`
+	TokenUse string `json:"token_use"`
+	// SessionID ties access and refresh tokens to the login session that
+	// issued them, so revoking the session invalidates both
+	SessionID string `json:"sid,omitempty"`
+	// TokenVersion must match the user's token version; it is bumped when
+	// the password changes to invalidate every token issued before
+	TokenVersion int `json:"ver"`
 	jwt.RegisteredClaims
 }
 
@@ -21,49 +39,87 @@ type TokenPair struct {
 	RefreshToken string `json:"refreshToken"`
 	ExpiresIn    int    `json:"expiresIn"`
 	TokenType    string `json:"tokenType"`
+
+	// RefreshTokenID and RefreshExpiresAt describe the refresh token so that
+	// callers can persist it; they are never sent to clients.
+	RefreshTokenID   string    `json:"-"`
+	RefreshExpiresAt time.Time `json:"-"`
+}
+
+// TokenService signs and validates the JWTs of one application instance
+type TokenService struct {
+	cfg config.JWTConfig
+	// keys is nil when tokens are signed with the shared HS256 secret
+	keys *KeySet
+}
+
+// NewTokenService builds the token service for cfg, loading the signing and
+// verification keys it names unless the algorithm is HS256
+func NewTokenService(cfg config.JWTConfig) (*TokenService, error) {
+	s := &TokenService{cfg: cfg}
+	if cfg.Algorithm == "" || cfg.Algorithm == AlgorithmHS256 {
+		return s, nil
+	}
+
+	ks, err := NewKeySet(cfg.Algorithm, cfg.SigningKeyFile, cfg.VerificationKeyFiles)
+	if err != nil {
+		return nil, err
+	}
+	s.keys = ks
+	return s, nil
 }
 
-func GenerateTokenPair(userID uint, username, email, role string) (*TokenPair, error) {
-	cfg := config.ConfigInstance.JWT
+func (s *TokenService) GenerateTokenPair(userID uint, username, email, role, sessionID string, tokenVersion int) (*TokenPair, error) {
+	cfg := s.cfg
+	now := time.Now()
 
 	// Generate access token
-	accessTokenExpiry := time.Now().Add(time.Duration(cfg.AccessTokenExpiry) * time.Second)
+	accessTokenExpiry := now.Add(time.Duration(cfg.AccessTokenExpiry) * time.Second)
 	accessTokenClaims := JWTClaims{
-		UserID:   userID,
-		Username: username,
-		Email:    email,
-		Role:     role,
+		UserID:       userID,
+		Username:     username,
+		Email:        email,
+		Role:         role,
+		TokenUse:     TokenUseAccess,
+		SessionID:    sessionID,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        GenerateRandomString(32),
 			ExpiresAt: jwt.NewNumericDate(accessTokenExpiry),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "newworld-project",
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    cfg.Issuer,
+			Audience:  jwt.ClaimStrings{cfg.Audience},
 			Subject:   username,
 		},
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims)
-	accessTokenString, err := accessToken.SignedString([]byte(cfg.Secret))
+	accessTokenString, err := s.signToken(accessTokenClaims)
 	if err != nil {
 		return nil, err
 	}
 
 	// Generate refresh token
-	refreshTokenExpiry := time.Now().Add(time.Duration(cfg.RefreshTokenExpiry) * time.Second)
+	refreshTokenID := GenerateRandomString(32)
+	refreshTokenExpiry := now.Add(time.Duration(cfg.RefreshTokenExpiry) * time.Second)
 	refreshTokenClaims := JWTClaims{
-		UserID:   userID,
-		Username: username,
-		Email:    email,
-		Role:     role,
+		UserID:       userID,
+		Username:     username,
+		Email:        email,
+		Role:         role,
+		TokenUse:     TokenUseRefresh,
+		SessionID:    sessionID,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        refreshTokenID,
 			ExpiresAt: jwt.NewNumericDate(refreshTokenExpiry),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "newworld-project",
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    cfg.Issuer,
+			Audience:  jwt.ClaimStrings{cfg.Audience},
 			Subject:   username,
 		},
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshTokenClaims)
-	refreshTokenString, err := refreshToken.SignedString([]byte(cfg.Secret))
+	refreshTokenString, err := s.signToken(refreshTokenClaims)
 	if err != nil {
 		return nil, err
 	}
@@ -73,32 +129,121 @@ func GenerateTokenPair(userID uint, username, email, role string) (*TokenPair, e
 		RefreshToken: refreshTokenString,
 		ExpiresIn:    cfg.AccessTokenExpiry,
 		TokenType:    "Bearer",
+
+		RefreshTokenID:   refreshTokenID,
+		RefreshExpiresAt: refreshTokenExpiry,
 	}, nil
 }
 
-func ValidateToken(tokenString string) (*JWTClaims, error) {
+// GenerateMFAChallengeToken issues the short-lived token a client exchanges,
+// together with a second-factor code, for a token pair.
+func (s *TokenService) GenerateMFAChallengeToken(userID uint, username string) (string, error) {
+	cfg := s.cfg
+	now := time.Now()
+
+	return s.signToken(JWTClaims{
+		UserID:   userID,
+		Username: username,
+		TokenUse: TokenUseMFAChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        GenerateRandomString(32),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(cfg.MFAChallengeExpiry) * time.Second)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    cfg.Issuer,
+			Audience:  jwt.ClaimStrings{cfg.Audience},
+			Subject:   username,
+		},
+	})
+}
+
+func (s *TokenService) signToken(claims JWTClaims) (string, error) {
+	if s.keys != nil {
+		return s.keys.sign(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(s.cfg.Secret))
+}
+
+// ValidateToken checks the signature, expiry, issuer and audience of a token
+// of either kind. Use ValidateAccessToken or ValidateRefreshToken to also
+// enforce what the token may be used for.
+func (s *TokenService) ValidateToken(tokenString string) (*JWTClaims, error) {
+	cfg := s.cfg
+
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if s.keys != nil {
+			return s.keys.keyFunc(token)
+		}
+		if token.Method != jwt.SigningMethodHS256 {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(config.ConfigInstance.JWT.Secret), nil
-	})
+		return []byte(cfg.Secret), nil
+	},
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.Audience),
+		jwt.WithExpirationRequired(),
+	)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+		if claims.ID == "" {
+			return nil, errors.New("token has no jti")
+		}
 		return claims, nil
 	}
 
 	return nil, errors.New("invalid token")
 }
 
+// ValidateAccessToken validates a token presented as a bearer credential.
+func (s *TokenService) ValidateAccessToken(tokenString string) (*JWTClaims, error) {
+	return s.validateTokenUse(tokenString, TokenUseAccess)
+}
+
+// ValidateRefreshToken validates a token presented to the refresh endpoint.
+func (s *TokenService) ValidateRefreshToken(tokenString string) (*JWTClaims, error) {
+	return s.validateTokenUse(tokenString, TokenUseRefresh)
+}
+
+// ValidateMFAChallengeToken validates a token returned by a login that still
+// needs a second factor.
+func (s *TokenService) ValidateMFAChallengeToken(tokenString string) (*JWTClaims, error) {
+	return s.validateTokenUse(tokenString, TokenUseMFAChallenge)
+}
+
+func (s *TokenService) validateTokenUse(tokenString, use string) (*JWTClaims, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenUse != use {
+		return nil, ErrWrongTokenUse
+	}
+
+	return claims, nil
+}
+
 func GenerateEmailVerificationToken() string {
 	return GenerateRandomString(64)
 }
 
 func GeneratePasswordResetToken() string {
 	return GenerateRandomString(64)
-} 
\ No newline at end of file
+}
+
+func GenerateAccountUnlockToken() string {
+	return GenerateRandomString(64)
+}
+
+// HashToken returns the SHA-256 digest a single-use email token is stored
+// and looked up by. The tokens are long and random, so an unsalted hash is
+// enough to make a leaked digest useless.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
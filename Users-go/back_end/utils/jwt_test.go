@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"newworld-project/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testTokenService signs with the HS256 test secret, or with ks if set
+func testTokenService(ks *KeySet) *TokenService {
+	return &TokenService{
+		cfg: config.JWTConfig{
+			Secret:             "test-secret",
+			Issuer:             "newworld-project",
+			Audience:           "newworld-api",
+			AccessTokenExpiry:  3600,
+			RefreshTokenExpiry: 604800,
+		},
+		keys: ks,
+	}
+}
+
+func TestTokenPairClaims(t *testing.T) {
+	tokens := testTokenService(nil)
+
+	pair, err := tokens.GenerateTokenPair(1, "alice", "alice@example.com", "user", "session-1", 0)
+	if err != nil {
+		t.Fatalf("GenerateTokenPair: %v", err)
+	}
+
+	access, err := tokens.ValidateAccessToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("tokens.ValidateAccessToken(access): %v", err)
+	}
+	refresh, err := tokens.ValidateRefreshToken(pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("tokens.ValidateRefreshToken(refresh): %v", err)
+	}
+
+	if access.TokenUse != TokenUseAccess || refresh.TokenUse != TokenUseRefresh {
+		t.Errorf("token_use = %q/%q, want %q/%q", access.TokenUse, refresh.TokenUse, TokenUseAccess, TokenUseRefresh)
+	}
+	if access.ID == "" || access.ID == refresh.ID {
+		t.Errorf("jti not unique: access %q, refresh %q", access.ID, refresh.ID)
+	}
+	if refresh.ID != pair.RefreshTokenID {
+		t.Errorf("refresh jti = %q, want %q", refresh.ID, pair.RefreshTokenID)
+	}
+
+	other, err := tokens.GenerateTokenPair(1, "alice", "alice@example.com", "user", "session-1", 0)
+	if err != nil {
+		t.Fatalf("GenerateTokenPair: %v", err)
+	}
+	otherAccess, _ := tokens.ValidateAccessToken(other.AccessToken)
+	if otherAccess.ID == access.ID {
+		t.Errorf("two access tokens share jti %q", access.ID)
+	}
+}
+
+func TestTokenServicesAreIndependent(t *testing.T) {
+	cfg := config.JWTConfig{Algorithm: AlgorithmHS256, Secret: "first-secret", Issuer: "newworld-project", Audience: "newworld-api", AccessTokenExpiry: 3600, RefreshTokenExpiry: 604800}
+	first, err := NewTokenService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Secret = "second-secret"
+	second, err := NewTokenService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := first.GenerateTokenPair(1, "alice", "alice@example.com", "user", "session-1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.ValidateAccessToken(pair.AccessToken); err != nil {
+		t.Errorf("own token rejected: %v", err)
+	}
+	if _, err := second.ValidateAccessToken(pair.AccessToken); err == nil {
+		t.Error("token accepted by a service with another secret")
+	}
+}
+
+func TestTokensRejectedInEachOthersPlace(t *testing.T) {
+	tokens := testTokenService(nil)
+
+	pair, err := tokens.GenerateTokenPair(1, "alice", "alice@example.com", "user", "session-1", 0)
+	if err != nil {
+		t.Fatalf("GenerateTokenPair: %v", err)
+	}
+
+	if _, err := tokens.ValidateAccessToken(pair.RefreshToken); !errors.Is(err, ErrWrongTokenUse) {
+		t.Errorf("tokens.ValidateAccessToken(refresh) error = %v, want ErrWrongTokenUse", err)
+	}
+	if _, err := tokens.ValidateRefreshToken(pair.AccessToken); !errors.Is(err, ErrWrongTokenUse) {
+		t.Errorf("tokens.ValidateRefreshToken(access) error = %v, want ErrWrongTokenUse", err)
+	}
+}
+
+func TestValidateTokenRejectsForeignClaims(t *testing.T) {
+	tokens := testTokenService(nil)
+
+	base := func() JWTClaims {
+		return JWTClaims{
+			UserID:   1,
+			TokenUse: TokenUseAccess,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        "jti",
+				Issuer:    "newworld-project",
+				Audience:  jwt.ClaimStrings{"newworld-api"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*JWTClaims)
+	}{
+		{"wrong issuer", func(c *JWTClaims) { c.Issuer = "someone-else" }},
+		{"wrong audience", func(c *JWTClaims) { c.Audience = jwt.ClaimStrings{"other-api"} }},
+		{"missing audience", func(c *JWTClaims) { c.Audience = nil }},
+		{"missing jti", func(c *JWTClaims) { c.ID = "" }},
+		{"missing expiry", func(c *JWTClaims) { c.ExpiresAt = nil }},
+		{"expired", func(c *JWTClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := base()
+			tt.modify(&claims)
+			token, err := tokens.signToken(claims)
+			if err != nil {
+				t.Fatalf("signToken: %v", err)
+			}
+			if _, err := tokens.ValidateAccessToken(token); err == nil {
+				t.Error("token was accepted")
+			}
+		})
+	}
+
+	token, err := tokens.signToken(base())
+	if err != nil {
+		t.Fatalf("signToken: %v", err)
+	}
+	if _, err := tokens.ValidateAccessToken(token); err != nil {
+		t.Errorf("valid token rejected: %v", err)
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	// SHA-256 test vector
+	if got := HashToken("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("HashToken(abc) = %s", got)
+	}
+	if HashToken(GenerateEmailVerificationToken()) == HashToken(GenerateEmailVerificationToken()) {
+		t.Error("different tokens hash the same")
+	}
+}
@@ -0,0 +1,320 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported values of JWTConfig.Algorithm
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type verificationKey struct {
+	alg string
+	key crypto.PublicKey
+	jwk JWK
+}
+
+// KeySet holds the asymmetric key used to sign new tokens and every public
+// key that tokens may still be verified with, indexed by kid.
+type KeySet struct {
+	signingKID    string
+	signingMethod jwt.SigningMethod
+	signingKey    crypto.Signer
+	verification  map[string]verificationKey
+	order         []string
+}
+
+// NewKeySet builds a key set from a PEM private key used for signing and any
+// number of additional PEM public keys (or certificates) that are still
+// accepted for verification, e.g. the previous signing key during rotation.
+func NewKeySet(algorithm, signingKeyFile string, verificationKeyFiles []string) (*KeySet, error) {
+	if signingKeyFile == "" {
+		return nil, fmt.Errorf("JWT algorithm %s requires a signing key file", algorithm)
+	}
+
+	signer, err := loadPrivateKey(signingKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	alg, err := algorithmForKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", signingKeyFile, err)
+	}
+	if alg != algorithm {
+		return nil, fmt.Errorf("%s: key is for %s but JWT algorithm is %s", signingKeyFile, alg, algorithm)
+	}
+
+	ks := &KeySet{
+		signingMethod: jwt.GetSigningMethod(alg),
+		signingKey:    signer,
+		verification:  make(map[string]verificationKey),
+	}
+
+	if ks.signingKID, err = ks.addVerificationKey(signer.Public()); err != nil {
+		return nil, fmt.Errorf("%s: %w", signingKeyFile, err)
+	}
+
+	for _, file := range verificationKeyFiles {
+		publicKey, err := loadPublicKey(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ks.addVerificationKey(publicKey); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	return ks, nil
+}
+
+func (ks *KeySet) addVerificationKey(publicKey crypto.PublicKey) (string, error) {
+	alg, err := algorithmForKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	jwk, err := publicJWK(publicKey, alg)
+	if err != nil {
+		return "", err
+	}
+
+	if _, exists := ks.verification[jwk.Kid]; !exists {
+		ks.verification[jwk.Kid] = verificationKey{alg: alg, key: publicKey, jwk: jwk}
+		ks.order = append(ks.order, jwk.Kid)
+	}
+
+	return jwk.Kid, nil
+}
+
+// JWKS returns the public verification keys, signing key first.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, kid := range ks.order {
+		set.Keys = append(set.Keys, ks.verification[kid].jwk)
+	}
+	return set
+}
+
+func (ks *KeySet) sign(claims JWTClaims) (string, error) {
+	token := jwt.NewWithClaims(ks.signingMethod, claims)
+	token.Header["kid"] = ks.signingKID
+	return token.SignedString(ks.signingKey)
+}
+
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.verification[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+
+	if token.Method.Alg() != key.alg {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	return key.key, nil
+}
+
+// JWKS returns the published verification keys. It is empty when tokens
+// are signed with the shared HS256 secret.
+func (s *TokenService) JWKS() JWKS {
+	if s.keys == nil {
+		return JWKS{Keys: []JWK{}}
+	}
+	return s.keys.JWKS()
+}
+
+func algorithmForKey(publicKey crypto.PublicKey) (string, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return "", errors.New("RSA keys must be at least 2048 bits")
+		}
+		return AlgorithmRS256, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return "", errors.New("only P-256 EC keys are supported")
+		}
+		return AlgorithmES256, nil
+	case ed25519.PublicKey:
+		return AlgorithmEdDSA, nil
+	default:
+		return "", fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
+
+// publicJWK encodes a public key as a JWK whose kid is its RFC 7638 thumbprint.
+func publicJWK(publicKey crypto.PublicKey, alg string) (JWK, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{Use: "sig", Alg: alg}
+
+	// Members in lexicographic order as required for the thumbprint
+	var thumbprintInput interface{}
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(key.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(key.E)).Bytes())
+		thumbprintInput = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case *ecdsa.PublicKey:
+		ecdhKey, err := key.ECDH()
+		if err != nil {
+			return JWK{}, err
+		}
+		point := ecdhKey.Bytes()[1:]
+		size := len(point) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = key.Curve.Params().Name
+		jwk.X = b64(point[:size])
+		jwk.Y = b64(point[size:])
+		thumbprintInput = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(key)
+		thumbprintInput = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+
+	encoded, err := json.Marshal(thumbprintInput)
+	if err != nil {
+		return JWK{}, err
+	}
+	sum := sha256.Sum256(encoded)
+	jwk.Kid = b64(sum[:])
+
+	return jwk, nil
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", file)
+	}
+
+	return block, nil
+}
+
+func loadPrivateKey(file string) (crypto.Signer, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", file, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported private key type %T", file, key)
+	}
+
+	return signer, nil
+}
+
+func loadPublicKey(file string) (crypto.PublicKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return key, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return key, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return cert.PublicKey, nil
+	default:
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			signer, err := loadPrivateKey(file)
+			if err != nil {
+				return nil, err
+			}
+			return signer.Public(), nil
+		}
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", file, block.Type)
+	}
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeKeyPair(t *testing.T, name string, key crypto.Signer) (privateFile, publicFile string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+
+	privateFile = filepath.Join(dir, name+".pem")
+	publicFile = filepath.Join(dir, name+".pub.pem")
+	if err := os.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return privateFile, publicFile
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		alg string
+		key crypto.Signer
+		kty string
+	}{
+		{AlgorithmRS256, rsaKey, "RSA"},
+		{AlgorithmES256, ecKey, "EC"},
+		{AlgorithmEdDSA, edKey, "OKP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			privateFile, _ := writeKeyPair(t, "signing", tt.key)
+			ks, err := NewKeySet(tt.alg, privateFile, nil)
+			if err != nil {
+				t.Fatalf("NewKeySet: %v", err)
+			}
+			tokens := testTokenService(ks)
+
+			pair, err := tokens.GenerateTokenPair(1, "alice", "alice@example.com", "user", "session-1", 0)
+			if err != nil {
+				t.Fatalf("GenerateTokenPair: %v", err)
+			}
+
+			token, _, err := jwt.NewParser().ParseUnverified(pair.AccessToken, &JWTClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Method.Alg() != tt.alg {
+				t.Errorf("alg = %q, want %q", token.Method.Alg(), tt.alg)
+			}
+
+			jwks := tokens.JWKS()
+			if len(jwks.Keys) != 1 {
+				t.Fatalf("JWKS has %d keys, want 1", len(jwks.Keys))
+			}
+			if jwks.Keys[0].Kid != token.Header["kid"] || jwks.Keys[0].Kty != tt.kty || jwks.Keys[0].Alg != tt.alg {
+				t.Errorf("JWKS key %+v does not match token header %v", jwks.Keys[0], token.Header)
+			}
+
+			if _, err := tokens.ValidateAccessToken(pair.AccessToken); err != nil {
+				t.Errorf("ValidateAccessToken: %v", err)
+			}
+		})
+	}
+
+	t.Run("mismatched algorithm", func(t *testing.T) {
+		privateFile, _ := writeKeyPair(t, "signing", ecKey)
+		if _, err := NewKeySet(AlgorithmRS256, privateFile, nil); err == nil {
+			t.Error("EC key accepted for RS256")
+		}
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+	oldPrivate, oldPublic := writeKeyPair(t, "old", oldKey)
+	newPrivate, _ := writeKeyPair(t, "new", newKey)
+
+	oldSet, err := NewKeySet(AlgorithmEdDSA, oldPrivate, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := testTokenService(oldSet).GenerateTokenPair(1, "alice", "alice@example.com", "user", "session-1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := NewKeySet(AlgorithmEdDSA, newPrivate, []string{oldPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := testTokenService(rotated)
+	if _, err := tokens.ValidateAccessToken(pair.AccessToken); err != nil {
+		t.Errorf("token signed with previous key rejected: %v", err)
+	}
+	if n := len(tokens.JWKS().Keys); n != 2 {
+		t.Errorf("JWKS has %d keys, want 2", n)
+	}
+
+	retired, err := NewKeySet(AlgorithmEdDSA, newPrivate, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testTokenService(retired).ValidateAccessToken(pair.AccessToken); err == nil {
+		t.Error("token signed with retired key accepted")
+	}
+}
+
+func TestAsymmetricModeRejectsHS256(t *testing.T) {
+	hmacToken, err := testTokenService(nil).signToken(JWTClaims{TokenUse: TokenUseAccess})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	privateFile, _ := writeKeyPair(t, "signing", edKey)
+	ks, err := NewKeySet(AlgorithmEdDSA, privateFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testTokenService(ks).ValidateToken(hmacToken); err == nil {
+		t.Error("HS256 token accepted in EdDSA mode")
+	}
+}
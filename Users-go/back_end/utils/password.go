@@ -1,17 +1,27 @@
 package utils
 
 import (
+	"time"
+
 	"newworld-project/config"
+	"newworld-project/metrics"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 func HashPassword(password string) (string, error) {
+	defer observeHash("hash", time.Now())
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), config.ConfigInstance.Security.BcryptCost)
 	return string(bytes), err
 }
 
 func CheckPassword(password, hash string) bool {
+	defer observeHash("verify", time.Now())
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
-} 
\ No newline at end of file
+}
+
+// observeHash records how long a bcrypt operation that began at start took
+func observeHash(operation string, start time.Time) {
+	metrics.PasswordHashDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors (SHA-1), truncated to six digits
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(secret, TOTPCounter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	counter := TOTPCounter(now)
+
+	current, _ := TOTPCode(secret, counter)
+	previous, _ := TOTPCode(secret, counter-1)
+	stale, _ := TOTPCode(secret, counter-3)
+
+	if got, ok := ValidateTOTP(secret, current, now, 0); !ok || got != counter {
+		t.Errorf("current code: got (%d, %v), want (%d, true)", got, ok, counter)
+	}
+	if _, ok := ValidateTOTP(secret, previous, now, 0); !ok {
+		t.Error("code from previous period rejected")
+	}
+	if _, ok := ValidateTOTP(secret, stale, now, 0); ok {
+		t.Error("stale code accepted")
+	}
+	if _, ok := ValidateTOTP(secret, current, now, counter); ok {
+		t.Error("replayed code accepted")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("NewWorld Project", "alice@example.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/NewWorld%20Project:alice@example.com?") {
+		t.Errorf("unexpected label in %s", uri)
+	}
+	for _, param := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=NewWorld+Project", "digits=6", "period=30"} {
+		if !strings.Contains(uri, param) {
+			t.Errorf("%s missing %s", uri, param)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes := GenerateRecoveryCodes(10)
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 19 || seen[code] {
+			t.Errorf("bad or duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+
+	if HashRecoveryCode("ABCD-ef01 2345-6789") != HashRecoveryCode("abcdef0123456789") {
+		t.Error("hash is sensitive to case or separators")
+	}
+}